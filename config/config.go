@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/ngtrvu/zen-go/gorm/validator"
+)
+
+const (
+	TagName         = "config"
+	TagDefault      = "default"
+	TagRequired     = "required"
+	TagSecret       = "secret"
+	DefaultEnvFile  = ".env"
+	SliceSeparator  = ","
+	RedactedValue   = "******"
+	UnsetValueLabel = "<unset>"
+)
+
+// Options controls where Load reads configuration values from.
+// Sources are applied in this order, the later one wins:
+// default tags, YAML files, .env files, process environment.
+type Options struct {
+	// EnvFiles are dotenv files to read. Missing files are ignored.
+	EnvFiles []string
+
+	// YAMLFiles are YAML files with config keys at the top level. Missing files are ignored.
+	YAMLFiles []string
+
+	// Lookup overrides os.LookupEnv, mostly useful for testing.
+	Lookup func(key string) (string, bool)
+
+	// SkipValidation disables the `validate` tag rules after loading.
+	SkipValidation bool
+}
+
+// Load populates the struct pointed by v from the configured sources.
+//
+//	v: pointer to a struct with `config:"KEY"` tags, nested structs are walked recursively
+//	opts: sources to read from
+func Load(v interface{}, opts Options) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: expected a pointer to a struct, got %T", v)
+	}
+
+	values, err := collectValues(opts)
+	if err != nil {
+		return err
+	}
+
+	lookup := opts.Lookup
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	source := func(key string) (string, bool) {
+		if value, ok := lookup(key); ok {
+			return value, true
+		}
+		value, ok := values[key]
+		return value, ok
+	}
+
+	var missing []string
+	err = walk(rv.Elem(), func(field reflect.StructField, value reflect.Value, key string) error {
+		raw, ok := source(key)
+		if !ok {
+			raw, ok = field.Tag.Lookup(TagDefault)
+		}
+
+		if !ok || raw == "" {
+			if field.Tag.Get(TagRequired) == "true" {
+				missing = append(missing, key)
+			}
+			if !ok {
+				return nil
+			}
+		}
+
+		if err := setValue(value, raw); err != nil {
+			return fmt.Errorf("config: invalid value for %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("config: missing required keys: %s", strings.Join(missing, ", "))
+	}
+
+	if opts.SkipValidation {
+		return nil
+	}
+
+	if err := validator.Struct(v); err != nil {
+		return fmt.Errorf("config: validation failed: %w", err)
+	}
+
+	return nil
+}
+
+// MustLoad is like Load but panics on error. It is meant for program startup.
+func MustLoad(v interface{}, opts Options) {
+	if err := Load(v, opts); err != nil {
+		panic(err)
+	}
+}
+
+// collectValues reads YAML files first and then .env files so that .env wins.
+func collectValues(opts Options) (map[string]string, error) {
+	values := make(map[string]string)
+
+	for _, path := range opts.YAMLFiles {
+		fileValues, err := readYAMLFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+
+	for _, path := range opts.EnvFiles {
+		fileValues, err := readEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+
+	return values, nil
+}
+
+type visitFunc func(field reflect.StructField, value reflect.Value, key string) error
+
+// walk calls fn for every tagged field, descending into untagged nested structs.
+func walk(rv reflect.Value, fn visitFunc) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		value := rv.Field(i)
+		key := field.Tag.Get(TagName)
+		if key == "-" {
+			continue
+		}
+
+		if key == "" {
+			if value.Kind() == reflect.Ptr && value.Type().Elem().Kind() == reflect.Struct {
+				if value.IsNil() {
+					value.Set(reflect.New(value.Type().Elem()))
+				}
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct && !isLeafType(value.Type()) {
+				if err := walk(value, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := fn(field, value, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/config"
+	"github.com/ngtrvu/zen-go/zen"
+)
+
+type NestedConfig struct {
+	Timeout time.Duration `config:"NESTED_TIMEOUT" default:"5s"`
+	Hosts   []string      `config:"NESTED_HOSTS"`
+}
+
+type TestConfig struct {
+	Nested   NestedConfig
+	Name     string    `config:"NAME"     required:"true"`
+	Port     int       `config:"PORT"     default:"8080" validate:"min=1,max=65535"`
+	Debug    bool      `config:"DEBUG"`
+	Password string    `config:"PASSWORD"`
+	Ratios   []float64 `config:"RATIOS"`
+}
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestLoad_EnvAndDefaults(t *testing.T) {
+	var cfg TestConfig
+	err := config.Load(&cfg, config.Options{Lookup: lookupFrom(map[string]string{
+		"NAME":         "zen",
+		"DEBUG":        "true",
+		"NESTED_HOSTS": "a,b,c",
+		"RATIOS":       "0.5,1.5",
+	})})
+	require.NoError(t, err)
+
+	assert.Equal(t, "zen", cfg.Name)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.True(t, cfg.Debug)
+	assert.Equal(t, 5*time.Second, cfg.Nested.Timeout)
+	assert.Equal(t, []string{"a", "b", "c"}, cfg.Nested.Hosts)
+	assert.Equal(t, []float64{0.5, 1.5}, cfg.Ratios)
+}
+
+func TestLoad_RequiredAndValidation(t *testing.T) {
+	var cfg TestConfig
+	err := config.Load(&cfg, config.Options{Lookup: lookupFrom(map[string]string{})})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NAME")
+
+	err = config.Load(&cfg, config.Options{Lookup: lookupFrom(map[string]string{"NAME": "zen", "PORT": "70000"})})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "validation failed")
+
+	err = config.Load(&cfg, config.Options{Lookup: lookupFrom(map[string]string{"NAME": "zen", "PORT": "abc"})})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "PORT")
+}
+
+func TestLoad_FilePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	envPath := filepath.Join(dir, ".env")
+
+	require.NoError(t, os.WriteFile(yamlPath, []byte("NAME: from-yaml\nPORT: 9000\nNESTED_HOSTS:\n  - x\n  - y\n"), 0o600))
+	require.NoError(t, os.WriteFile(envPath, []byte("# comment\nexport PORT=9100\nPASSWORD=\"s3cret\" \n"), 0o600))
+
+	var cfg TestConfig
+	err := config.Load(&cfg, config.Options{
+		YAMLFiles: []string{yamlPath},
+		EnvFiles:  []string{envPath, filepath.Join(dir, "missing.env")},
+		Lookup:    lookupFrom(map[string]string{"DEBUG": "1"}),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "from-yaml", cfg.Name)
+	assert.Equal(t, 9100, cfg.Port)
+	assert.Equal(t, "s3cret", cfg.Password)
+	assert.Equal(t, []string{"x", "y"}, cfg.Nested.Hosts)
+	assert.True(t, cfg.Debug)
+}
+
+func TestSummary_RedactsSecrets(t *testing.T) {
+	cfg := zen.ZenConfig{SecretKey: "top-secret"}
+	cfg.DBConfig.DB_PASSWORD = "postgres"
+	cfg.DBConfig.DB_HOST = "localhost"
+
+	summary := config.Summary(&cfg)
+	assert.Contains(t, summary, "DB_HOST=localhost")
+	assert.Contains(t, summary, "DB_PASSWORD="+config.RedactedValue)
+	assert.Contains(t, summary, "SECRET_KEY="+config.RedactedValue)
+	assert.Contains(t, summary, "DB_NAME="+config.UnsetValueLabel)
+	assert.False(t, strings.Contains(summary, "top-secret"))
+}
+
+func TestLoad_ZenConfig(t *testing.T) {
+	var cfg zen.ZenConfig
+	err := config.Load(&cfg, config.Options{Lookup: lookupFrom(map[string]string{
+		"DB_HOST":          "db",
+		"HTTP_SERVER_PORT": "8000",
+	})})
+	require.NoError(t, err)
+
+	assert.Equal(t, "db", cfg.DBConfig.DB_HOST)
+	assert.Equal(t, "5432", cfg.DBConfig.DB_PORT)
+	assert.Equal(t, 8000, cfg.HTTPServerConfig.Port)
+	assert.Equal(t, "info", cfg.LoggingConfig.Level)
+	assert.Equal(t, int64(10), cfg.MaxUploadSizeInMegabyte)
+}
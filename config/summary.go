@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ngtrvu/zen-go/log"
+)
+
+// sensitiveKeyParts marks keys as secret even when the `secret` tag is missing.
+var sensitiveKeyParts = []string{"PASSWORD", "SECRET", "TOKEN", "PRIVATE_KEY", "CREDENTIAL", "API_KEY"}
+
+// Summary returns the effective settings as sorted KEY=VALUE lines with secrets redacted.
+func Summary(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return ""
+	}
+
+	var lines []string
+	// walk only sets values on nil nested pointers, summarising a copy keeps v untouched
+	copied := reflect.New(rv.Type()).Elem()
+	copied.Set(rv)
+	_ = walk(copied, func(field reflect.StructField, value reflect.Value, key string) error {
+		display := formatValue(value)
+		if isSecret(field, key) && display != UnsetValueLabel {
+			display = RedactedValue
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s", key, display))
+		return nil
+	})
+
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// PrintSummary logs the redacted effective settings, one line per key.
+func PrintSummary(v interface{}) {
+	log.Info("effective configuration:\n%s", Summary(v))
+}
+
+func isSecret(field reflect.StructField, key string) bool {
+	if field.Tag.Get(TagSecret) == "true" {
+		return true
+	}
+
+	upperKey := strings.ToUpper(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(upperKey, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+const (
+	HeaderRequestID   = "X-Request-ID"
+	HeaderTraceParent = "traceparent"
+
+	// keys used in gRPC metadata and queue task metadata
+	KeyRequestID   = "x-request-id"
+	KeyTraceParent = "traceparent"
+
+	// log field names
+	FieldRequestID = "request_id"
+	FieldTraceID   = "trace_id"
+	FieldSpanID    = "span_id"
+
+	FieldTraceSampled = "trace_sampled"
+
+	maxRequestIDLength = 128
+)
+
+type ctxKey struct{}
+
+var (
+	requestIDPattern   = regexp.MustCompile(`^[A-Za-z0-9._:\-]+$`)
+	traceParentPattern = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+)
+
+// IDs identifies a unit of work across HTTP, gRPC, logs and queue tasks.
+type IDs struct {
+	RequestID   string
+	TraceParent string
+}
+
+// TraceID returns the trace id part of the W3C traceparent, empty if absent.
+func (ids IDs) TraceID() string {
+	match := traceParentPattern.FindStringSubmatch(ids.TraceParent)
+	if match == nil {
+		return ""
+	}
+	return match[2]
+}
+
+// SpanID returns the parent span id part of the W3C traceparent, empty if absent.
+func (ids IDs) SpanID() string {
+	match := traceParentPattern.FindStringSubmatch(ids.TraceParent)
+	if match == nil {
+		return ""
+	}
+	return match[3]
+}
+
+// Sampled reports whether the sampled flag of the W3C traceparent is set.
+func (ids IDs) Sampled() bool {
+	match := traceParentPattern.FindStringSubmatch(ids.TraceParent)
+	if match == nil {
+		return false
+	}
+	flags, err := hex.DecodeString(match[4])
+	return err == nil && flags[0]&0x01 == 0x01
+}
+
+// NewContext stores ids in ctx.
+func NewContext(ctx context.Context, ids IDs) context.Context {
+	return context.WithValue(ctx, ctxKey{}, ids)
+}
+
+// FromContext returns the ids stored in ctx.
+func FromContext(ctx context.Context) (IDs, bool) {
+	if ctx == nil {
+		return IDs{}, false
+	}
+	ids, ok := ctx.Value(ctxKey{}).(IDs)
+	return ids, ok
+}
+
+// RequestID returns the request id stored in ctx, empty if absent.
+func RequestID(ctx context.Context) string {
+	ids, _ := FromContext(ctx)
+	return ids.RequestID
+}
+
+// Ensure accepts the incoming ids when valid and generates the missing ones.
+func Ensure(ids IDs) IDs {
+	if !ValidRequestID(ids.RequestID) {
+		ids.RequestID = NewRequestID()
+	}
+	if !ValidTraceParent(ids.TraceParent) {
+		ids.TraceParent = NewTraceParent()
+	}
+	return ids
+}
+
+// ValidRequestID rejects empty, oversized or unsafe ids coming from clients.
+func ValidRequestID(requestID string) bool {
+	return len(requestID) > 0 && len(requestID) <= maxRequestIDLength && requestIDPattern.MatchString(requestID)
+}
+
+// ValidTraceParent checks the W3C trace context format, all-zero ids are invalid.
+func ValidTraceParent(traceParent string) bool {
+	match := traceParentPattern.FindStringSubmatch(traceParent)
+	if match == nil || match[1] == "ff" {
+		return false
+	}
+	return match[2] != "00000000000000000000000000000000" && match[3] != "0000000000000000"
+}
+
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// NewTraceParent starts a new sampled trace.
+func NewTraceParent() string {
+	return "00-" + randomHex(16) + "-" + randomHex(8) + "-01"
+}
+
+func randomHex(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ToMap serializes the ids stored in ctx, used for queue task metadata.
+func ToMap(ctx context.Context) map[string]string {
+	ids, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	values := make(map[string]string, 2)
+	if ids.RequestID != "" {
+		values[KeyRequestID] = ids.RequestID
+	}
+	if ids.TraceParent != "" {
+		values[KeyTraceParent] = ids.TraceParent
+	}
+	return values
+}
+
+// FromMap restores the ids serialized by ToMap, generating the missing ones.
+func FromMap(ctx context.Context, values map[string]string) context.Context {
+	return NewContext(ctx, Ensure(IDs{
+		RequestID:   values[KeyRequestID],
+		TraceParent: values[KeyTraceParent],
+	}))
+}
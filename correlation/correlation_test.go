@@ -0,0 +1,93 @@
+package correlation_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ngtrvu/zen-go/correlation"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestMiddleware_AcceptsIncomingIDs(t *testing.T) {
+	var ids correlation.IDs
+	handler := correlation.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids, _ = correlation.FromContext(r.Context())
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(correlation.HeaderRequestID, "req-123")
+	request.Header.Set(correlation.HeaderTraceParent, traceParent)
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+
+	assert.Equal(t, "req-123", ids.RequestID)
+	assert.Equal(t, traceParent, ids.TraceParent)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", ids.TraceID())
+	assert.Equal(t, "00f067aa0ba902b7", ids.SpanID())
+	assert.Equal(t, "req-123", writer.Header().Get(correlation.HeaderRequestID))
+}
+
+func TestMiddleware_GeneratesInvalidIDs(t *testing.T) {
+	var ids correlation.IDs
+	handler := correlation.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids, _ = correlation.FromContext(r.Context())
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(correlation.HeaderRequestID, "bad id\n with spaces")
+	request.Header.Set(correlation.HeaderTraceParent, "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.True(t, correlation.ValidRequestID(ids.RequestID))
+	assert.NotEqual(t, "bad id\n with spaces", ids.RequestID)
+	assert.True(t, correlation.ValidTraceParent(ids.TraceParent))
+	assert.Len(t, ids.TraceID(), 32)
+}
+
+func TestInjectHeaders(t *testing.T) {
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: "req-1", TraceParent: traceParent})
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	request.Header.Set(correlation.HeaderRequestID, "caller-set")
+
+	correlation.InjectHeaders(request)
+	assert.Equal(t, "caller-set", request.Header.Get(correlation.HeaderRequestID))
+	assert.Equal(t, traceParent, request.Header.Get(correlation.HeaderTraceParent))
+}
+
+func TestMapRoundTrip(t *testing.T) {
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: "req-1", TraceParent: traceParent})
+	values := correlation.ToMap(ctx)
+
+	restored, ok := correlation.FromContext(correlation.FromMap(context.Background(), values))
+	require.True(t, ok)
+	assert.Equal(t, "req-1", restored.RequestID)
+	assert.Equal(t, traceParent, restored.TraceParent)
+
+	assert.Nil(t, correlation.ToMap(context.Background()))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := correlation.UnaryServerInterceptor()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(correlation.KeyRequestID, "grpc-req"))
+
+	var requestID string
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Method"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		requestID = correlation.RequestID(ctx)
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "grpc-req", requestID)
+
+	outgoing := correlation.OutgoingContext(correlation.NewContext(context.Background(), correlation.IDs{RequestID: "out-req"}))
+	md, ok := metadata.FromOutgoingContext(outgoing)
+	require.True(t, ok)
+	assert.Equal(t, []string{"out-req"}, md.Get(correlation.KeyRequestID))
+}
@@ -0,0 +1,58 @@
+package correlation
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryServerInterceptor reads the ids from incoming metadata or generates them and sends the request id back.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ids := IDs{}
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			ids.RequestID = firstValue(md, KeyRequestID)
+			ids.TraceParent = firstValue(md, KeyTraceParent)
+		}
+		ids = Ensure(ids)
+
+		grpc.SetHeader(ctx, metadata.Pairs(KeyRequestID, ids.RequestID))
+		return handler(NewContext(ctx, ids), req)
+	}
+}
+
+// UnaryClientInterceptor propagates the ids stored in ctx to outgoing calls.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(OutgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// OutgoingContext appends the ids stored in ctx to the outgoing gRPC metadata.
+func OutgoingContext(ctx context.Context) context.Context {
+	ids, ok := FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	var pairs []string
+	if ids.RequestID != "" {
+		pairs = append(pairs, KeyRequestID, ids.RequestID)
+	}
+	if ids.TraceParent != "" {
+		pairs = append(pairs, KeyTraceParent, ids.TraceParent)
+	}
+	if len(pairs) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+func firstValue(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
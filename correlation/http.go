@@ -0,0 +1,36 @@
+package correlation
+
+import (
+	"net/http"
+)
+
+// Middleware accepts X-Request-ID and traceparent from the caller or generates them,
+// stores them in the request context and echoes the request id in the response.
+func Middleware(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ids := Ensure(IDs{
+			RequestID:   r.Header.Get(HeaderRequestID),
+			TraceParent: r.Header.Get(HeaderTraceParent),
+		})
+
+		w.Header().Set(HeaderRequestID, ids.RequestID)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), ids)))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// InjectHeaders copies the ids from the request context into outbound headers.
+// Headers already set by the caller are kept.
+func InjectHeaders(r *http.Request) {
+	ids, ok := FromContext(r.Context())
+	if !ok {
+		return
+	}
+
+	if ids.RequestID != "" && r.Header.Get(HeaderRequestID) == "" {
+		r.Header.Set(HeaderRequestID, ids.RequestID)
+	}
+	if ids.TraceParent != "" && r.Header.Get(HeaderTraceParent) == "" {
+		r.Header.Set(HeaderTraceParent, ids.TraceParent)
+	}
+}
@@ -25,14 +25,30 @@ type Database struct {
 type DBConfig struct {
 	DB_HOST                      string `config:"DB_HOST"`
 	DB_USERNAME                  string `config:"DB_USERNAME"`
-	DB_PASSWORD                  string `config:"DB_PASSWORD"`
+	DB_PASSWORD                  string `config:"DB_PASSWORD" secret:"true"`
 	DB_NAME                      string `config:"DB_NAME"`
-	DB_PORT                      string `config:"DB_PORT"`
-	SSLMode                      string `config:"DB_SSL_MODE"`
-	TimeZone                     string `config:"DB_TIME_ZONE"`
-	DB_POOL_MAX_OPEN_CONNECTIONS int    `config:"DB_POOL_MAX_OPEN_CONNECTIONS"`
-	DB_POOL_MAX_IDLE_CONNECTIONS int    `config:"DB_POOL_MAX_IDLE_CONNECTIONS"`
+	DB_PORT                      string `config:"DB_PORT" default:"5432"`
+	SSLMode                      string `config:"DB_SSL_MODE" default:"disable"`
+	TimeZone                     string `config:"DB_TIME_ZONE" default:"Asia/Ho_Chi_Minh"`
+	DB_POOL_MAX_OPEN_CONNECTIONS int    `config:"DB_POOL_MAX_OPEN_CONNECTIONS" default:"50"`
+	DB_POOL_MAX_IDLE_CONNECTIONS int    `config:"DB_POOL_MAX_IDLE_CONNECTIONS" default:"10"`
 	DB_METRICS_ENABLED           bool   `config:"DB_METRICS_ENABLED"`
+
+	// query logging, see log.GormLoggerOptions
+	LogLevel             string        `config:"DB_LOG_LEVEL" default:"info"`
+	SlowQueryThreshold   time.Duration `config:"DB_SLOW_QUERY_THRESHOLD" default:"500ms"`
+	ParameterizedQueries bool          `config:"DB_LOG_PARAMETERIZED_QUERIES"`
+	LogSampleEvery       uint32        `config:"DB_LOG_SAMPLE_EVERY" default:"1"`
+}
+
+// GormLoggerOptions returns the query logging options of the config.
+func (cfg *DBConfig) GormLoggerOptions() log.GormLoggerOptions {
+	return log.GormLoggerOptions{
+		Level:                cfg.LogLevel,
+		SlowThreshold:        cfg.SlowQueryThreshold,
+		ParameterizedQueries: cfg.ParameterizedQueries,
+		SampleEvery:          cfg.LogSampleEvery,
+	}
 }
 
 func NewDatabase(cfg *DBConfig) (db *Database, err error) {
@@ -52,7 +68,7 @@ func NewDatabase(cfg *DBConfig) (db *Database, err error) {
 	}
 	pg := postgres.New(pgCfg)
 	gormDB, err := gorm.Open(pg, &gorm.Config{
-		Logger: log.NewGormLogger("info"),
+		Logger: log.NewGormLoggerWithOptions(cfg.GormLoggerOptions()),
 	})
 	if err != nil {
 		log.Error("failed to connect database: %v", err)
@@ -92,6 +108,16 @@ func NewDatabase(cfg *DBConfig) (db *Database, err error) {
 	return
 }
 
+// Close closes the underlying connection pool.
+func (db *Database) Close() error {
+	sqlDB, err := db.GormDB.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
 func (db *Database) CheckMigration(ctx context.Context, migrationData *bindata.AssetSource) (*migrate.Migrate, error) {
 	sqlDB, _ := db.GormDB.DB()
 	sourceInstance, err := bindata.WithInstance(migrationData)
@@ -13,6 +13,7 @@ import (
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 
+	"github.com/ngtrvu/zen-go/correlation"
 	"github.com/ngtrvu/zen-go/log"
 	"github.com/ngtrvu/zen-go/metrics"
 	grpc_metrics "github.com/ngtrvu/zen-go/metrics/grpc"
@@ -53,22 +54,70 @@ func (s *StagGrpcServer) initialize(ctx context.Context, ctxCancel context.Cance
 	go func() {
 		log.Info("starting app metrics server at port 9091...")
 		metricsServer := metrics.NewMetricServer("/metrics", "9091")
+		if token := os.Getenv(log.LevelTokenEnv); token != "" {
+			metricsServer.Handle(log.LevelHandlerPath, log.TokenLevelHandler(token))
+		}
 		err := metricsServer.Start(ctx)
 		if err != nil {
 			log.Info("metrics server return error: %v", err)
 		}
 	}()
 
+	s.setupGrpcServer()
+
+	return nil
+}
+
+// NewGrpcServer creates the server without installing a signal handler or starting a metrics server.
+// Use it when the lifecycle is managed by the caller (e.g. zen.App).
+func NewGrpcServer(namespace string, serviceName string) *StagGrpcServer {
+	server := &StagGrpcServer{namespace: namespace, serviceName: serviceName}
+	server.setupGrpcServer()
+
+	return server
+}
+
+func (s *StagGrpcServer) setupGrpcServer() {
 	metricsObserver := grpc_metrics.NewMetrics(s.namespace, s.serviceName)
 	unaryInterceptor := grpc.ChainUnaryInterceptor(
+		correlation.UnaryServerInterceptor(),
 		grpc_metrics.NewMetricsUnaryInterceptor(metricsObserver),
 	)
 	s.GrpcServer = grpc.NewServer(
 		unaryInterceptor,
 	)
 	grpc_health_v1.RegisterHealthServer(s.GrpcServer, health.NewServer())
+}
 
-	return nil
+// ListenAndServe serves on the configured port until Stop is called.
+func (s *StagGrpcServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	if err != nil {
+		log.Error("failed to listen: %v", err)
+		return err
+	}
+
+	log.Info("running grpc server, port: %d...", *port)
+	return s.GrpcServer.Serve(listener)
+}
+
+// Stop waits for pending RPCs to finish and force closes them once ctx is done.
+func (s *StagGrpcServer) Stop(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.GrpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.Info("GRPC server stopped safely")
+		return nil
+	case <-ctx.Done():
+		s.GrpcServer.Stop()
+		log.Warn("GRPC server force stopped: %v", ctx.Err())
+		return ctx.Err()
+	}
 }
 
 func (s *StagGrpcServer) Serve(ctx context.Context, ctxCancel context.CancelFunc) error {
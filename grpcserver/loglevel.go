@@ -0,0 +1,242 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/ngtrvu/zen-go/log"
+)
+
+// LogLevelServiceName is the gRPC counterpart of log.LevelHandler. Requests and responses are
+// google.protobuf.Struct values with the same fields as the HTTP endpoint, so no generated code is needed.
+const LogLevelServiceName = "zen.admin.LogLevelService"
+
+type logLevelServer interface {
+	GetLogLevel(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	SetLogLevel(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	ResetLogLevel(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	authorize(context.Context) error
+}
+
+type logLevelService struct {
+	token string
+}
+
+var logLevelServiceDesc = grpc.ServiceDesc{
+	ServiceName: LogLevelServiceName,
+	HandlerType: (*logLevelServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetLogLevel", Handler: logLevelHandler(logLevelServer.GetLogLevel, "GetLogLevel")},
+		{MethodName: "SetLogLevel", Handler: logLevelHandler(logLevelServer.SetLogLevel, "SetLogLevel")},
+		{MethodName: "ResetLogLevel", Handler: logLevelHandler(logLevelServer.ResetLogLevel, "ResetLogLevel")},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "zen/admin/log_level",
+}
+
+// RegisterLogLevelService exposes the runtime log level control on s. It is opt-in since the
+// gRPC port is usually reachable by other services, and calls must carry the bearer token of
+// log.LevelTokenEnv in their "authorization" metadata, see LogLevelClient.WithToken. Every call is
+// rejected when the variable is empty.
+func RegisterLogLevelService(s grpc.ServiceRegistrar) {
+	token := os.Getenv(log.LevelTokenEnv)
+	if token == "" {
+		log.Warn("%s is not set, the calls to %s are rejected", log.LevelTokenEnv, LogLevelServiceName)
+	}
+	s.RegisterService(&logLevelServiceDesc, logLevelService{token: token})
+}
+
+// RegisterLogLevelService exposes the runtime log level control on the server.
+func (s *StagGrpcServer) RegisterLogLevelService() {
+	RegisterLogLevelService(s.GrpcServer)
+}
+
+func (s logLevelService) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, authorization := range md.Get("authorization") {
+		if s.token != "" && subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+s.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid log level token")
+}
+
+func (logLevelService) GetLogLevel(_ context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	module := req.GetFields()["module"].GetStringValue()
+	if module == "" {
+		return toStruct(map[string]interface{}{"levels": log.GetLevels()})
+	}
+
+	state, err := log.GetLevel(module)
+	if err != nil {
+		return nil, levelError(err)
+	}
+	return toStruct(state)
+}
+
+func (logLevelService) SetLogLevel(_ context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	fields := req.GetFields()
+	state, err := log.SetLevel(log.LevelRequest{
+		Module: fields["module"].GetStringValue(),
+		Level:  fields["level"].GetStringValue(),
+		TTL:    fields["ttl"].GetStringValue(),
+	})
+	if err != nil {
+		return nil, levelError(err)
+	}
+	return toStruct(state)
+}
+
+func (logLevelService) ResetLogLevel(_ context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	module := req.GetFields()["module"].GetStringValue()
+	if module == "" {
+		module = log.ModuleDefault
+	}
+
+	state, err := log.ResetLevel(module)
+	if err != nil {
+		return nil, levelError(err)
+	}
+	return toStruct(state)
+}
+
+func logLevelHandler(
+	method func(logLevelServer, context.Context, *structpb.Struct) (*structpb.Struct, error),
+	name string,
+) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(structpb.Struct)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+			if err := srv.(logLevelServer).authorize(ctx); err != nil {
+				return nil, err
+			}
+			return method(srv.(logLevelServer), ctx, in)
+		}
+		if interceptor == nil {
+			return call(ctx, in)
+		}
+
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + LogLevelServiceName + "/" + name}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(ctx, req.(*structpb.Struct))
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+func levelError(err error) error {
+	if errors.Is(err, log.ErrUnknownModule) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// toStruct converts v through its JSON form so the fields match the HTTP endpoint.
+func toStruct(v interface{}) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return structpb.NewStruct(fields)
+}
+
+// LogLevelClient calls the LogLevelService of another process.
+type LogLevelClient struct {
+	conn  grpc.ClientConnInterface
+	token string
+}
+
+func NewLogLevelClient(conn grpc.ClientConnInterface) *LogLevelClient {
+	return &LogLevelClient{conn: conn}
+}
+
+// WithToken returns a client sending token, the log.LevelTokenEnv of the other process.
+func (c *LogLevelClient) WithToken(token string) *LogLevelClient {
+	clone := *c
+	clone.token = token
+	return &clone
+}
+
+// GetLogLevels returns the levels of every module, or only module when set.
+func (c *LogLevelClient) GetLogLevels(ctx context.Context, module string) ([]log.LevelState, error) {
+	out, err := c.invoke(ctx, "GetLogLevel", map[string]interface{}{"module": module})
+	if err != nil {
+		return nil, err
+	}
+
+	if module != "" {
+		var state log.LevelState
+		if err := fromStruct(out, &state); err != nil {
+			return nil, err
+		}
+		return []log.LevelState{state}, nil
+	}
+
+	var resp struct {
+		Levels []log.LevelState `json:"levels"`
+	}
+	if err := fromStruct(out, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Levels, nil
+}
+
+func (c *LogLevelClient) SetLogLevel(ctx context.Context, req log.LevelRequest) (log.LevelState, error) {
+	var state log.LevelState
+	out, err := c.invoke(ctx, "SetLogLevel", map[string]interface{}{"module": req.Module, "level": req.Level, "ttl": req.TTL})
+	if err != nil {
+		return state, err
+	}
+	err = fromStruct(out, &state)
+	return state, err
+}
+
+func (c *LogLevelClient) ResetLogLevel(ctx context.Context, module string) (log.LevelState, error) {
+	var state log.LevelState
+	out, err := c.invoke(ctx, "ResetLogLevel", map[string]interface{}{"module": module})
+	if err != nil {
+		return state, err
+	}
+	err = fromStruct(out, &state)
+	return state, err
+}
+
+func (c *LogLevelClient) invoke(ctx context.Context, method string, fields map[string]interface{}) (*structpb.Struct, error) {
+	in, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+	}
+
+	out := new(structpb.Struct)
+	err = c.conn.Invoke(ctx, "/"+LogLevelServiceName+"/"+method, in, out)
+	return out, err
+}
+
+func fromStruct(s *structpb.Struct, v interface{}) error {
+	data, err := s.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,69 @@
+package grpcserver_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ngtrvu/zen-go/grpcserver"
+	"github.com/ngtrvu/zen-go/log"
+)
+
+func TestLogLevelService(t *testing.T) {
+	t.Setenv(log.LevelTokenEnv, "secret")
+	listener := bufconn.Listen(1 << 20)
+	server := grpcserver.NewGrpcServer("zen", "test")
+	server.RegisterLogLevelService()
+	go server.GrpcServer.Serve(listener)
+	t.Cleanup(server.GrpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	ctx := context.Background()
+	t.Cleanup(func() { log.ResetLevel(log.ModuleGorm) })
+
+	for _, unauthorized := range []*grpcserver.LogLevelClient{grpcserver.NewLogLevelClient(conn), grpcserver.NewLogLevelClient(conn).WithToken("other")} {
+		_, err = unauthorized.SetLogLevel(ctx, log.LevelRequest{Module: log.ModuleGorm, Level: "debug"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		_, err = unauthorized.GetLogLevels(ctx, "")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	assert.NotEqual(t, zerolog.DebugLevel, log.ModuleLevel(log.ModuleGorm))
+
+	client := grpcserver.NewLogLevelClient(conn).WithToken("secret")
+
+	state, err := client.SetLogLevel(ctx, log.LevelRequest{Module: log.ModuleGorm, Level: "debug", TTL: "1m"})
+	require.NoError(t, err)
+	assert.Equal(t, "debug", state.Level)
+	assert.NotNil(t, state.ExpiresAt)
+	assert.Equal(t, zerolog.DebugLevel, log.ModuleLevel(log.ModuleGorm))
+
+	states, err := client.GetLogLevels(ctx, log.ModuleGorm)
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, "debug", states[0].Level)
+
+	state, err = client.ResetLogLevel(ctx, log.ModuleGorm)
+	require.NoError(t, err)
+	assert.Equal(t, state.BaseLevel, state.Level)
+	assert.Nil(t, state.ExpiresAt)
+
+	_, err = client.SetLogLevel(ctx, log.LevelRequest{Module: "payment", Level: "debug"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -1,13 +1,28 @@
 package httpserver
 
+import "time"
+
 const (
 	ItemsPerPage = 20
+
+	DefaultGracefulShutdown = 30 * time.Second
+	DefaultDrainDelay       = 5 * time.Second
 )
 
+// HTTPServerConfig holds the server settings. Timeouts are in seconds, 0 means no timeout. DrainDelay
+// is in seconds too, 0 uses DefaultDrainDelay, DisableDrain stops without draining.
 type HTTPServerConfig struct {
-	Port             int `config:"HTTP_SERVER_PORT"`
-	GracefulShutdown int `config:"HTTP_SERVER_GRACEFUL_SHUTDOWN"`
-	ReadTimeout      int `config:"HTTP_SERVER_READ_TIMEOUT"`
-	WriteTimeout     int `config:"HTTP_SERVER_WRITE_TIMEOUT"`
-	IdleTimeout      int `config:"HTTP_SERVER_IDLE_TIMEOUT"`
+	Port              int  `config:"HTTP_SERVER_PORT" default:"8080"`
+	GracefulShutdown  int  `config:"HTTP_SERVER_GRACEFUL_SHUTDOWN" default:"30"`
+	DrainDelay        int  `config:"HTTP_SERVER_DRAIN_DELAY" default:"5"`
+	DisableDrain      bool `config:"HTTP_SERVER_DISABLE_DRAIN"`
+	ReadTimeout       int  `config:"HTTP_SERVER_READ_TIMEOUT" default:"30"`
+	ReadHeaderTimeout int  `config:"HTTP_SERVER_READ_HEADER_TIMEOUT" default:"10"`
+	WriteTimeout      int  `config:"HTTP_SERVER_WRITE_TIMEOUT" default:"30"`
+	IdleTimeout       int  `config:"HTTP_SERVER_IDLE_TIMEOUT" default:"120"`
+	MaxHeaderBytes    int  `config:"HTTP_SERVER_MAX_HEADER_BYTES" default:"1048576"`
+}
+
+func seconds(value int) time.Duration {
+	return time.Duration(value) * time.Second
 }
@@ -7,102 +7,207 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/getsentry/sentry-go"
-	sentryhttp "github.com/getsentry/sentry-go/http"
 	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
-	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
 	"github.com/ngtrvu/zen-go/log"
 	"github.com/ngtrvu/zen-go/metrics"
-
-	http_metrics "github.com/ngtrvu/zen-go/metrics/http"
 )
 
 type APIServer struct {
 	HTTPServer http.Server
+
+	// GracefulShutdown is how long Stop waits for in-flight requests before force closing connections.
+	GracefulShutdown time.Duration
+
+	// DrainDelay is how long Stop reports /healthy as failing before it stops accepting connections,
+	// so load balancers can take the instance out of rotation. DefaultDrainDelay when 0.
+	DrainDelay time.Duration
+	// DisableDrain makes Stop stop accepting connections right away, e.g. without a load balancer.
+	DisableDrain bool
+
+	// unhealthy fails the /healthy of this server only, e.g. while it drains
+	unhealthy atomic.Bool
 }
 
-func NewRouter(AppName string) *chi.Mux {
-	router := chi.NewRouter()
-
-	// CORS
-	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	}))
-
-	// sentry middleware
-	sentryMiddleware := sentryhttp.New(sentryhttp.Options{
-		Repanic: true,
-	})
-	router.Use(sentryMiddleware.Handle)
+var healthy atomic.Bool
 
-	// add some base middlewares
-	httpMetricsObserver := http_metrics.NewHTTPMetrics(AppName)
-	router.Use(http_metrics.InboundMetricsMiddleware(httpMetricsObserver))
-	router.Use(middleware.RealIP)
+func init() {
+	healthy.Store(true)
+}
 
-	router.Get("/healthy", GetHealthCheck)
+// SetHealthy changes the /healthy response of every server, see APIServer.SetHealthy for a single one.
+func SetHealthy(value bool) {
+	healthy.Store(value)
+}
 
-	return router
+// IsHealthy reports the /healthy status set by SetHealthy.
+func IsHealthy() bool {
+	return healthy.Load()
+}
+
+// SetHealthy changes the /healthy response of the server, it is flipped to failing when it starts
+// draining.
+func (apiServer *APIServer) SetHealthy(value bool) {
+	apiServer.unhealthy.Store(!value)
+}
+
+// IsHealthy reports the /healthy status of the server, failing when either it or SetHealthy is.
+func (apiServer *APIServer) IsHealthy() bool {
+	return !apiServer.unhealthy.Load() && IsHealthy()
+}
+
+// NewRouter creates a router with DefaultRouterOptions. Use NewRouterWithOptions to lock down CORS
+// or turn middlewares off.
+func NewRouter(AppName string) *chi.Mux {
+	return NewRouterWithOptions(DefaultRouterOptions(AppName))
 }
 
 func NewAPIServer(router *chi.Mux, httpServerConfig *HTTPServerConfig) *APIServer {
+	gracefulShutdown := seconds(httpServerConfig.GracefulShutdown)
+	if gracefulShutdown == 0 {
+		gracefulShutdown = DefaultGracefulShutdown
+	}
+
 	apiServer := &APIServer{
 		HTTPServer: http.Server{
-			Addr:    fmt.Sprintf(":%d", httpServerConfig.Port),
-			Handler: router,
+			Addr:              fmt.Sprintf(":%d", httpServerConfig.Port),
+			ReadTimeout:       seconds(httpServerConfig.ReadTimeout),
+			ReadHeaderTimeout: seconds(httpServerConfig.ReadHeaderTimeout),
+			WriteTimeout:      seconds(httpServerConfig.WriteTimeout),
+			IdleTimeout:       seconds(httpServerConfig.IdleTimeout),
+			MaxHeaderBytes:    httpServerConfig.MaxHeaderBytes,
 		},
+		GracefulShutdown: gracefulShutdown,
+		DrainDelay:       seconds(httpServerConfig.DrainDelay),
+		DisableDrain:     httpServerConfig.DisableDrain,
 	}
+	apiServer.HTTPServer.Handler = apiServer.healthCheck(router)
 
 	return apiServer
 }
 
 func GetHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if !IsHealthy() {
+		writeUnhealthy(w, r)
+		return
+	}
+
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, "OK")
 }
 
+func writeUnhealthy(w http.ResponseWriter, r *http.Request) {
+	render.Status(r, http.StatusServiceUnavailable)
+	render.JSON(w, r, "SHUTTING_DOWN")
+}
+
+// healthCheck fails HealthCheckPath while the server is unhealthy, the router answers it otherwise.
+func (apiServer *APIServer) healthCheck(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == HealthCheckPath && !apiServer.IsHealthy() {
+			writeUnhealthy(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Serve accepts connections until the server is stopped. It does not install a signal handler,
+// use it when the server lifecycle is managed by the caller (e.g. zen.App).
+func (apiServer *APIServer) Serve() error {
+	log.Info("listening and serving at %s...", apiServer.HTTPServer.Addr)
+	apiServer.SetHealthy(true)
+
+	err := apiServer.HTTPServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("http server error: %v", err)
+		return err
+	}
+
+	log.Info("stopped serving new connections")
+	return nil
+}
+
+// Stop drains the server: its /healthy starts failing, after DrainDelay new connections are refused
+// and in-flight requests get up to GracefulShutdown to finish before connections are force closed.
+func (apiServer *APIServer) Stop(ctx context.Context) error {
+	defer sentry.Flush(2 * time.Second)
+
+	apiServer.SetHealthy(false)
+	drainDelay := apiServer.drainDelay()
+	if drainDelay > 0 {
+		log.Info("draining for %v before shutting down...", drainDelay)
+		select {
+		case <-time.After(drainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	// the in-flight requests get their GracefulShutdown even when ctx ended during the drain
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), apiServer.gracefulShutdown())
+	defer cancel()
+
+	err := apiServer.HTTPServer.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Error("http server graceful shutdown error: %v, force closing connections", err)
+		if closeErr := apiServer.HTTPServer.Close(); closeErr != nil {
+			log.Error("http server close error: %v", closeErr)
+		}
+		return err
+	}
+
+	log.Info("server stopped safely")
+	return nil
+}
+
+// StopTimeout is how long Stop can take: DrainDelay then GracefulShutdown, with their defaults.
+func (apiServer *APIServer) StopTimeout() time.Duration {
+	return apiServer.drainDelay() + apiServer.gracefulShutdown()
+}
+
+func (apiServer *APIServer) drainDelay() time.Duration {
+	switch {
+	case apiServer.DisableDrain:
+		return 0
+	case apiServer.DrainDelay <= 0:
+		return DefaultDrainDelay
+	}
+	return apiServer.DrainDelay
+}
+
+func (apiServer *APIServer) gracefulShutdown() time.Duration {
+	if apiServer.GracefulShutdown == 0 {
+		return DefaultGracefulShutdown
+	}
+	return apiServer.GracefulShutdown
+}
+
 func (apiServer *APIServer) Start(ctx context.Context) error {
 	go func() {
 		log.Info("starting metrics server at port 9090...")
 
 		metricsServer := metrics.NewMetricServer("/metrics", "9090")
+		if token := os.Getenv(log.LevelTokenEnv); token != "" {
+			metricsServer.Handle(log.LevelHandlerPath, log.TokenLevelHandler(token))
+		}
 		err := metricsServer.Start(ctx)
 		if err != nil {
 			log.Info("metrics server return error: %v\n", err)
 		}
 	}()
 
-	go func() {
-		defer sentry.Flush(2 * time.Second)
-
-		err := apiServer.HTTPServer.ListenAndServe()
-		if err != nil {
-			if !errors.Is(err, http.ErrServerClosed) {
-				log.Error("http server error: %v", err)
-			} else {
-				log.Info("stopped serving new connections")
-			}
-		}
-	}()
-
-	log.Info("listening and serving...")
+	go apiServer.Serve()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 	<-sigChan
 	log.Info("received OS signal. Shutting down server...")
-	apiServer.HTTPServer.Shutdown(ctx)
-	log.Info("server stopped safely")
+	apiServer.Stop(context.WithoutCancel(ctx))
 	return nil
 }
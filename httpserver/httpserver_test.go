@@ -0,0 +1,118 @@
+package httpserver_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/httpserver"
+)
+
+func TestNewAPIServer_AppliesConfig(t *testing.T) {
+	server := httpserver.NewAPIServer(chi.NewRouter(), &httpserver.HTTPServerConfig{
+		Port:              8081,
+		GracefulShutdown:  5,
+		DrainDelay:        1,
+		DisableDrain:      true,
+		ReadTimeout:       10,
+		ReadHeaderTimeout: 2,
+		WriteTimeout:      20,
+		IdleTimeout:       60,
+		MaxHeaderBytes:    4096,
+	})
+
+	assert.Equal(t, ":8081", server.HTTPServer.Addr)
+	assert.Equal(t, 10*time.Second, server.HTTPServer.ReadTimeout)
+	assert.Equal(t, 2*time.Second, server.HTTPServer.ReadHeaderTimeout)
+	assert.Equal(t, 20*time.Second, server.HTTPServer.WriteTimeout)
+	assert.Equal(t, 60*time.Second, server.HTTPServer.IdleTimeout)
+	assert.Equal(t, 4096, server.HTTPServer.MaxHeaderBytes)
+	assert.Equal(t, 5*time.Second, server.GracefulShutdown)
+	assert.Equal(t, time.Second, server.DrainDelay)
+	assert.True(t, server.DisableDrain)
+
+	server = httpserver.NewAPIServer(chi.NewRouter(), &httpserver.HTTPServerConfig{})
+	assert.Equal(t, httpserver.DefaultGracefulShutdown, server.GracefulShutdown)
+}
+
+func TestAPIServer_StopFailsHealthCheck(t *testing.T) {
+	newServer := func() *httpserver.APIServer {
+		router := chi.NewRouter()
+		router.Get("/healthy", httpserver.GetHealthCheck)
+		return httpserver.NewAPIServer(router, &httpserver.HTTPServerConfig{DisableDrain: true})
+	}
+	healthCheck := func(server *httpserver.APIServer) int {
+		writer := httptest.NewRecorder()
+		server.HTTPServer.Handler.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, "/healthy", nil))
+		return writer.Code
+	}
+	stopped, running := newServer(), newServer()
+	assert.Equal(t, http.StatusOK, healthCheck(stopped))
+
+	require.NoError(t, stopped.Stop(context.Background()))
+	assert.Equal(t, http.StatusServiceUnavailable, healthCheck(stopped))
+	assert.Equal(t, http.StatusOK, healthCheck(running), "the health of each server is its own")
+
+	httpserver.SetHealthy(false)
+	defer httpserver.SetHealthy(true)
+	assert.Equal(t, http.StatusServiceUnavailable, healthCheck(running))
+}
+
+func TestAPIServer_StopDrainsByDefault(t *testing.T) {
+	server := httpserver.NewAPIServer(chi.NewRouter(), &httpserver.HTTPServerConfig{})
+	assert.Equal(t, time.Duration(0), server.DrainDelay)
+
+	// the drain is cut short by ctx, it would last DefaultDrainDelay otherwise
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	server.Stop(ctx)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestAPIServer_StopTimeout(t *testing.T) {
+	server := httpserver.NewAPIServer(chi.NewRouter(), &httpserver.HTTPServerConfig{})
+	assert.Equal(t, httpserver.DefaultDrainDelay+httpserver.DefaultGracefulShutdown, server.StopTimeout())
+
+	server = httpserver.NewAPIServer(chi.NewRouter(), &httpserver.HTTPServerConfig{GracefulShutdown: 5, DisableDrain: true})
+	assert.Equal(t, 5*time.Second, server.StopTimeout())
+}
+
+func TestAPIServer_StopWaitsForRequestsAfterDrain(t *testing.T) {
+	started := make(chan struct{})
+	router := chi.NewRouter()
+	router.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httpserver.NewAPIServer(router, &httpserver.HTTPServerConfig{DisableDrain: true})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.HTTPServer.Serve(listener)
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+
+	// ctx already ended, as when the drain used up the stop timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, server.Stop(ctx))
+	assert.Equal(t, http.StatusNoContent, <-status)
+}
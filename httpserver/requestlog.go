@@ -0,0 +1,86 @@
+package httpserver
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/ngtrvu/zen-go/log"
+)
+
+// RequestLogOptions controls the request log middleware.
+type RequestLogOptions struct {
+	// Streaming sends the request logs to the streaming writers (e.g. Cloud Logging) instead of stderr.
+	Streaming bool
+
+	// SkipPaths are not logged, e.g. HealthCheckPath.
+	SkipPaths []string
+}
+
+// DefaultRequestLogOptions logs every request but the health checks to stderr.
+func DefaultRequestLogOptions() *RequestLogOptions {
+	return &RequestLogOptions{SkipPaths: []string{HealthCheckPath}}
+}
+
+// RequestLog emits one structured line per request with the Cloud Logging httpRequest field,
+// at error level for 5xx responses and panics, warn for 4xx and info otherwise.
+func RequestLog(opts RequestLogOptions) func(next http.Handler) http.Handler {
+	skipPaths := make(map[string]struct{}, len(opts.SkipPaths))
+	for _, path := range opts.SkipPaths {
+		skipPaths[path] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := skipPaths[r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				status := ww.Status()
+				rvr := recover()
+				if rvr != nil {
+					status = http.StatusInternalServerError
+				}
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				logRequest(opts, r, status, int64(ww.BytesWritten()), time.Since(start))
+				if rvr != nil {
+					panic(rvr)
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+func logRequest(opts RequestLogOptions, r *http.Request, status int, size int64, latency time.Duration) {
+	logger := log.Module(log.ModuleHTTP)
+	if opts.Streaming {
+		logger = log.StreamingModule(log.ModuleHTTP)
+	}
+
+	fields := []log.Field{log.HTTPRequestField(log.NewHTTPRequest(r, status, size, latency))}
+	if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+		fields = append(fields, log.String("route", routeCtx.RoutePattern()))
+	}
+
+	logger = logger.Ctx(r.Context())
+	message := r.Method + " " + r.URL.Path
+	switch {
+	case status >= http.StatusInternalServerError:
+		logger.Error(nil, message, fields...)
+	case status >= http.StatusBadRequest:
+		logger.Warn(message, fields...)
+	default:
+		logger.Info(message, fields...)
+	}
+}
@@ -0,0 +1,84 @@
+package httpserver_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/correlation"
+	"github.com/ngtrvu/zen-go/httpserver"
+	"github.com/ngtrvu/zen-go/log"
+	"github.com/ngtrvu/zen-go/log/logtest"
+)
+
+func TestRequestLog_Streaming(t *testing.T) {
+	fake := logtest.NewCloudLogger()
+	writer, err := log.NewCloudLoggingWriter(context.Background(), "zen-project", log.CloudLoggingOptions{Logger: fake})
+	require.NoError(t, err)
+	initZeroLog(t, "info", writer)
+	fake.Reset()
+
+	router := httpserver.NewRouterWithOptions(httpserver.RouterOptions{
+		RequestIDEnabled: true,
+		RecoverEnabled:   true,
+		RequestLog:       &httpserver.RequestLogOptions{Streaming: true, SkipPaths: []string{httpserver.HealthCheckPath}},
+	})
+	router.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("missing"))
+	})
+	router.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("unexpected")
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	request.Header.Set(correlation.HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, httpserver.HealthCheckPath, nil))
+
+	entries := fake.Entries()
+	require.Len(t, entries, 2)
+
+	entry := entries[0]
+	assert.Equal(t, logging.Warning, entry.Severity)
+	assert.Equal(t, "projects/zen-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", entry.Trace)
+	require.NotNil(t, entry.HTTPRequest)
+	assert.Equal(t, "/orders/42", entry.HTTPRequest.Request.URL.Path)
+	assert.Equal(t, http.StatusNotFound, entry.HTTPRequest.Status)
+	assert.Equal(t, int64(len("missing")), entry.HTTPRequest.ResponseSize)
+	assert.GreaterOrEqual(t, entry.HTTPRequest.Latency, time.Millisecond)
+
+	assert.Equal(t, logging.Error, entries[1].Severity)
+	assert.Equal(t, http.StatusInternalServerError, entries[1].HTTPRequest.Status)
+}
+
+// initZeroLog runs InitZeroLog and restores the logging globals it changes after the test.
+func initZeroLog(t *testing.T, level string, writers ...io.Writer) {
+	defaultLevel := log.ModuleLevel(log.ModuleDefault)
+	levelFieldName, levelFieldMarshalFunc := zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc
+	timestampFieldName, timeFieldFormat := zerolog.TimestampFieldName, zerolog.TimeFieldFormat
+	errorStackMarshaler, callerSkipFrameCount, callerMarshalFunc := zerolog.ErrorStackMarshaler, zerolog.CallerSkipFrameCount, zerolog.CallerMarshalFunc
+	logger, gLogger := zlog.Logger, log.GLogger
+	t.Cleanup(func() {
+		// detaches the module loggers from writers
+		log.InitZeroLog(defaultLevel.String())
+		log.SetModuleLevel(log.ModuleDefault, defaultLevel)
+		zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc = levelFieldName, levelFieldMarshalFunc
+		zerolog.TimestampFieldName, zerolog.TimeFieldFormat = timestampFieldName, timeFieldFormat
+		zerolog.ErrorStackMarshaler, zerolog.CallerSkipFrameCount, zerolog.CallerMarshalFunc = errorStackMarshaler, callerSkipFrameCount, callerMarshalFunc
+		zlog.Logger, log.GLogger = logger, gLogger
+	})
+
+	log.InitZeroLog(level, writers...)
+}
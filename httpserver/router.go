@@ -0,0 +1,194 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	sentryhttp "github.com/getsentry/sentry-go/http"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/cors"
+	"github.com/ngtrvu/zen-go/correlation"
+	"github.com/ngtrvu/zen-go/log"
+
+	http_metrics "github.com/ngtrvu/zen-go/metrics/http"
+)
+
+const (
+	DefaultCORSMaxAge       = 300
+	DefaultCompressionLevel = 5
+	HealthCheckPath         = "/healthy"
+)
+
+// CORSOptions controls the CORS middleware.
+type CORSOptions struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           int
+}
+
+// RouterOptions controls the middleware stack installed by NewRouterWithOptions.
+// The zero value installs no middleware, start from DefaultRouterOptions to keep the usual stack.
+type RouterOptions struct {
+	AppName string
+
+	// CORS is disabled when nil.
+	CORS *CORSOptions
+
+	SentryEnabled  bool
+	MetricsEnabled bool
+	RealIPEnabled  bool
+	RecoverEnabled bool
+
+	// RequestIDEnabled accepts or generates X-Request-ID and traceparent, see correlation.Middleware.
+	RequestIDEnabled bool
+
+	// RequestLog logs one line per request when set, see RequestLog.
+	RequestLog *RequestLogOptions
+
+	// CompressionLevel enables gzip/deflate responses when greater than 0.
+	CompressionLevel int
+	// CompressionTypes restricts compressed content types, chi defaults are used when empty.
+	CompressionTypes []string
+
+	// MaxBodyBytes rejects request bodies larger than this, 0 means no limit.
+	MaxBodyBytes int64
+}
+
+// DefaultCORSOptions allows any http(s) origin without credentials.
+func DefaultCORSOptions() *CORSOptions {
+	return &CORSOptions{
+		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", correlation.HeaderRequestID, correlation.HeaderTraceParent},
+		ExposedHeaders:   []string{"Link", correlation.HeaderRequestID},
+		AllowCredentials: false,
+		MaxAge:           DefaultCORSMaxAge,
+	}
+}
+
+// DefaultRouterOptions returns the stack NewRouter installs: open CORS, sentry, metrics, RealIP and request id.
+func DefaultRouterOptions(appName string) RouterOptions {
+	return RouterOptions{
+		AppName:          appName,
+		CORS:             DefaultCORSOptions(),
+		SentryEnabled:    true,
+		MetricsEnabled:   true,
+		RealIPEnabled:    true,
+		RequestIDEnabled: true,
+	}
+}
+
+func NewRouterWithOptions(opts RouterOptions) *chi.Mux {
+	router := chi.NewRouter()
+
+	// recover first so panics in other middlewares are caught too
+	if opts.RecoverEnabled {
+		router.Use(Recoverer)
+	}
+
+	if opts.RequestIDEnabled {
+		router.Use(correlation.Middleware)
+	}
+
+	// after the request id so the request log carries it
+	if opts.RequestLog != nil {
+		router.Use(RequestLog(*opts.RequestLog))
+	}
+
+	if opts.CORS != nil {
+		router.Use(cors.Handler(cors.Options{
+			AllowedOrigins:   opts.CORS.AllowedOrigins,
+			AllowedMethods:   opts.CORS.AllowedMethods,
+			AllowedHeaders:   opts.CORS.AllowedHeaders,
+			ExposedHeaders:   opts.CORS.ExposedHeaders,
+			AllowCredentials: opts.CORS.AllowCredentials,
+			MaxAge:           opts.CORS.MaxAge,
+		}))
+	}
+
+	if opts.SentryEnabled {
+		sentryMiddleware := sentryhttp.New(sentryhttp.Options{
+			Repanic: true,
+		})
+		router.Use(sentryMiddleware.Handle)
+	}
+
+	if opts.MetricsEnabled {
+		httpMetricsObserver := http_metrics.NewHTTPMetrics(opts.AppName)
+		router.Use(http_metrics.InboundMetricsMiddleware(httpMetricsObserver))
+	}
+
+	if opts.RealIPEnabled {
+		router.Use(middleware.RealIP)
+	}
+
+	if opts.CompressionLevel > 0 {
+		router.Use(middleware.Compress(opts.CompressionLevel, opts.CompressionTypes...))
+	}
+
+	if opts.MaxBodyBytes > 0 {
+		router.Use(MaxBodySize(opts.MaxBodyBytes))
+	}
+
+	router.Get(HealthCheckPath, GetHealthCheck)
+
+	return router
+}
+
+// MaxBodySize limits the request body, reading past the limit fails with *http.MaxBytesError.
+// Requests declaring a larger Content-Length are rejected upfront with 413.
+func MaxBodySize(maxBytes int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, "request_too_large", "request body too large")
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Recoverer turns panics into a 500 response and logs the stack trace.
+func Recoverer(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				if rvr == http.ErrAbortHandler {
+					panic(rvr)
+				}
+
+				log.Module(log.ModuleHTTP).Ctx(r.Context()).Error(fmt.Errorf("%v", rvr), "panic recovered",
+					log.String("method", r.Method),
+					log.String("path", r.URL.Path),
+					log.String("stack", string(debug.Stack())),
+				)
+				writeJSONError(w, http.StatusInternalServerError, "internal_server_error", "internal server error")
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// writeJSONError writes a body compatible with zen.Response without importing zen.
+func writeJSONError(w http.ResponseWriter, statusCode int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    false,
+		"error":      message,
+		"error_code": code,
+	})
+}
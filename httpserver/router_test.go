@@ -0,0 +1,68 @@
+package httpserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ngtrvu/zen-go/httpserver"
+)
+
+func TestNewRouterWithOptions_CORS(t *testing.T) {
+	router := httpserver.NewRouterWithOptions(httpserver.RouterOptions{
+		CORS: &httpserver.CORSOptions{
+			AllowedOrigins:   []string{"https://app.stag.vn"},
+			AllowedMethods:   []string{http.MethodGet},
+			AllowCredentials: true,
+		},
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/healthy", nil)
+	request.Header.Set("Origin", "https://app.stag.vn")
+	writer := httptest.NewRecorder()
+	router.ServeHTTP(writer, request)
+	assert.Equal(t, "https://app.stag.vn", writer.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", writer.Header().Get("Access-Control-Allow-Credentials"))
+
+	request = httptest.NewRequest(http.MethodGet, "/healthy", nil)
+	request.Header.Set("Origin", "https://evil.example.com")
+	writer = httptest.NewRecorder()
+	router.ServeHTTP(writer, request)
+	assert.Equal(t, "", writer.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestNewRouterWithOptions_MaxBodyBytes(t *testing.T) {
+	router := httpserver.NewRouterWithOptions(httpserver.RouterOptions{MaxBodyBytes: 8})
+	router.Post("/echo", func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	writer := httptest.NewRecorder()
+	router.ServeHTTP(writer, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("small")))
+	assert.Equal(t, http.StatusOK, writer.Code)
+
+	writer = httptest.NewRecorder()
+	router.ServeHTTP(writer, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("this body is too large")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, writer.Code)
+}
+
+func TestNewRouterWithOptions_Recover(t *testing.T) {
+	router := httpserver.NewRouterWithOptions(httpserver.RouterOptions{RecoverEnabled: true})
+	router.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("unexpected")
+	})
+
+	writer := httptest.NewRecorder()
+	router.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, writer.Code)
+	assert.Contains(t, writer.Body.String(), "internal_server_error")
+}
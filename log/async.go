@@ -0,0 +1,273 @@
+package log
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+
+	"github.com/ngtrvu/zen-go/metrics"
+)
+
+const (
+	DefaultAsyncQueueSize     = 1024
+	DefaultAsyncFlushInterval = time.Second
+
+	LabelWriter = "writer"
+)
+
+var ErrAsyncWriterClosed = errors.New("async log writer is closed")
+
+// OverflowPolicy decides what happens to a write when the queue of an AsyncWriter is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDrop drops the entry and counts it in the log_async_dropped_total metric.
+	OverflowDrop OverflowPolicy = iota
+
+	// OverflowBlock waits for room in the queue, up to BlockTimeout when set.
+	OverflowBlock
+)
+
+// AsyncWriterOptions configures NewAsyncWriter, zero values use the defaults.
+type AsyncWriterOptions struct {
+	// Name labels the metrics of the writer, "async" by default.
+	Name string
+
+	// QueueSize is the number of entries buffered, DefaultAsyncQueueSize by default.
+	QueueSize int
+
+	Policy OverflowPolicy
+
+	// BlockTimeout drops the entry after waiting that long with OverflowBlock, 0 waits forever.
+	BlockTimeout time.Duration
+
+	// FlushInterval flushes the underlying writer periodically when it has a Flush() error
+	// or Sync() error method, DefaultAsyncFlushInterval by default.
+	FlushInterval time.Duration
+}
+
+// AsyncWriter writes to an underlying writer from a background goroutine so logging never waits
+// on slow writers like files or network clients. Entries keep their level for zerolog.LevelWriter.
+type AsyncWriter struct {
+	writer  io.Writer
+	opts    AsyncWriterOptions
+	queue   chan asyncEntry
+	flushes chan chan error
+	done    chan struct{}
+	dropped *metrics.Counter
+
+	mu       sync.RWMutex
+	closed   bool
+	closeErr error
+
+	// writeErr is the last error of the underlying writer
+	writeErr     atomic.Pointer[error]
+	droppedCount atomic.Uint64
+}
+
+type asyncEntry struct {
+	level    zerolog.Level
+	hasLevel bool
+	data     []byte
+}
+
+func NewAsyncWriter(w io.Writer, opts AsyncWriterOptions) *AsyncWriter {
+	if opts.Name == "" {
+		opts.Name = "async"
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultAsyncQueueSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultAsyncFlushInterval
+	}
+
+	writer := &AsyncWriter{
+		writer:  w,
+		opts:    opts,
+		queue:   make(chan asyncEntry, opts.QueueSize),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+		dropped: asyncDroppedCounter().With(LabelWriter, opts.Name),
+	}
+	go writer.run()
+
+	return writer
+}
+
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	return w.enqueue(asyncEntry{data: p})
+}
+
+func (w *AsyncWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	return w.enqueue(asyncEntry{level: level, hasLevel: true, data: p})
+}
+
+// Flush writes the queued entries and flushes the underlying writer.
+func (w *AsyncWriter) Flush() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return w.closeErr
+	}
+
+	reply := make(chan error, 1)
+	w.flushes <- reply
+	return <-reply
+}
+
+// Close writes the queued entries, flushes the underlying writer and stops the background goroutine.
+// The underlying writer is not closed. Writes after Close fail with ErrAsyncWriterClosed.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return w.closeErr
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+
+	<-w.done
+
+	// run has finished, closeErr is only read after closed is set
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closeErr = errors.Join(w.lastWriteErr(), flushWriter(w.writer))
+	return w.closeErr
+}
+
+// Dropped is the number of entries dropped by this writer.
+func (w *AsyncWriter) Dropped() uint64 {
+	return w.droppedCount.Load()
+}
+
+func (w *AsyncWriter) enqueue(entry asyncEntry) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return 0, ErrAsyncWriterClosed
+	}
+
+	// zerolog reuses p once Write returns
+	entry.data = append([]byte(nil), entry.data...)
+
+	select {
+	case w.queue <- entry:
+		return len(entry.data), nil
+	default:
+	}
+
+	if w.opts.Policy == OverflowBlock {
+		if w.opts.BlockTimeout <= 0 {
+			w.queue <- entry
+			return len(entry.data), nil
+		}
+
+		timer := time.NewTimer(w.opts.BlockTimeout)
+		defer timer.Stop()
+		select {
+		case w.queue <- entry:
+			return len(entry.data), nil
+		case <-timer.C:
+		}
+	}
+
+	// the entry is lost but zerolog must not report an error for each dropped line
+	w.dropped.Inc()
+	w.droppedCount.Add(1)
+	return len(entry.data), nil
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry, ok := <-w.queue:
+			if !ok {
+				return
+			}
+			w.write(entry)
+		case reply := <-w.flushes:
+			w.drain()
+			reply <- errors.Join(w.lastWriteErr(), flushWriter(w.writer))
+		case <-ticker.C:
+			flushWriter(w.writer)
+		}
+	}
+}
+
+// drain writes the entries queued so far.
+func (w *AsyncWriter) drain() {
+	for {
+		select {
+		case entry, ok := <-w.queue:
+			if !ok {
+				return
+			}
+			w.write(entry)
+		default:
+			return
+		}
+	}
+}
+
+func (w *AsyncWriter) write(entry asyncEntry) {
+	var err error
+	if levelWriter, ok := w.writer.(zerolog.LevelWriter); ok && entry.hasLevel {
+		_, err = levelWriter.WriteLevel(entry.level, entry.data)
+	} else {
+		_, err = w.writer.Write(entry.data)
+	}
+	if err != nil {
+		w.writeErr.Store(&err)
+	}
+}
+
+func (w *AsyncWriter) lastWriteErr() error {
+	if err := w.writeErr.Swap(nil); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// flushWriter flushes buffered writers like the Cloud Logging writer and syncs files.
+func flushWriter(w io.Writer) error {
+	switch writer := w.(type) {
+	case interface{ Flush() error }:
+		return writer.Flush()
+	case interface{ Sync() error }:
+		// stderr and pipes cannot be synced
+		if err := writer.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTSUP) {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	asyncDroppedCounterOnce sync.Once
+	asyncDropped            *metrics.Counter
+)
+
+func asyncDroppedCounter() *metrics.Counter {
+	asyncDroppedCounterOnce.Do(func() {
+		asyncDropped = metrics.NewCounterFrom(prometheus.CounterOpts{
+			Name: "log_async_dropped_total",
+			Help: "number of log entries dropped because the async writer queue was full",
+		}, []string{LabelWriter})
+	})
+	return asyncDropped
+}
@@ -0,0 +1,137 @@
+package log_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/log"
+)
+
+// slowWriter records writes after waiting on release, it implements zerolog.LevelWriter.
+type slowWriter struct {
+	release chan struct{}
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	levels  []zerolog.Level
+	flushes int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *slowWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if w.release != nil {
+		<-w.release
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.levels = append(w.levels, level)
+	return w.buf.Write(p)
+}
+
+func (w *slowWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushes++
+	return nil
+}
+
+func (w *slowWriter) lines() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.Split(strings.TrimSpace(w.buf.String()), "\n")
+}
+
+func TestAsyncWriter_CloseDrains(t *testing.T) {
+	underlying := &slowWriter{}
+	writer := log.NewAsyncWriter(underlying, log.AsyncWriterOptions{QueueSize: 100, Policy: log.OverflowBlock})
+	logger := zerolog.New(writer)
+
+	for i := 0; i < 50; i++ {
+		logger.Warn().Int("i", i).Msg("queued")
+	}
+	require.NoError(t, writer.Close())
+
+	assert.Len(t, underlying.lines(), 50)
+	assert.Equal(t, zerolog.WarnLevel, underlying.levels[0])
+	assert.Equal(t, uint64(0), writer.Dropped())
+	assert.Positive(t, underlying.flushes)
+
+	_, err := writer.Write([]byte("late\n"))
+	assert.ErrorIs(t, err, log.ErrAsyncWriterClosed)
+	assert.NoError(t, writer.Close())
+}
+
+func TestAsyncWriter_DropPolicy(t *testing.T) {
+	underlying := &slowWriter{release: make(chan struct{})}
+	writer := log.NewAsyncWriter(underlying, log.AsyncWriterOptions{Name: "drop_test", QueueSize: 2})
+
+	// the first write is picked up by the background goroutine and blocks there
+	for i := 0; i < 10; i++ {
+		_, err := writer.Write([]byte("line\n"))
+		require.NoError(t, err)
+	}
+	close(underlying.release)
+	require.NoError(t, writer.Close())
+
+	assert.GreaterOrEqual(t, writer.Dropped(), uint64(7))
+	assert.Equal(t, 10, len(underlying.lines())+int(writer.Dropped()))
+}
+
+func TestAsyncWriter_BlockTimeout(t *testing.T) {
+	underlying := &slowWriter{release: make(chan struct{})}
+	writer := log.NewAsyncWriter(underlying, log.AsyncWriterOptions{
+		QueueSize:    1,
+		Policy:       log.OverflowBlock,
+		BlockTimeout: 10 * time.Millisecond,
+	})
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		writer.Write([]byte("line\n"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	assert.Positive(t, writer.Dropped())
+
+	close(underlying.release)
+	require.NoError(t, writer.Close())
+}
+
+func TestAsyncWriter_Flush(t *testing.T) {
+	underlying := &slowWriter{}
+	writer := log.NewAsyncWriter(underlying, log.AsyncWriterOptions{FlushInterval: time.Hour})
+	defer writer.Close()
+
+	writer.Write([]byte("first\n"))
+	require.NoError(t, writer.Flush())
+	assert.Equal(t, []string{"first"}, underlying.lines())
+	assert.Equal(t, 1, underlying.flushes)
+}
+
+func TestInitZeroLog_ClosesPreviousAsyncWriters(t *testing.T) {
+	first, second := &slowWriter{}, &slowWriter{}
+	initZeroLogWithOptions(t, log.ZeroLogOptions{Level: "info", Writers: []io.Writer{first}, Async: &log.AsyncWriterOptions{}})
+	t.Cleanup(func() { log.Close() })
+	log.GLogger.Info().Msg("first")
+
+	initZeroLogWithOptions(t, log.ZeroLogOptions{Level: "info", Writers: []io.Writer{second}, Async: &log.AsyncWriterOptions{}})
+	lines := first.lines()
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"message":"first"`)
+	assert.Equal(t, 1, first.flushes)
+
+	log.Flush()
+	assert.Equal(t, 1, first.flushes, "the closed writer is not flushed again")
+	assert.Equal(t, 1, second.flushes)
+}
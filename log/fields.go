@@ -0,0 +1,94 @@
+package log
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	FieldUserID  = "user_id"
+	FieldOrderID = "order_id"
+	FieldError   = "error"
+)
+
+// Field is a structured key/value attached to a log line.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Any accepts any value, zerolog decides how to marshal it.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err attaches an error under the "error" key without a stack trace, use FieldLogger.Error for that.
+func Err(err error) Field {
+	return Field{Key: FieldError, Value: err}
+}
+
+func UserID(value interface{}) Field {
+	return Field{Key: FieldUserID, Value: value}
+}
+
+func OrderID(value interface{}) Field {
+	return Field{Key: FieldOrderID, Value: value}
+}
+
+// fieldsToSlice converts fields to the key/value slice accepted by zerolog, keeping their order.
+func fieldsToSlice(fields []Field) []interface{} {
+	values := make([]interface{}, 0, len(fields)*2)
+	for _, field := range fields {
+		values = append(values, field.Key, field.Value)
+	}
+	return values
+}
+
+type ctxFieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying fields, every logger from Ctx(ctx) includes them.
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing := FieldsFromContext(ctx)
+	merged := make([]Field, 0, len(existing)+len(fields))
+	merged = append(merged, existing...)
+	merged = append(merged, fields...)
+
+	return context.WithValue(ctx, ctxFieldsKey{}, merged)
+}
+
+// FieldsFromContext returns the fields stored by ContextWithFields.
+func FieldsFromContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(ctxFieldsKey{}).([]Field)
+	return fields
+}
@@ -3,19 +3,34 @@ package log
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"cloud.google.com/go/logging"
+	"cloud.google.com/go/logging/apiv2/loggingpb"
 	"github.com/rs/zerolog"
 	"google.golang.org/api/option"
+
+	"github.com/ngtrvu/zen-go/correlation"
 )
 
 var GLogger zerolog.Logger
 
+// CloudLogger is the part of *logging.Logger used by the writer, logtest.CloudLogger is a fake for tests.
+type CloudLogger interface {
+	Log(entry logging.Entry)
+	Flush() error
+}
+
 type cloudLoggingWriter struct {
 	ctx                context.Context
+	projectID          string
 	firstBlockingWrite sync.Once
-	logger             *logging.Logger
+	logger             CloudLogger
 	severityMap        map[zerolog.Level]logging.Severity
 
 	zerolog.LevelWriter
@@ -34,9 +49,12 @@ var DefaultSeverityMap = map[zerolog.Level]logging.Severity{
 // secretly, we keep tabs of all loggers
 var loggersWeMade = make([]*logging.Logger, 0, 1)
 
+// and of the async writers created by InitZeroLogWithOptions
+var asyncWritersWeMade []*AsyncWriter
+
 func (c *cloudLoggingWriter) Write(p []byte) (int, error) {
 	// writing to stackdriver without levels? o-okay...
-	entry := logging.Entry{Payload: json.RawMessage(p)}
+	entry := c.entry(p)
 	c.logger.Log(entry)
 	var err error
 	c.firstBlockingWrite.Do(func() {
@@ -48,11 +66,14 @@ func (c *cloudLoggingWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// Flush blocks until the buffered entries are sent.
+func (c *cloudLoggingWriter) Flush() error {
+	return c.logger.Flush()
+}
+
 func (c *cloudLoggingWriter) WriteLevel(level zerolog.Level, payload []byte) (int, error) {
-	entry := logging.Entry{
-		Severity: c.severityMap[level],
-		Payload:  json.RawMessage(payload),
-	}
+	entry := c.entry(payload)
+	entry.Severity = c.severityMap[level]
 	c.logger.Log(entry)
 	var err error
 	c.firstBlockingWrite.Do(func() {
@@ -71,6 +92,93 @@ func (c *cloudLoggingWriter) WriteLevel(level zerolog.Level, payload []byte) (in
 	return len(payload), nil
 }
 
+// entry keeps payload as is and fills the trace, span, request, labels and source location
+// from the event fields so Cloud Logging groups the entries by request and links them to traces.
+func (c *cloudLoggingWriter) entry(payload []byte) logging.Entry {
+	entry := logging.Entry{Payload: json.RawMessage(payload)}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return entry
+	}
+
+	if timestamp := rawString(fields[zerolog.TimestampFieldName]); timestamp != "" {
+		entry.Timestamp, _ = time.Parse(zerolog.TimeFieldFormat, timestamp)
+	}
+
+	if traceID := rawString(fields[correlation.FieldTraceID]); traceID != "" {
+		entry.Trace = fmt.Sprintf("projects/%s/traces/%s", c.projectID, traceID)
+		entry.SpanID = rawString(fields[correlation.FieldSpanID])
+		entry.TraceSampled = string(fields[correlation.FieldTraceSampled]) == "true"
+	}
+
+	if raw, ok := fields[FieldHTTPRequest]; ok {
+		var req HTTPRequest
+		if json.Unmarshal(raw, &req) == nil {
+			entry.HTTPRequest = req.cloudLogging()
+		}
+	}
+
+	if raw, ok := fields[FieldLabels]; ok {
+		var labels map[string]interface{}
+		if json.Unmarshal(raw, &labels) == nil && len(labels) > 0 {
+			entry.Labels = make(map[string]string, len(labels))
+			for key, value := range labels {
+				entry.Labels[key] = fmt.Sprint(value)
+			}
+		}
+	}
+
+	if caller := rawString(fields[zerolog.CallerFieldName]); caller != "" {
+		entry.SourceLocation = sourceLocation(caller)
+	}
+
+	return entry
+}
+
+func (req HTTPRequest) cloudLogging() *logging.HTTPRequest {
+	request, err := http.NewRequest(req.RequestMethod, req.RequestURL, nil)
+	if err != nil {
+		return nil
+	}
+	request.Proto = req.Protocol
+	if req.UserAgent != "" {
+		request.Header.Set("User-Agent", req.UserAgent)
+	}
+	if req.Referer != "" {
+		request.Header.Set("Referer", req.Referer)
+	}
+
+	return &logging.HTTPRequest{
+		Request:      request,
+		RequestSize:  req.RequestSize,
+		Status:       req.Status,
+		ResponseSize: req.ResponseSize,
+		Latency:      req.LatencyDuration(),
+		RemoteIP:     req.RemoteIP,
+	}
+}
+
+// sourceLocation parses the "file.go:12" caller field.
+func sourceLocation(caller string) *loggingpb.LogEntrySourceLocation {
+	location := &loggingpb.LogEntrySourceLocation{File: caller}
+	if idx := strings.LastIndexByte(caller, ':'); idx >= 0 {
+		if line, err := strconv.ParseInt(caller[idx+1:], 10, 64); err == nil {
+			location.File = caller[:idx]
+			location.Line = line
+		}
+	}
+	return location
+}
+
+func rawString(raw json.RawMessage) string {
+	var value string
+	if json.Unmarshal(raw, &value) != nil {
+		return ""
+	}
+	return value
+}
+
 // CloudLoggingOptions specifies some optional configuration.
 type CloudLoggingOptions struct {
 	// Specify this to override DefaultSeverityMap.
@@ -82,8 +190,9 @@ type CloudLoggingOptions struct {
 	// Used during *logging.Client construction.
 	ClientOnError func(error)
 
-	// Specify this to override the default of constructing a *logging.Logger on the caller's behalf.
-	Logger *logging.Logger
+	// Specify this to override the default of constructing a *logging.Logger on the caller's behalf,
+	// e.g. with logtest.CloudLogger in tests.
+	Logger CloudLogger
 
 	// Used during GCP Logger construction.
 	LoggerOptions []logging.LoggerOption
@@ -106,8 +215,9 @@ func NewCloudLoggingWriter(
 			client.OnError = opts.ClientOnError
 		}
 		logId := "zerolog-cloud-logging"
-		logger = client.Logger(logId, opts.LoggerOptions...)
-		loggersWeMade = append(loggersWeMade, logger)
+		cloudLogger := client.Logger(logId, opts.LoggerOptions...)
+		loggersWeMade = append(loggersWeMade, cloudLogger)
+		logger = cloudLogger
 	}
 	severityMap := opts.SeverityMap
 	if severityMap == nil {
@@ -115,6 +225,7 @@ func NewCloudLoggingWriter(
 	}
 	writer = &cloudLoggingWriter{
 		ctx:         ctx,
+		projectID:   projectID,
 		logger:      logger,
 		severityMap: severityMap,
 	}
@@ -124,6 +235,11 @@ func NewCloudLoggingWriter(
 // Flush blocks while flushing all loggers this module created.
 func Flush() []error {
 	var errs []error
+	for _, writer := range asyncWritersWeMade {
+		if err := writer.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	for _, logger := range loggersWeMade {
 		if logger != nil {
 			if err := logger.Flush(); err != nil {
@@ -133,3 +249,21 @@ func Flush() []error {
 	}
 	return errs
 }
+
+// Close drains and stops the async writers created by InitZeroLogWithOptions, then flushes the loggers.
+// Logs written to the streaming writers afterwards are lost.
+func Close() []error {
+	errs := closeAsyncWriters(asyncWritersWeMade)
+	asyncWritersWeMade = nil
+	return append(errs, Flush()...)
+}
+
+func closeAsyncWriters(writers []*AsyncWriter) []error {
+	var errs []error
+	for _, writer := range writers {
+		if err := writer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,94 @@
+package log_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/correlation"
+	"github.com/ngtrvu/zen-go/log"
+	"github.com/ngtrvu/zen-go/log/logtest"
+)
+
+func TestCloudLoggingWriter_Entry(t *testing.T) {
+	fake := logtest.NewCloudLogger()
+	writer, err := log.NewCloudLoggingWriter(context.Background(), "zen-project", log.CloudLoggingOptions{Logger: fake})
+	require.NoError(t, err)
+
+	ids := correlation.IDs{RequestID: "req-1", TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	ctx := correlation.NewContext(context.Background(), ids)
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	request, _ := http.NewRequest(http.MethodPost, "https://api.stag.vn/orders?page=2", nil)
+	request.Header.Set("User-Agent", "zen-test")
+	request.RemoteAddr = "10.0.0.1:5123"
+
+	logger := zerolog.New(writer).Hook(log.CorrelationHook{})
+	logger.Warn().Ctx(ctx).
+		Time(zerolog.TimestampFieldName, timestamp).
+		Str(zerolog.CallerFieldName, "order.go:42").
+		Interface(log.FieldHTTPRequest, log.NewHTTPRequest(request, http.StatusNotFound, 18, 1500*time.Millisecond)).
+		Interface(log.FieldLabels, map[string]interface{}{"service": "order", "shard": 3}).
+		Msg("order not found")
+
+	entries := fake.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1, fake.Flushes())
+
+	entry := entries[0]
+	assert.Equal(t, logging.Warning, entry.Severity)
+	assert.Equal(t, timestamp, entry.Timestamp.UTC())
+	assert.Equal(t, "projects/zen-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", entry.Trace)
+	assert.Equal(t, "00f067aa0ba902b7", entry.SpanID)
+	assert.True(t, entry.TraceSampled)
+	assert.Equal(t, map[string]string{"service": "order", "shard": "3"}, entry.Labels)
+	assert.Equal(t, "order.go", entry.SourceLocation.GetFile())
+	assert.Equal(t, int64(42), entry.SourceLocation.GetLine())
+
+	require.NotNil(t, entry.HTTPRequest)
+	assert.Equal(t, http.MethodPost, entry.HTTPRequest.Request.Method)
+	assert.Equal(t, "https://api.stag.vn/orders?page=2", entry.HTTPRequest.Request.URL.String())
+	assert.Equal(t, "zen-test", entry.HTTPRequest.Request.UserAgent())
+	assert.Equal(t, http.StatusNotFound, entry.HTTPRequest.Status)
+	assert.Equal(t, int64(18), entry.HTTPRequest.ResponseSize)
+	assert.Equal(t, 1500*time.Millisecond, entry.HTTPRequest.Latency)
+	assert.Equal(t, "10.0.0.1", entry.HTTPRequest.RemoteIP)
+	assert.Contains(t, string(entry.Payload.(json.RawMessage)), "order not found")
+}
+
+func TestStreamingModule_SourceLocation(t *testing.T) {
+	fake := logtest.NewCloudLogger()
+	writer, err := log.NewCloudLoggingWriter(context.Background(), "zen-project", log.CloudLoggingOptions{Logger: fake})
+	require.NoError(t, err)
+	initZeroLogWithOptions(t, log.ZeroLogOptions{Level: "info", Writers: []io.Writer{writer}})
+	fake.Reset()
+
+	log.StreamingModule(log.ModuleQueue).Info("task done")
+
+	entries := fake.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "gcp_test.go", entries[0].SourceLocation.GetFile())
+	assert.Positive(t, entries[0].SourceLocation.GetLine())
+}
+
+func TestCloudLoggingWriter_PlainPayload(t *testing.T) {
+	fake := logtest.NewCloudLogger()
+	writer, err := log.NewCloudLoggingWriter(context.Background(), "zen-project", log.CloudLoggingOptions{Logger: fake})
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte("not json"))
+	require.NoError(t, err)
+
+	entries := fake.Entries()
+	require.Len(t, entries, 1)
+	assert.Empty(t, entries[0].Trace)
+	assert.Nil(t, entries[0].HTTPRequest)
+}
@@ -3,87 +3,279 @@ package log
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
-	"gorm.io/gorm/utils"
+
+	"github.com/ngtrvu/zen-go/metrics"
+	"github.com/ngtrvu/zen-go/redact"
 )
 
+const (
+	DefaultSlowThreshold = 500 * time.Millisecond
+
+	LabelOperation = "operation"
+)
+
+// GormLoggerOptions configures NewGormLoggerWithOptions, zero values use the defaults.
+type GormLoggerOptions struct {
+	// Level of the gorm module, "info" by default: errors and slow queries are logged, every
+	// query is logged at "debug". It can be changed at runtime, see OverrideLevel.
+	Level string
+
+	// SlowThreshold logs queries slower than it as warnings, DefaultSlowThreshold when 0, disabled when negative.
+	SlowThreshold time.Duration
+
+	// ParameterizedQueries logs the SQL with placeholders instead of the query parameters.
+	ParameterizedQueries bool
+
+	// SampleEvery logs 1 in SampleEvery normal queries, errors and slow queries are always logged.
+	SampleEvery uint32
+
+	// Writer receives the log lines, os.Stderr by default.
+	Writer io.Writer
+}
+
 type logger struct {
 	SlowThreshold         time.Duration
 	SourceField           string
 	SkipErrRecordNotFound bool
+	ParameterizedQueries  bool
 	Logger                zerolog.Logger
+
+	// Redactor masks sensitive values in the traced SQL, nil logs the SQL as is.
+	Redactor *redact.Redactor
+
+	// Sampler samples normal queries, nil logs all of them.
+	Sampler zerolog.Sampler
+
+	// mode is set by LogMode, e.g. db.Debug(), otherwise the level follows the gorm module level.
+	mode *gormlogger.LogLevel
 }
 
 func NewGormLogger(logLevel string) *logger {
-	zeroLogger := zerolog.New(os.Stderr).With().Timestamp().Logger()
+	return NewGormLoggerWithOptions(GormLoggerOptions{Level: logLevel})
+}
+
+func NewGormLoggerWithOptions(opts GormLoggerOptions) *logger {
+	writer := opts.Writer
+	if writer == nil {
+		writer = os.Stderr
+	}
+	zeroLogger := zerolog.New(writer).With().Timestamp().Logger().Hook(CorrelationHook{}).Hook(LevelHook{Module: ModuleGorm})
 
-	// set zerologger level
-	level, _ := zerolog.ParseLevel(logLevel)
-	zeroLogger = zeroLogger.Level(level)
+	// the level is kept per module so it can be changed at runtime, see OverrideLevel
+	level, err := zerolog.ParseLevel(opts.Level)
+	if err != nil || opts.Level == "" {
+		level = zerolog.InfoLevel
+	}
+	SetModuleLevel(ModuleGorm, level)
 
-	return &logger{
+	slowThreshold := opts.SlowThreshold
+	switch {
+	case slowThreshold == 0:
+		slowThreshold = DefaultSlowThreshold
+	case slowThreshold < 0:
+		slowThreshold = 0
+	}
+
+	l := &logger{
 		Logger:                zeroLogger,
+		SourceField:           zerolog.CallerFieldName,
 		SkipErrRecordNotFound: true,
-		SlowThreshold:         time.Millisecond * 500, // 0.5s consider as slow, should be warning
+		SlowThreshold:         slowThreshold,
+		ParameterizedQueries:  opts.ParameterizedQueries,
+		Redactor:              redact.Default(),
 	}
+	if opts.SampleEvery > 1 {
+		l.Sampler = &zerolog.BasicSampler{N: opts.SampleEvery}
+	}
+	return l
 }
 
 func NewWithGormLogger(l zerolog.Logger, config gormlogger.Config) *logger {
-	return &logger{
-		Logger:                l,
+	gormLogger := &logger{
+		Logger:                l.Hook(LevelHook{Module: ModuleGorm}),
+		SourceField:           zerolog.CallerFieldName,
 		SkipErrRecordNotFound: config.IgnoreRecordNotFoundError,
 		SlowThreshold:         config.SlowThreshold,
+		ParameterizedQueries:  config.ParameterizedQueries,
+		Redactor:              redact.Default(),
 	}
+	if config.LogLevel != 0 {
+		gormLogger.mode = &config.LogLevel
+	}
+	return gormLogger
 }
 
-func (l *logger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
-	return l
+// LogMode returns a copy logging at the gorm level, it is used by gorm for sessions like db.Debug().
+// The lines of a copy are written whatever the module and global levels, gormlogger.Info logs every
+// query at debug level.
+func (l *logger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *l
+	clone.mode = &level
+	return &clone
+}
+
+// ParamsFilter drops the query parameters from the traced SQL when ParameterizedQueries is set.
+func (l *logger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.ParameterizedQueries {
+		return sql, nil
+	}
+	return sql, params
 }
 
 func (l *logger) Info(ctx context.Context, s string, args ...interface{}) {
-	l.Logger.Info().Msgf(s, args...)
+	if l.logLevel() >= gormlogger.Info {
+		l.event(zerolog.InfoLevel).Ctx(ctx).Msgf(s, args...)
+	}
 }
 
 func (l *logger) Warn(ctx context.Context, s string, args ...interface{}) {
-	l.Logger.Warn().Msgf(s, args...)
+	if l.logLevel() >= gormlogger.Warn {
+		l.event(zerolog.WarnLevel).Ctx(ctx).Msgf(s, args...)
+	}
 }
 
 func (l *logger) Error(ctx context.Context, s string, args ...interface{}) {
-	l.Logger.Error().Msgf(s, args...)
+	if l.logLevel() >= gormlogger.Error {
+		l.event(zerolog.ErrorLevel).Ctx(ctx).Msgf(s, args...)
+	}
 }
 
 func (l *logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
 	elapsed := time.Since(begin)
-	sql, _ := fc()
-	fields := map[string]interface{}{
-		"sql":      sql,
-		"duration": elapsed,
+	slow := l.SlowThreshold > 0 && elapsed > l.SlowThreshold
+	if slow {
+		sql, _ := fc()
+		slowQueryCounter().With(LabelOperation, sqlOperation(sql)).Inc()
 	}
 
-	if l.SourceField != "" {
-		fields[l.SourceField] = utils.FileWithLineNum()
+	logLevel := l.logLevel()
+	if logLevel <= gormlogger.Silent {
+		return
 	}
 
 	// log warning if the error is "context canceled"
 	if err != nil && errors.Is(err, context.Canceled) {
-		l.Logger.Warn().Fields(fields).Msgf("[GORM] context canceled")
+		if logLevel >= gormlogger.Warn {
+			l.event(zerolog.WarnLevel).Ctx(ctx).Fields(l.traceFields(elapsed, fc)).Msgf("[GORM] context canceled")
+		}
 		return
 	}
 
 	if err != nil && !(errors.Is(err, gorm.ErrRecordNotFound) && l.SkipErrRecordNotFound) {
-		l.Logger.Error().Err(err).Fields(fields).Msg("[GORM] query error")
+		if logLevel >= gormlogger.Error {
+			l.event(zerolog.ErrorLevel).Ctx(ctx).Err(err).Fields(l.traceFields(elapsed, fc)).Msg("[GORM] query error")
+		}
+		return
+	}
+
+	if slow {
+		if logLevel >= gormlogger.Warn {
+			l.event(zerolog.WarnLevel).Ctx(ctx).Fields(l.traceFields(elapsed, fc)).Msgf("[GORM] slow query")
+		}
 		return
 	}
 
-	if l.SlowThreshold != 0 && elapsed > l.SlowThreshold {
-		l.Logger.Warn().Fields(fields).Msgf("[GORM] slow query")
+	if logLevel < gormlogger.Info || (l.Sampler != nil && !l.Sampler.Sample(zerolog.DebugLevel)) {
 		return
 	}
+	l.event(zerolog.DebugLevel).Ctx(ctx).Fields(l.traceFields(elapsed, fc)).Msgf("[GORM] query")
+}
+
+// event starts a line at level. Lines of a LogMode copy have no zerolog level, so neither the global
+// level nor LevelHook filters them, and carry the level as a field.
+func (l *logger) event(level zerolog.Level) *zerolog.Event {
+	if l.mode == nil {
+		return moduleEvent(&l.Logger, ModuleGorm, level)
+	}
+	return l.Logger.Log().Str(zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc(level))
+}
+
+func (l *logger) traceFields(elapsed time.Duration, fc func() (string, int64)) map[string]interface{} {
+	sql, rows := fc()
+	if l.Redactor != nil {
+		sql = l.Redactor.SQL(sql)
+	}
+	fields := map[string]interface{}{
+		"sql":      sql,
+		"rows":     rows,
+		"duration": elapsed,
+	}
+
+	if l.SourceField != "" {
+		fields[l.SourceField] = gormCaller()
+	}
+	return fields
+}
+
+// logLevel maps the gorm module level to a gorm level unless LogMode was called.
+func (l *logger) logLevel() gormlogger.LogLevel {
+	if l.mode != nil {
+		return *l.mode
+	}
+
+	switch level := ModuleLevel(ModuleGorm); {
+	case level <= zerolog.DebugLevel:
+		return gormlogger.Info
+	case level <= zerolog.WarnLevel:
+		return gormlogger.Warn
+	case level <= zerolog.FatalLevel:
+		return gormlogger.Error
+	default:
+		return gormlogger.Silent
+	}
+}
+
+// gormLoggerFile is this file, its frames are skipped along with the gorm ones.
+var _, gormLoggerFile, _, _ = runtime.Caller(0)
+
+// gormCaller returns the file:line of the first frame outside gorm, formatted like the caller
+// field of the other logs. utils.FileWithLineNum would return this file.
+func gormCaller() string {
+	pcs := make([]uintptr, 20)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if frame.File != gormLoggerFile && !strings.Contains(frame.File, "gorm.io/") {
+			return zerolog.CallerMarshalFunc(frame.PC, frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// sqlOperation returns the first SQL keyword in lower case, e.g. "select".
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return strings.ToLower(fields[0])
+}
+
+var (
+	slowQueryCounterOnce sync.Once
+	slowQueries          *metrics.Counter
+)
 
-	l.Logger.Debug().Fields(fields).Msgf("[GORM] query")
+// slowQueryCounter is registered on first use, so importing the package does not add the metric.
+func slowQueryCounter() *metrics.Counter {
+	slowQueryCounterOnce.Do(func() {
+		slowQueries = metrics.NewCounterFrom(prometheus.CounterOpts{
+			Name: "gorm_slow_queries_total",
+			Help: "number of queries slower than the gorm logger slow threshold",
+		}, []string{LabelOperation})
+	})
+	return slowQueries
 }
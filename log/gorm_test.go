@@ -0,0 +1,175 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/ngtrvu/zen-go/log"
+)
+
+type gormUser struct {
+	ID   uint
+	Name string
+}
+
+func openGormDB(t *testing.T, opts log.GormLoggerOptions) (*gorm.DB, *bytes.Buffer) {
+	resetLevels(t)
+
+	buf := &bytes.Buffer{}
+	opts.Writer = buf
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: log.NewGormLoggerWithOptions(opts)})
+	require.NoError(t, err)
+	require.NoError(t, db.Session(&gorm.Session{Logger: gormlogger.Discard}).AutoMigrate(&gormUser{}))
+
+	return db, buf
+}
+
+func gormLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &entry))
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestGormLogger_LogMode(t *testing.T) {
+	db, buf := openGormDB(t, log.GormLoggerOptions{Level: "info"})
+
+	db.Create(&gormUser{Name: "Hai"})
+	assert.Empty(t, buf.String())
+
+	db.Debug().Where("name = ?", "Hai").First(&gormUser{})
+	lines := gormLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "[GORM] query", lines[0][zerolog.MessageFieldName])
+	assert.Contains(t, lines[0]["sql"], `name = "Hai"`)
+	assert.Contains(t, lines[0][zerolog.CallerFieldName], "gorm_test.go:")
+
+	buf.Reset()
+	db.Session(&gorm.Session{Logger: db.Logger.LogMode(gormlogger.Silent)}).Exec("SELECT * FROM missing")
+	assert.Empty(t, buf.String())
+
+	db.Exec("SELECT * FROM missing")
+	lines = gormLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "[GORM] query error", lines[0][zerolog.MessageFieldName])
+}
+
+func TestGormLogger_ModuleLevel(t *testing.T) {
+	db, buf := openGormDB(t, log.GormLoggerOptions{Level: "warn", SampleEvery: 2, ParameterizedQueries: true})
+
+	db.Where("name = ?", "Hai").Find(&[]gormUser{})
+	assert.Empty(t, buf.String())
+
+	_, err := log.OverrideLevel(log.ModuleGorm, zerolog.DebugLevel, time.Minute)
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		db.Where("name = ?", "Hai").Find(&[]gormUser{})
+	}
+
+	lines := gormLines(t, buf)
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0]["sql"], "name = ?")
+}
+
+func TestGormLogger_SlowQuery(t *testing.T) {
+	db, buf := openGormDB(t, log.GormLoggerOptions{Level: "info", SlowThreshold: time.Nanosecond})
+
+	db.Find(&[]gormUser{})
+
+	lines := gormLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "[GORM] slow query", lines[0][zerolog.MessageFieldName])
+	assert.Equal(t, zerolog.LevelWarnValue, lines[0][zerolog.LevelFieldName])
+
+	count, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "gorm_slow_queries_total")
+	require.NoError(t, err)
+	assert.Positive(t, count)
+}
+
+func TestNewWithGormLogger_ModuleLevel(t *testing.T) {
+	resetLevels(t)
+	buf := &bytes.Buffer{}
+	gormLogger := log.NewWithGormLogger(zerolog.New(buf), gormlogger.Config{})
+
+	log.SetModuleLevel(log.ModuleGorm, zerolog.ErrorLevel)
+	gormLogger.Logger.Warn().Msg("hidden")
+	assert.Empty(t, buf.String())
+
+	gormLogger.Logger.Error().Msg("shown")
+	lines := gormLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "shown", lines[0][zerolog.MessageFieldName])
+}
+
+// initZeroLog runs InitZeroLog and restores the zerolog globals it changes after the test.
+func initZeroLog(t *testing.T, level string) {
+	initZeroLogWithOptions(t, log.ZeroLogOptions{Level: level})
+}
+
+func initZeroLogWithOptions(t *testing.T, opts log.ZeroLogOptions) {
+	resetLevels(t)
+	levelFieldName, levelFieldMarshalFunc := zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc
+	timestampFieldName, timeFieldFormat := zerolog.TimestampFieldName, zerolog.TimeFieldFormat
+	errorStackMarshaler, callerSkipFrameCount, callerMarshalFunc := zerolog.ErrorStackMarshaler, zerolog.CallerSkipFrameCount, zerolog.CallerMarshalFunc
+	logger, gLogger, slogDefault := zlog.Logger, log.GLogger, slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(slogDefault)
+		zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc = levelFieldName, levelFieldMarshalFunc
+		zerolog.TimestampFieldName, zerolog.TimeFieldFormat = timestampFieldName, timeFieldFormat
+		zerolog.ErrorStackMarshaler, zerolog.CallerSkipFrameCount, zerolog.CallerMarshalFunc = errorStackMarshaler, callerSkipFrameCount, callerMarshalFunc
+		zlog.Logger, log.GLogger = logger, gLogger
+	})
+
+	log.InitZeroLogWithOptions(opts)
+}
+
+func TestGormLogger_LogModeAtInfoLevel(t *testing.T) {
+	initZeroLog(t, "info")
+	buf := &bytes.Buffer{}
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: log.NewGormLoggerWithOptions(log.GormLoggerOptions{Level: "info", Writer: buf})})
+	require.NoError(t, err)
+	require.NoError(t, db.Session(&gorm.Session{Logger: gormlogger.Discard}).AutoMigrate(&gormUser{}))
+
+	db.Find(&[]gormUser{})
+	assert.Empty(t, buf.String())
+
+	db.Debug().Find(&[]gormUser{})
+	lines := gormLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "[GORM] query", lines[0][zerolog.MessageFieldName])
+	assert.Equal(t, "DEBUG", lines[0][zerolog.LevelFieldName])
+
+	// the module level applies to the logger without a mode
+	buf.Reset()
+	_, err = log.OverrideLevel(log.ModuleGorm, zerolog.ErrorLevel, time.Minute)
+	require.NoError(t, err)
+	db.Find(&[]gormUser{}, "missing = 1")
+	lines = gormLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "[GORM] query error", lines[0][zerolog.MessageFieldName])
+
+	buf.Reset()
+	_, err = log.OverrideLevel(log.ModuleGorm, zerolog.Disabled, time.Minute)
+	require.NoError(t, err)
+	db.Find(&[]gormUser{}, "missing = 1")
+	assert.Empty(t, buf.String())
+}
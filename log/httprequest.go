@@ -0,0 +1,85 @@
+package log
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FieldHTTPRequest holds the request of a request log, in the Cloud Logging HttpRequest format.
+	FieldHTTPRequest = "httpRequest"
+
+	// FieldLabels holds string labels, promoted to the Cloud Logging entry labels.
+	FieldLabels = "labels"
+)
+
+// HTTPRequest describes a served request with the Cloud Logging HttpRequest field names.
+type HTTPRequest struct {
+	RequestMethod string `json:"requestMethod"`
+	RequestURL    string `json:"requestUrl"`
+	RequestSize   int64  `json:"requestSize,string,omitempty"`
+	Status        int    `json:"status"`
+	ResponseSize  int64  `json:"responseSize,string"`
+	UserAgent     string `json:"userAgent,omitempty"`
+	RemoteIP      string `json:"remoteIp,omitempty"`
+	Referer       string `json:"referer,omitempty"`
+	Latency       string `json:"latency"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// NewHTTPRequest describes r served with status, responseSize bytes in latency.
+func NewHTTPRequest(r *http.Request, status int, responseSize int64, latency time.Duration) HTTPRequest {
+	requestSize := r.ContentLength
+	if requestSize < 0 {
+		requestSize = 0
+	}
+
+	return HTTPRequest{
+		RequestMethod: r.Method,
+		RequestURL:    r.URL.String(),
+		RequestSize:   requestSize,
+		Status:        status,
+		ResponseSize:  responseSize,
+		UserAgent:     r.UserAgent(),
+		RemoteIP:      remoteIP(r.RemoteAddr),
+		Referer:       r.Referer(),
+		Latency:       formatLatency(latency),
+		Protocol:      r.Proto,
+	}
+}
+
+// HTTPRequestField attaches req to a log line.
+func HTTPRequestField(req HTTPRequest) Field {
+	return Field{Key: FieldHTTPRequest, Value: req}
+}
+
+// Labels attaches string labels to a log line.
+func Labels(labels map[string]string) Field {
+	return Field{Key: FieldLabels, Value: labels}
+}
+
+// LatencyDuration parses the latency written by NewHTTPRequest.
+func (req HTTPRequest) LatencyDuration() time.Duration {
+	seconds, err := strconv.ParseFloat(strings.TrimSuffix(req.Latency, "s"), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// formatLatency uses the protobuf Duration JSON format, e.g. "0.012000s".
+func formatLatency(latency time.Duration) string {
+	return fmt.Sprintf("%.6fs", latency.Seconds())
+}
+
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
@@ -0,0 +1,275 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Modules with their own log level. Lines of the default module come from the global logger.
+const (
+	ModuleDefault = "default"
+	ModuleHTTP    = "http"
+	ModuleGorm    = "gorm"
+	ModuleQueue   = "queue"
+
+	FieldModule = "module"
+)
+
+var ErrUnknownModule = errors.New("unknown log module")
+
+// LevelState describes the level of a module. Level is the effective level, it differs from
+// BaseLevel while an override set by OverrideLevel is active.
+type LevelState struct {
+	Module    string     `json:"module"`
+	Level     string     `json:"level"`
+	BaseLevel string     `json:"base_level"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type levelOverride struct {
+	level     zerolog.Level
+	expiresAt time.Time
+	timer     *time.Timer
+}
+
+type levelRegistry struct {
+	mu        sync.Mutex
+	base      map[string]zerolog.Level
+	overrides map[string]*levelOverride
+
+	// effective levels read by LevelHook on every event
+	effective atomic.Pointer[map[string]zerolog.Level]
+}
+
+var levels = newLevelRegistry()
+
+// moduleLogger and streamingModuleLogger are the global logger and GLogger without the level
+// hook of the default module, see Module and StreamingModule.
+var (
+	moduleLogger          = log.Logger
+	streamingModuleLogger zerolog.Logger
+)
+
+func newLevelRegistry() *levelRegistry {
+	r := &levelRegistry{
+		base: map[string]zerolog.Level{
+			ModuleDefault: zerolog.GlobalLevel(),
+		},
+		overrides: make(map[string]*levelOverride),
+	}
+	r.refresh()
+	return r
+}
+
+// SetModuleLevel sets the configured level of module, e.g. from InitZeroLog or NewGormLogger.
+// Modules without a level follow the default module.
+func SetModuleLevel(module string, level zerolog.Level) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	levels.base[module] = level
+	levels.refresh()
+}
+
+// OverrideLevel changes the level of module at runtime and reverts it to the configured level after ttl.
+// A ttl <= 0 keeps the override until ResetLevel is called.
+func OverrideLevel(module string, level zerolog.Level, ttl time.Duration) (LevelState, error) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	if !levels.known(module) {
+		return LevelState{}, fmt.Errorf("%w: %s", ErrUnknownModule, module)
+	}
+
+	levels.stopOverride(module)
+	override := &levelOverride{level: level}
+	if ttl > 0 {
+		override.expiresAt = time.Now().Add(ttl)
+		override.timer = time.AfterFunc(ttl, func() {
+			levels.mu.Lock()
+			defer levels.mu.Unlock()
+
+			// the override could have been replaced in the meantime
+			if levels.overrides[module] == override {
+				delete(levels.overrides, module)
+				levels.refresh()
+				Info("log level of module %s reverted to %s", module, levels.state(module).Level)
+			}
+		})
+	}
+	levels.overrides[module] = override
+	levels.refresh()
+
+	Info("log level of module %s set to %s, ttl: %v", module, level, ttl)
+	return levels.state(module), nil
+}
+
+// ResetLevel removes the runtime override of module.
+func ResetLevel(module string) (LevelState, error) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	if !levels.known(module) {
+		return LevelState{}, fmt.Errorf("%w: %s", ErrUnknownModule, module)
+	}
+
+	levels.stopOverride(module)
+	levels.refresh()
+	return levels.state(module), nil
+}
+
+// ModuleLevel returns the effective level of module.
+func ModuleLevel(module string) zerolog.Level {
+	effective := *levels.effective.Load()
+	if level, ok := effective[module]; ok {
+		return level
+	}
+	return effective[ModuleDefault]
+}
+
+// GetLevel returns the state of module.
+func GetLevel(module string) (LevelState, error) {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	if !levels.known(module) {
+		return LevelState{}, fmt.Errorf("%w: %s", ErrUnknownModule, module)
+	}
+	return levels.state(module), nil
+}
+
+// GetLevels returns the state of every module sorted by name, the default module first.
+func GetLevels() []LevelState {
+	levels.mu.Lock()
+	defer levels.mu.Unlock()
+
+	modules := levels.modules()
+	states := make([]LevelState, 0, len(modules))
+	for _, module := range modules {
+		states = append(states, levels.state(module))
+	}
+	return states
+}
+
+// Module returns a logger for module: lines carry the module field and are filtered by the module level.
+func Module(module string) *FieldLogger {
+	return &FieldLogger{logger: moduleLogger.With().Str(FieldModule, module).Logger().Hook(LevelHook{Module: module}), module: module}
+}
+
+// StreamingModule is Module writing to the streaming writers of GLogger, e.g. Cloud Logging.
+func StreamingModule(module string) *FieldLogger {
+	return &FieldLogger{logger: streamingModuleLogger.With().Str(FieldModule, module).Logger().Hook(LevelHook{Module: module}), module: module}
+}
+
+// moduleEvent starts an event at level on logger. zerolog's global level follows the default module,
+// so the events of a module set to a lower level are started without a zerolog level, carrying their
+// severity as a field, once the level of module allows them.
+func moduleEvent(logger *zerolog.Logger, module string, level zerolog.Level) *zerolog.Event {
+	if level >= zerolog.GlobalLevel() {
+		return logger.WithLevel(level)
+	}
+	if level < ModuleLevel(module) {
+		return nil
+	}
+	return logger.Log().Str(zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc(level))
+}
+
+// LevelHook discards events below the effective level of Module, every logger writing zen logs of a
+// module must install it. Events of a module below zerolog's global level are only written by the
+// loggers of Module, StreamingModule and the gorm logger.
+type LevelHook struct {
+	Module string
+}
+
+func (h LevelHook) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	if level != zerolog.NoLevel && level < ModuleLevel(h.Module) {
+		e.Discard()
+	}
+}
+
+func (r *levelRegistry) known(module string) bool {
+	switch module {
+	case ModuleDefault, ModuleHTTP, ModuleGorm, ModuleQueue:
+		return true
+	}
+	_, ok := r.base[module]
+	return ok
+}
+
+func (r *levelRegistry) modules() []string {
+	seen := map[string]struct{}{ModuleHTTP: {}, ModuleGorm: {}, ModuleQueue: {}}
+	for module := range r.base {
+		seen[module] = struct{}{}
+	}
+	delete(seen, ModuleDefault)
+
+	modules := make([]string, 0, len(seen))
+	for module := range seen {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return append([]string{ModuleDefault}, modules...)
+}
+
+func (r *levelRegistry) baseLevel(module string) zerolog.Level {
+	if level, ok := r.base[module]; ok {
+		return level
+	}
+	return r.base[ModuleDefault]
+}
+
+func (r *levelRegistry) state(module string) LevelState {
+	state := LevelState{
+		Module:    module,
+		Level:     ModuleLevel(module).String(),
+		BaseLevel: r.baseLevel(module).String(),
+	}
+	if override, ok := r.overrides[module]; ok && !override.expiresAt.IsZero() {
+		expiresAt := override.expiresAt
+		state.ExpiresAt = &expiresAt
+	}
+	return state
+}
+
+func (r *levelRegistry) stopOverride(module string) {
+	if override, ok := r.overrides[module]; ok {
+		if override.timer != nil {
+			override.timer.Stop()
+		}
+		delete(r.overrides, module)
+	}
+}
+
+// refresh recomputes the effective levels. zerolog's global level follows the default module so
+// loggers without LevelHook, e.g. of other libraries, are not made verbose by a module override.
+func (r *levelRegistry) refresh() {
+	defaultLevel := r.base[ModuleDefault]
+	if override, ok := r.overrides[ModuleDefault]; ok {
+		defaultLevel = override.level
+	}
+
+	effective := map[string]zerolog.Level{ModuleDefault: defaultLevel}
+	for _, module := range r.modules() {
+		if module == ModuleDefault {
+			continue
+		}
+		level := defaultLevel
+		if base, ok := r.base[module]; ok {
+			level = base
+		}
+		if override, ok := r.overrides[module]; ok {
+			level = override.level
+		}
+		effective[module] = level
+	}
+
+	r.effective.Store(&effective)
+	zerolog.SetGlobalLevel(defaultLevel)
+}
@@ -0,0 +1,123 @@
+package log
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	LevelHandlerPath = "/admin/log-level"
+
+	// LevelTokenEnv holds the bearer token of the admin endpoint, the http and grpc servers do not
+	// mount it on their metrics port when it is empty.
+	LevelTokenEnv = "LOG_LEVEL_TOKEN"
+
+	// DefaultLevelTTL reverts levels set through the admin endpoints when no ttl is given.
+	DefaultLevelTTL = 15 * time.Minute
+)
+
+// LevelRequest changes the level of Module, the default module when empty.
+// TTL is a duration like "10m", DefaultLevelTTL when empty and no revert when "0".
+type LevelRequest struct {
+	Module string `json:"module"`
+	Level  string `json:"level"`
+	TTL    string `json:"ttl"`
+}
+
+// SetLevel parses and applies req, it is shared by the HTTP and gRPC admin endpoints.
+func SetLevel(req LevelRequest) (LevelState, error) {
+	level, err := zerolog.ParseLevel(req.Level)
+	if err != nil || req.Level == "" {
+		return LevelState{}, errors.New("invalid log level: " + req.Level)
+	}
+
+	ttl := DefaultLevelTTL
+	if req.TTL != "" {
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil {
+			return LevelState{}, errors.New("invalid ttl: " + req.TTL)
+		}
+	}
+
+	return OverrideLevel(moduleOrDefault(req.Module), level, ttl)
+}
+
+// LevelHandler serves the log levels:
+//
+//	GET    /admin/log-level[?module=gorm]    current levels
+//	PUT    /admin/log-level                  {"module": "gorm", "level": "debug", "ttl": "10m"}
+//	DELETE /admin/log-level?module=gorm      revert to the configured level
+//
+// It has no authentication, serve it behind TokenLevelHandler or on a private port.
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		module := r.URL.Query().Get("module")
+
+		switch r.Method {
+		case http.MethodGet:
+			if module == "" {
+				writeLevelJSON(w, http.StatusOK, map[string]interface{}{"levels": GetLevels()})
+				return
+			}
+			state, err := GetLevel(module)
+			writeLevelResult(w, state, err)
+		case http.MethodPut, http.MethodPost:
+			var req LevelRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeLevelJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid request body"})
+				return
+			}
+			state, err := SetLevel(req)
+			writeLevelResult(w, state, err)
+		case http.MethodDelete:
+			state, err := ResetLevel(moduleOrDefault(module))
+			writeLevelResult(w, state, err)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			writeLevelJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": "method not allowed"})
+		}
+	})
+}
+
+// TokenLevelHandler serves LevelHandler to requests with the "Authorization: Bearer <token>" header.
+// The http and grpc servers mount it on their metrics port when LevelTokenEnv is set.
+func TokenLevelHandler(token string) http.Handler {
+	handler := LevelHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeLevelJSON(w, http.StatusUnauthorized, map[string]interface{}{"error": "unauthorized"})
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func moduleOrDefault(module string) string {
+	if module == "" {
+		return ModuleDefault
+	}
+	return module
+}
+
+func writeLevelResult(w http.ResponseWriter, state LevelState, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownModule):
+		writeLevelJSON(w, http.StatusNotFound, map[string]interface{}{"error": err.Error()})
+	case err != nil:
+		writeLevelJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+	default:
+		writeLevelJSON(w, http.StatusOK, state)
+	}
+}
+
+func writeLevelJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
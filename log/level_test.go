@@ -0,0 +1,168 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/log"
+)
+
+func resetLevels(t *testing.T) {
+	defaultLevel := log.ModuleLevel(log.ModuleDefault)
+	t.Cleanup(func() {
+		for _, state := range log.GetLevels() {
+			log.ResetLevel(state.Module)
+		}
+		log.SetModuleLevel(log.ModuleDefault, defaultLevel)
+	})
+}
+
+func TestLevelHook_PerModule(t *testing.T) {
+	buf := &bytes.Buffer{}
+	initZeroLogWithOptions(t, log.ZeroLogOptions{Level: "info", Writers: []io.Writer{buf}})
+	log.SetModuleLevel(log.ModuleGorm, zerolog.WarnLevel)
+	buf.Reset()
+
+	app := log.StreamingModule(log.ModuleDefault)
+	gorm := log.StreamingModule(log.ModuleGorm)
+	queue := log.StreamingModule(log.ModuleQueue)
+	thirdParty := zerolog.New(buf)
+
+	_, err := log.OverrideLevel(log.ModuleGorm, zerolog.DebugLevel, 0)
+	require.NoError(t, err)
+	assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel(), "the global level follows the default module")
+
+	app.Debug("app debug")
+	log.GLogger.Debug().Msg("streaming debug")
+	thirdParty.Debug().Msg("third party debug")
+	gorm.With(log.String("table", "users")).Debug("gorm debug")
+	queue.Debug("queue debug")
+	queue.Info("queue info")
+
+	assert.NotContains(t, buf.String(), "app debug")
+	assert.NotContains(t, buf.String(), "streaming debug")
+	assert.NotContains(t, buf.String(), "third party debug")
+	assert.NotContains(t, buf.String(), "queue debug")
+	assert.Contains(t, buf.String(), "queue info")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(bytes.SplitN(buf.Bytes(), []byte("\n"), 2)[0], &entry))
+	assert.Equal(t, "gorm debug", entry[zerolog.MessageFieldName])
+	assert.Equal(t, "DEBUG", entry[zerolog.LevelFieldName])
+	assert.Equal(t, "users", entry["table"])
+
+	state, err := log.ResetLevel(log.ModuleGorm)
+	require.NoError(t, err)
+	assert.Equal(t, "warn", state.Level)
+	buf.Reset()
+	gorm.Debug("gorm debug")
+	gorm.Info("gorm info")
+	assert.Empty(t, buf.String())
+}
+
+func TestOverrideLevel_TTL(t *testing.T) {
+	resetLevels(t)
+	log.SetModuleLevel(log.ModuleDefault, zerolog.InfoLevel)
+
+	state, err := log.OverrideLevel(log.ModuleHTTP, zerolog.DebugLevel, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "debug", state.Level)
+	assert.Equal(t, "info", state.BaseLevel)
+	require.NotNil(t, state.ExpiresAt)
+
+	assert.Eventually(t, func() bool {
+		return log.ModuleLevel(log.ModuleHTTP) == zerolog.InfoLevel
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel())
+}
+
+func TestOverrideLevel_UnknownModule(t *testing.T) {
+	_, err := log.OverrideLevel("payment", zerolog.DebugLevel, time.Minute)
+	assert.ErrorIs(t, err, log.ErrUnknownModule)
+}
+
+func TestLevelHandler(t *testing.T) {
+	resetLevels(t)
+	log.SetModuleLevel(log.ModuleDefault, zerolog.InfoLevel)
+	handler := log.LevelHandler()
+
+	writer := httptest.NewRecorder()
+	body := `{"module": "queue", "level": "debug", "ttl": "10m"}`
+	handler.ServeHTTP(writer, httptest.NewRequest(http.MethodPut, log.LevelHandlerPath, strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, writer.Code)
+
+	var state log.LevelState
+	require.NoError(t, json.Unmarshal(writer.Body.Bytes(), &state))
+	assert.Equal(t, "debug", state.Level)
+	require.NotNil(t, state.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), *state.ExpiresAt, time.Minute)
+
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, log.LevelHandlerPath, nil))
+	require.Equal(t, http.StatusOK, writer.Code)
+
+	var resp struct {
+		Levels []log.LevelState `json:"levels"`
+	}
+	require.NoError(t, json.Unmarshal(writer.Body.Bytes(), &resp))
+	require.Len(t, resp.Levels, 4)
+	assert.Equal(t, log.ModuleDefault, resp.Levels[0].Module)
+	assert.Equal(t, log.LevelState{Module: log.ModuleHTTP, Level: "info", BaseLevel: "info"}, resp.Levels[2])
+
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest(http.MethodDelete, log.LevelHandlerPath+"?module=queue", nil))
+	require.Equal(t, http.StatusOK, writer.Code)
+	assert.Equal(t, zerolog.InfoLevel, log.ModuleLevel(log.ModuleQueue))
+
+	writer = httptest.NewRecorder()
+	body = `{"module": "queue", "level": "loud"}`
+	handler.ServeHTTP(writer, httptest.NewRequest(http.MethodPut, log.LevelHandlerPath, strings.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, writer.Code)
+
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, log.LevelHandlerPath+"?module=payment", nil))
+	assert.Equal(t, http.StatusNotFound, writer.Code)
+}
+
+func TestTokenLevelHandler(t *testing.T) {
+	resetLevels(t)
+	log.SetModuleLevel(log.ModuleDefault, zerolog.InfoLevel)
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		statusCode    int
+	}{
+		{name: "missing token", token: "secret", statusCode: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", authorization: "Bearer other", statusCode: http.StatusUnauthorized},
+		{name: "no token configured", authorization: "Bearer ", statusCode: http.StatusUnauthorized},
+		{name: "valid token", token: "secret", authorization: "Bearer secret", statusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"module": "queue", "level": "debug"}`
+			req := httptest.NewRequest(http.MethodPut, log.LevelHandlerPath, strings.NewReader(body))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			writer := httptest.NewRecorder()
+			log.TokenLevelHandler(tt.token).ServeHTTP(writer, req)
+			assert.Equal(t, tt.statusCode, writer.Code)
+			if tt.statusCode == http.StatusUnauthorized {
+				assert.Equal(t, zerolog.InfoLevel, log.ModuleLevel(log.ModuleQueue))
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// FieldLogger writes structured log lines. Every method calls zerolog directly so that
+// the caller file:line configured by InitZeroLog points to the caller of the method.
+type FieldLogger struct {
+	logger zerolog.Logger
+
+	// module filters the lines below zerolog's global level, see Module
+	module string
+}
+
+// NewFieldLogger wraps an existing zerolog logger.
+func NewFieldLogger(logger zerolog.Logger) *FieldLogger {
+	return &FieldLogger{logger: logger, module: ModuleDefault}
+}
+
+// With returns a logger from the global logger with fields attached to every line.
+func With(fields ...Field) *FieldLogger {
+	return NewFieldLogger(log.Logger).With(fields...)
+}
+
+// Ctx returns a logger with the fields stored in ctx and its request id / trace id.
+func Ctx(ctx context.Context) *FieldLogger {
+	return NewFieldLogger(log.Logger).Ctx(ctx)
+}
+
+// With returns a child logger with fields attached to every line.
+func (l *FieldLogger) With(fields ...Field) *FieldLogger {
+	if len(fields) == 0 {
+		return l
+	}
+	return &FieldLogger{logger: l.logger.With().Fields(fieldsToSlice(fields)).Logger(), module: l.module}
+}
+
+// Ctx returns a child logger with the fields stored in ctx and its request id / trace id.
+func (l *FieldLogger) Ctx(ctx context.Context) *FieldLogger {
+	logger := l.logger.With().Ctx(ctx)
+	if fields := FieldsFromContext(ctx); len(fields) > 0 {
+		logger = logger.Fields(fieldsToSlice(fields))
+	}
+	return &FieldLogger{logger: logger.Logger(), module: l.module}
+}
+
+// Zerolog exposes the underlying logger for advanced usages.
+func (l *FieldLogger) Zerolog() *zerolog.Logger {
+	return &l.logger
+}
+
+func (l *FieldLogger) Debug(message string, fields ...Field) {
+	withFields(moduleEvent(&l.logger, l.module, zerolog.DebugLevel), fields).Msg(message)
+}
+
+func (l *FieldLogger) Info(message string, fields ...Field) {
+	withFields(moduleEvent(&l.logger, l.module, zerolog.InfoLevel), fields).Msg(message)
+}
+
+func (l *FieldLogger) Warn(message string, fields ...Field) {
+	withFields(moduleEvent(&l.logger, l.module, zerolog.WarnLevel), fields).Msg(message)
+}
+
+// Error logs err with its stack trace when it carries one (github.com/pkg/errors).
+func (l *FieldLogger) Error(err error, message string, fields ...Field) {
+	withFields(moduleEvent(&l.logger, l.module, zerolog.ErrorLevel).Stack().Err(err), fields).Msg(message)
+}
+
+// Fatal logs err with its stack trace and exits the process.
+func (l *FieldLogger) Fatal(err error, message string, fields ...Field) {
+	withFields(l.logger.Fatal().Stack().Err(err), fields).Msg(message)
+}
+
+func withFields(e *zerolog.Event, fields []Field) *zerolog.Event {
+	if e == nil || len(fields) == 0 {
+		return e
+	}
+	return e.Fields(fieldsToSlice(fields))
+}
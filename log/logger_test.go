@@ -0,0 +1,77 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	zerologlog "github.com/rs/zerolog/log"
+	"github.com/rs/zerolog/pkgerrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/correlation"
+	"github.com/ngtrvu/zen-go/log"
+)
+
+func captureGlobalLogger(t *testing.T) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	previous := zerologlog.Logger
+	zerologlog.Logger = zerolog.New(buf).Hook(log.CorrelationHook{})
+	t.Cleanup(func() { zerologlog.Logger = previous })
+	return buf
+}
+
+func lastLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(lines[len(lines)-1], &entry))
+	return entry
+}
+
+func TestCtx_IncludesContextFields(t *testing.T) {
+	buf := captureGlobalLogger(t)
+
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: "req-1"})
+	ctx = log.ContextWithFields(ctx, log.UserID("u-1"))
+	ctx = log.ContextWithFields(ctx, log.OrderID(42))
+
+	log.Ctx(ctx).Info("order placed", log.String("status", "new"), log.Duration("elapsed", time.Second))
+
+	entry := lastLine(t, buf)
+	assert.Equal(t, "order placed", entry["message"])
+	assert.Equal(t, "req-1", entry[correlation.FieldRequestID])
+	assert.Equal(t, "u-1", entry[log.FieldUserID])
+	assert.Equal(t, float64(42), entry[log.FieldOrderID])
+	assert.Equal(t, "new", entry["status"])
+}
+
+func TestWith_Builder(t *testing.T) {
+	buf := captureGlobalLogger(t)
+
+	logger := log.With(log.String("component", "payment")).With(log.Bool("retry", true))
+	logger.Warn("slow upstream", log.Int("attempt", 2))
+
+	entry := lastLine(t, buf)
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "payment", entry["component"])
+	assert.Equal(t, true, entry["retry"])
+	assert.Equal(t, float64(2), entry["attempt"])
+}
+
+func TestError_WithStack(t *testing.T) {
+	buf := captureGlobalLogger(t)
+	previous := zerolog.ErrorStackMarshaler
+	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+	t.Cleanup(func() { zerolog.ErrorStackMarshaler = previous })
+
+	log.Ctx(context.Background()).Error(errors.New("db down"), "failed to save order")
+
+	entry := lastLine(t, buf)
+	assert.Equal(t, "db down", entry["error"])
+	assert.NotNil(t, entry["stack"])
+}
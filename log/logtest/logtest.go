@@ -0,0 +1,62 @@
+// Package logtest provides fakes to test code writing to Cloud Logging without a GCP project.
+package logtest
+
+import (
+	"sync"
+
+	"cloud.google.com/go/logging"
+)
+
+// CloudLogger records the entries instead of sending them, it implements log.CloudLogger.
+type CloudLogger struct {
+	// FlushErr is returned by Flush.
+	FlushErr error
+
+	mu      sync.Mutex
+	entries []logging.Entry
+	flushes int
+}
+
+func NewCloudLogger() *CloudLogger {
+	return &CloudLogger{}
+}
+
+func (l *CloudLogger) Log(entry logging.Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+}
+
+func (l *CloudLogger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.flushes++
+	return l.FlushErr
+}
+
+// Entries returns a copy of the recorded entries.
+func (l *CloudLogger) Entries() []logging.Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]logging.Entry{}, l.entries...)
+}
+
+// Flushes returns the number of Flush calls.
+func (l *CloudLogger) Flushes() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.flushes
+}
+
+// Reset drops the recorded entries.
+func (l *CloudLogger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = nil
+	l.flushes = 0
+}
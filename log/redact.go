@@ -0,0 +1,67 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/rs/zerolog"
+
+	"github.com/ngtrvu/zen-go/redact"
+)
+
+// redactingWriter masks sensitive values in every JSON log line before passing it to the next writer.
+type redactingWriter struct {
+	next     io.Writer
+	redactor *redact.Redactor
+}
+
+// NewRedactingWriter wraps w so that field values, messages and errors are redacted.
+// Level information is kept when w is a zerolog.LevelWriter (e.g. the Cloud Logging writer).
+func NewRedactingWriter(w io.Writer, redactor *redact.Redactor) zerolog.LevelWriter {
+	return &redactingWriter{next: w, redactor: redactor}
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := w.next.Write(w.redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *redactingWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	levelWriter, ok := w.next.(zerolog.LevelWriter)
+	if !ok {
+		return w.Write(p)
+	}
+
+	if _, err := levelWriter.WriteLevel(level, w.redact(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redact decodes the line, masks it and encodes it back. Lines which are not JSON objects are
+// redacted as plain text.
+func (w *redactingWriter) redact(p []byte) []byte {
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(p))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return []byte(w.redactor.String(string(p)))
+	}
+
+	redacted := w.redactor.Fields(fields)
+	// metadata fields are written by zerolog itself, timestamps would trip the number detectors
+	for _, key := range []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.CallerFieldName} {
+		if value, ok := fields[key]; ok {
+			redacted[key] = value
+		}
+	}
+
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		return []byte(w.redactor.String(string(p)))
+	}
+	return append(data, '\n')
+}
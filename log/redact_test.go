@@ -0,0 +1,36 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/log"
+	"github.com/ngtrvu/zen-go/redact"
+)
+
+func TestRedactingWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(log.NewRedactingWriter(buf, redact.Default()))
+
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	logger.Info().
+		Time(zerolog.TimestampFieldName, timestamp).
+		Str("phone", "0912345678").
+		Str("note", "customer nguyen@stag.vn").
+		Int("amount", 1000000).
+		Msg("sent otp to 0987654321")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "09******78", entry["phone"])
+	assert.Equal(t, "customer n*****@stag.vn", entry["note"])
+	assert.Equal(t, float64(1000000), entry["amount"])
+	assert.Equal(t, "sent otp to 09******21", entry["message"])
+	assert.Equal(t, timestamp.Format(zerolog.TimeFieldFormat), entry[zerolog.TimestampFieldName])
+}
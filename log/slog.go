@@ -0,0 +1,201 @@
+package log
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"runtime"
+
+	"github.com/rs/zerolog"
+)
+
+// SlogHandler is a slog.Handler writing through zerolog, so slog records get the same
+// severity, timestamp and caller fields as the rest of the zen logs.
+type SlogHandler struct {
+	loggers []zerolog.Logger
+	opts    slog.HandlerOptions
+
+	// recordTime writes the time of the records, the loggers configured by InitZeroLog add their own.
+	recordTime bool
+
+	// attrs added by WithAttrs, each one nested under the groups open at that time
+	attrs  []groupedAttrs
+	groups []string
+}
+
+type groupedAttrs struct {
+	groups []string
+	attrs  []slog.Attr
+}
+
+// NewSlogHandler creates a handler writing JSON lines to w. A nil opts uses the level of ModuleDefault only.
+func NewSlogHandler(w io.Writer, opts *slog.HandlerOptions) *SlogHandler {
+	h := newSlogHandler(opts, zerolog.New(w).Hook(CorrelationHook{}))
+	h.recordTime = true
+	return h
+}
+
+// newSlogHandler writes every record through each of loggers, e.g. the global logger and the
+// streaming one configured by InitZeroLog.
+func newSlogHandler(opts *slog.HandlerOptions, loggers ...zerolog.Logger) *SlogHandler {
+	h := &SlogHandler{}
+	for _, logger := range loggers {
+		h.loggers = append(h.loggers, logger.Hook(LevelHook{Module: ModuleDefault}))
+	}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if h.opts.Level != nil && level < h.opts.Level.Level() {
+		return false
+	}
+	return slogToZerologLevel(level) >= ModuleLevel(ModuleDefault)
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := make(map[string]interface{})
+	for _, grouped := range h.attrs {
+		addAttrs(fields, grouped.groups, grouped.attrs)
+	}
+
+	recordAttrs := make([]slog.Attr, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		recordAttrs = append(recordAttrs, attr)
+		return true
+	})
+	addAttrs(fields, h.groups, recordAttrs)
+
+	var caller string
+	if h.opts.AddSource && record.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{record.PC})
+		frame, _ := frames.Next()
+		caller = zerolog.CallerMarshalFunc(frame.PC, frame.File, frame.Line)
+	}
+
+	for _, logger := range h.loggers {
+		// the caller hook of a configured logger would point into log/slog, skipping every frame disables it
+		e := logger.WithLevel(slogToZerologLevel(record.Level)).Ctx(ctx).CallerSkipFrame(math.MaxInt32 / 2)
+		if e == nil {
+			continue
+		}
+
+		if h.recordTime && !record.Time.IsZero() {
+			e.Time(zerolog.TimestampFieldName, record.Time)
+		}
+		if caller != "" {
+			e.Str(zerolog.CallerFieldName, caller)
+		}
+		if len(fields) > 0 {
+			e.Fields(fields)
+		}
+		e.Msg(record.Message)
+	}
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	clone := h.clone()
+	clone.attrs = append(clone.attrs, groupedAttrs{groups: clone.groups, attrs: attrs})
+	return clone
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	clone := h.clone()
+	clone.groups = append(clone.groups, name)
+	return clone
+}
+
+func (h *SlogHandler) clone() *SlogHandler {
+	clone := *h
+	clone.attrs = append([]groupedAttrs{}, h.attrs...)
+	clone.groups = append([]string{}, h.groups...)
+	return &clone
+}
+
+// addAttrs inserts attrs into fields under the nested groups. Groups without attrs are omitted.
+func addAttrs(fields map[string]interface{}, groups []string, attrs []slog.Attr) {
+	values := make(map[string]interface{})
+	for _, attr := range attrs {
+		addAttr(values, attr)
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	target := fields
+	for _, group := range groups {
+		child, ok := target[group].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			target[group] = child
+		}
+		target = child
+	}
+
+	for key, value := range values {
+		target[key] = value
+	}
+}
+
+func addAttr(fields map[string]interface{}, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() != slog.KindGroup {
+		fields[attr.Key] = slogValue(attr.Value)
+		return
+	}
+
+	// a group with an empty key is inlined
+	target := fields
+	if attr.Key != "" {
+		target = make(map[string]interface{})
+	}
+	for _, child := range attr.Value.Group() {
+		addAttr(target, child)
+	}
+	if attr.Key != "" && len(target) > 0 {
+		fields[attr.Key] = target
+	}
+}
+
+func slogValue(value slog.Value) interface{} {
+	switch value.Kind() {
+	case slog.KindTime:
+		return value.Time()
+	case slog.KindDuration:
+		return value.Duration()
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return err.Error()
+		}
+	}
+	return value.Any()
+}
+
+func slogToZerologLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return zerolog.DebugLevel
+	case level < slog.LevelWarn:
+		return zerolog.InfoLevel
+	case level < slog.LevelError:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.ErrorLevel
+	}
+}
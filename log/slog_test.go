@@ -0,0 +1,96 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"testing/slogtest"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/correlation"
+	"github.com/ngtrvu/zen-go/log"
+)
+
+// zenToSlogKeys maps the zen field names back to the names slogtest expects.
+var zenToSlogKeys = map[string]string{
+	"severity":  slog.LevelKey,
+	"level":     slog.LevelKey,
+	"timestamp": slog.TimeKey,
+	"time":      slog.TimeKey,
+	"message":   slog.MessageKey,
+}
+
+func TestSlogHandler_Conformance(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := log.NewSlogHandler(buf, nil)
+
+	err := slogtest.TestHandler(handler, func() []map[string]any {
+		var results []map[string]any
+		for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+			if len(line) == 0 {
+				continue
+			}
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal(line, &entry))
+			for zenKey, slogKey := range zenToSlogKeys {
+				if value, ok := entry[zenKey]; ok && zenKey != slogKey {
+					delete(entry, zenKey)
+					entry[slogKey] = value
+				}
+			}
+			results = append(results, entry)
+		}
+		return results
+	})
+	require.NoError(t, err)
+}
+
+func TestSlogHandler_ZenFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(log.NewSlogHandler(buf, &slog.HandlerOptions{AddSource: true, Level: slog.LevelInfo}))
+
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: "req-9"})
+	logger.DebugContext(ctx, "hidden")
+	logger.With("service", "payment").WithGroup("order").WarnContext(ctx, "slow", "id", 7)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry))
+
+	assert.Equal(t, zerolog.LevelWarnValue, entry[zerolog.LevelFieldName])
+	assert.Equal(t, "slow", entry[zerolog.MessageFieldName])
+	assert.Equal(t, "req-9", entry[correlation.FieldRequestID])
+	assert.Equal(t, "payment", entry["service"])
+	assert.Equal(t, map[string]interface{}{"id": float64(7)}, entry["order"])
+	assert.Contains(t, entry[zerolog.CallerFieldName], "slog_test.go:")
+	assert.NotEmpty(t, entry[zerolog.TimestampFieldName])
+}
+
+func TestInstallSlog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	initZeroLogWithOptions(t, log.ZeroLogOptions{Level: "info", Writers: []io.Writer{buf}, InstallSlog: true})
+	buf.Reset()
+
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: "req-3"})
+	slog.DebugContext(ctx, "hidden")
+	slog.InfoContext(ctx, "paid", "amount", 10)
+
+	// the streaming writers receive slog records once, with the caller of the record
+	line := bytes.TrimSpace(buf.Bytes())
+	assert.Equal(t, 1, bytes.Count(line, []byte(`"`+zerolog.CallerFieldName+`"`)), string(line))
+	assert.Equal(t, 1, bytes.Count(line, []byte(`"`+zerolog.TimestampFieldName+`"`)), string(line))
+	assert.Equal(t, 1, bytes.Count(line, []byte(`"`+correlation.FieldRequestID+`"`)), string(line))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(line, &entry))
+	assert.Equal(t, "INFO", entry[zerolog.LevelFieldName])
+	assert.Equal(t, "paid", entry[zerolog.MessageFieldName])
+	assert.Equal(t, "req-3", entry[correlation.FieldRequestID])
+	assert.Equal(t, float64(10), entry["amount"])
+	assert.Contains(t, entry[zerolog.CallerFieldName], "slog_test.go:")
+}
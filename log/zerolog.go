@@ -1,13 +1,19 @@
 package log
 
 import (
+	"context"
 	"io"
+	"log/slog"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/rs/zerolog/pkgerrors"
+
+	"github.com/ngtrvu/zen-go/correlation"
+	"github.com/ngtrvu/zen-go/redact"
 )
 
 var logLevelSeverity = map[zerolog.Level]string{
@@ -19,10 +25,34 @@ var logLevelSeverity = map[zerolog.Level]string{
 	zerolog.FatalLevel: "CRITICAL",
 }
 
+// ZeroLogOptions configures InitZeroLogWithOptions.
+type ZeroLogOptions struct {
+	Level string
+
+	// Writers receive the streaming logs, see Streaming.
+	Writers []io.Writer
+
+	// InstallSlog sets slog.Default to a SlogHandler writing through the global logger and GLogger, so
+	// log/slog users share the zen fields and the streaming writers.
+	InstallSlog bool
+
+	// Redactor masks PII in every log line when set, see redact.Default.
+	Redactor *redact.Redactor
+
+	// Async wraps every streaming writer in an AsyncWriter when set, Flush and Close drain them.
+	Async *AsyncWriterOptions
+}
+
 func InitZeroLog(logLevel string, writers ...io.Writer) {
+	InitZeroLogWithOptions(ZeroLogOptions{Level: logLevel, Writers: writers})
+}
+
+func InitZeroLogWithOptions(opts ZeroLogOptions) {
+	logLevel := opts.Level
+	writers := opts.Writers
 	level, _ := zerolog.ParseLevel(logLevel)
 
-	zerolog.SetGlobalLevel(level)
+	SetModuleLevel(ModuleDefault, level)
 	zerolog.LevelFieldName = "severity"
 	zerolog.LevelFieldMarshalFunc = func(l zerolog.Level) string {
 		return logLevelSeverity[l]
@@ -42,15 +72,64 @@ func InitZeroLog(logLevel string, writers ...io.Writer) {
 		file = short
 		return file + ":" + strconv.Itoa(line)
 	}
-	log.Logger = log.With().Caller().Logger()
+	var stderr io.Writer = os.Stderr
+	if opts.Redactor != nil {
+		stderr = NewRedactingWriter(os.Stderr, opts.Redactor)
+		redactedWriters := make([]io.Writer, len(writers))
+		for i, writer := range writers {
+			redactedWriters[i] = NewRedactingWriter(writer, opts.Redactor)
+		}
+		writers = redactedWriters
+	}
+	// the async writers of a previous call are closed once the loggers stop writing to them
+	previousAsyncWriters := asyncWritersWeMade
+	asyncWritersWeMade = nil
+	if opts.Async != nil {
+		asyncWriters := make([]io.Writer, len(writers))
+		for i, writer := range writers {
+			asyncWriters[i] = NewAsyncWriter(writer, *opts.Async)
+			asyncWritersWeMade = append(asyncWritersWeMade, asyncWriters[i].(*AsyncWriter))
+		}
+		writers = asyncWriters
+	}
+	// built anew, log.Output would keep the caller and hooks of a previous call
+	moduleLogger = zerolog.New(stderr).With().Timestamp().Caller().Logger().Hook(CorrelationHook{})
+	log.Logger = moduleLogger.Hook(LevelHook{Module: ModuleDefault})
 
 	// setup cloud logging for log streaming
 	multiWriters := zerolog.MultiLevelWriter(writers...)
-	GLogger = zerolog.New(multiWriters).With().Timestamp().Logger()
+	streamingModuleLogger = zerolog.New(multiWriters).With().Timestamp().Caller().Logger().Hook(CorrelationHook{})
+	GLogger = streamingModuleLogger.Hook(LevelHook{Module: ModuleDefault})
+
+	if opts.InstallSlog {
+		slog.SetDefault(slog.New(newSlogHandler(&slog.HandlerOptions{AddSource: true}, moduleLogger, streamingModuleLogger)))
+	}
 
+	for _, err := range closeAsyncWriters(previousAsyncWriters) {
+		Error("failed to close the previous async log writer: %v", err)
+	}
 	Info("zerolog is initialized, log level: %s", logLevel)
 }
 
+// CorrelationHook adds the request id and trace id to events logged with a context carrying them.
+type CorrelationHook struct{}
+
+func (h CorrelationHook) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	ids, ok := correlation.FromContext(e.GetCtx())
+	if !ok {
+		return
+	}
+
+	if ids.RequestID != "" {
+		e.Str(correlation.FieldRequestID, ids.RequestID)
+	}
+	if traceID := ids.TraceID(); traceID != "" {
+		e.Str(correlation.FieldTraceID, traceID)
+		e.Str(correlation.FieldSpanID, ids.SpanID())
+		e.Bool(correlation.FieldTraceSampled, ids.Sampled())
+	}
+}
+
 func Debug(message string, v ...interface{}) {
 	log.Debug().Msgf(message, v...)
 }
@@ -74,3 +153,19 @@ func Fatal(message string, v ...interface{}) {
 func Streaming(message string, v ...interface{}) {
 	GLogger.Info().Msgf(message, v...)
 }
+
+func DebugCtx(ctx context.Context, message string, v ...interface{}) {
+	log.Debug().Ctx(ctx).Msgf(message, v...)
+}
+
+func InfoCtx(ctx context.Context, message string, v ...interface{}) {
+	log.Info().Ctx(ctx).Msgf(message, v...)
+}
+
+func WarnCtx(ctx context.Context, message string, v ...interface{}) {
+	log.Warn().Ctx(ctx).Msgf(message, v...)
+}
+
+func ErrorCtx(ctx context.Context, message string, v ...interface{}) {
+	log.Error().Ctx(ctx).Msgf(message, v...)
+}
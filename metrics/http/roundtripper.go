@@ -3,6 +3,8 @@ package http
 import (
 	"net/http"
 	"time"
+
+	"github.com/ngtrvu/zen-go/correlation"
 )
 
 type NetHttpMetricsRoundTripper struct {
@@ -25,8 +27,12 @@ func (m *NetHttpMetricsRoundTripper) RoundTrip(req *http.Request) (res *http.Res
 		}
 	}(time.Now())
 
+	// propagate request id and trace context, a RoundTripper must not modify the caller's request
+	outReq := req.Clone(req.Context())
+	correlation.InjectHeaders(outReq)
+
 	// execute request
-	res, err = m.Next.RoundTrip(req)
+	res, err = m.Next.RoundTrip(outReq)
 
 	return res, err
 }
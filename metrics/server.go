@@ -2,23 +2,95 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const (
+	MetricsServerShutdownTimeout = 5 * time.Second
+)
+
 type MetricsServer struct {
 	Path string
 	Port string
+
+	// Handlers are extra endpoints served next to the metrics, e.g. admin endpoints.
+	Handlers map[string]http.Handler
+
+	mu     sync.Mutex
+	server *http.Server
 }
 
 func NewMetricServer(path, port string) *MetricsServer {
-	return &MetricsServer{Path: path, Port: port}
+	return &MetricsServer{Path: path, Port: port, Handlers: make(map[string]http.Handler)}
 }
 
-// TODO: using context to stop the metrics server
+// Handle serves handler at pattern on the metrics port, it must be called before Start.
+func (s *MetricsServer) Handle(pattern string, handler http.Handler) *MetricsServer {
+	if s.Handlers == nil {
+		s.Handlers = make(map[string]http.Handler)
+	}
+	s.Handlers[pattern] = handler
+	return s
+}
+
+// Handler serves the metrics and the extra handlers, any other path falls back to
+// http.DefaultServeMux so handlers registered globally, e.g. by net/http/pprof, stay reachable.
+func (s *MetricsServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(s.Path, promhttp.Handler())
+	for pattern, handler := range s.Handlers {
+		mux.Handle(pattern, handler)
+	}
+	if _, ok := s.Handlers["/"]; !ok {
+		mux.Handle("/", http.DefaultServeMux)
+	}
+	return mux
+}
+
+// Start serves the metrics endpoint until ctx is cancelled or Stop is called.
 func (s *MetricsServer) Start(ctx context.Context) error {
-	http.Handle(s.Path, promhttp.Handler())
-	return http.ListenAndServe(fmt.Sprintf(":%s", s.Port), nil)
+	s.mu.Lock()
+	s.server = &http.Server{
+		Addr:              fmt.Sprintf(":%s", s.Port),
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: MetricsServerShutdownTimeout,
+	}
+	server := s.server
+	s.mu.Unlock()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), MetricsServerShutdownTimeout)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		case <-stopped:
+		}
+	}()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Stop gracefully shuts down the metrics server.
+func (s *MetricsServer) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.server
+	s.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
 }
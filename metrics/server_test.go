@@ -0,0 +1,42 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ngtrvu/zen-go/metrics"
+)
+
+func TestMetricsServer_Handler(t *testing.T) {
+	http.HandleFunc("/debug/metrics-server-test", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("default mux"))
+	})
+
+	handler := metrics.NewMetricServer("/metrics", "0").
+		Handle("/admin/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("pong"))
+		})).
+		Handler()
+
+	tests := []struct {
+		path       string
+		statusCode int
+		body       string
+	}{
+		{path: "/metrics", statusCode: http.StatusOK, body: "go_goroutines"},
+		{path: "/admin/ping", statusCode: http.StatusOK, body: "pong"},
+		{path: "/debug/metrics-server-test", statusCode: http.StatusOK, body: "default mux"},
+		{path: "/missing", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.statusCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.body)
+		})
+	}
+}
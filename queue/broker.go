@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BackendPubSub   = "pubsub"
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+)
+
+var (
+	ErrBrokerClosed = errors.New("queue: broker closed")
+	// ErrMessageNotFound is returned by Scheduler when the message was delivered, cancelled or never
+	// published.
+	ErrMessageNotFound = errors.New("queue: message not found")
+	// ErrSchedulingNotSupported is returned when cancelling or rescheduling on a broker that is not a
+	// Scheduler.
+	ErrSchedulingNotSupported = errors.New("queue: broker cannot cancel or reschedule messages")
+	// ErrBrowsingNotSupported is returned when listing the messages of a broker that is not a
+	// Browser.
+	ErrBrowsingNotSupported = errors.New("queue: broker cannot list messages")
+)
+
+// Message is what a Broker carries, the Data of tasks is a JSON TaskMessage.
+type Message struct {
+	// ID is set by the broker on Publish.
+	ID         string
+	Data       []byte
+	Attributes map[string]string
+	// RunAt delays the delivery until then, the zero time delivers right away.
+	RunAt time.Time
+}
+
+// Handler processes a received message, returning nil acks it and an error nacks it for redelivery.
+type Handler func(ctx context.Context, msg *Message) error
+
+// Broker moves messages from publishers to workers. It is implemented by Pub/Sub, PostgreSQL and
+// memory backends, see NewBroker.
+type Broker interface {
+	// Publish enqueues msg and returns its ID.
+	Publish(ctx context.Context, msg *Message) (string, error)
+	// Receive calls handler concurrently for each message until ctx is done, then waits for the
+	// handlers to return. A cancelled ctx is not an error.
+	Receive(ctx context.Context, handler Handler) error
+	Close() error
+}
+
+// Scheduler is implemented by brokers that can change pending messages, see MemoryBroker and
+// PostgresBroker. Messages being handled can no longer be changed.
+type Scheduler interface {
+	// Cancel deletes the pending message id.
+	Cancel(ctx context.Context, id string) error
+	// Reschedule delays the pending message id until runAt, or makes it ready when runAt has passed.
+	Reschedule(ctx context.Context, id string, runAt time.Time) error
+}
+
+// Browser is implemented by brokers that can list their pending messages without receiving them, see
+// MemoryBroker and PostgresBroker.
+type Browser interface {
+	// Browse returns up to limit pending messages in publish order, all of them when limit is 0.
+	Browse(ctx context.Context, limit int) ([]*Message, error)
+}
+
+// NewBroker creates the backend selected by cfg.Backend. cfg.MaxOutstanding bounds the messages each
+// Receive handles at once.
+//
+// db is required by the PostgreSQL backend. With the Pub/Sub backend, it keeps the delayed messages in
+// cfg.PostgresTable through a DelayedBroker, see PostgresBroker.Migrate, otherwise the workers hold
+// the messages that are not due yet, see PubSubBroker.MaxHold, and there is no Cancel nor Reschedule.
+func NewBroker(ctx context.Context, cfg QueueConfig, db *gorm.DB) (Broker, error) {
+	switch cfg.Backend {
+	case BackendPubSub, "":
+		b, err := NewPubSubBroker(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		b.ReceiveSettings.MaxOutstandingMessages = cfg.MaxOutstanding
+		if db == nil {
+			return b, nil
+		}
+
+		store, err := NewPostgresBroker(db, PostgresOptions{Table: cfg.PostgresTable, Queue: "pubsub:" + cfg.TopicName})
+		if err != nil {
+			return nil, err
+		}
+		return &DelayedBroker{Broker: b, Store: store}, nil
+	case BackendPostgres:
+		if db == nil {
+			return nil, errors.New("queue: the postgres backend requires a database")
+		}
+		return NewPostgresBroker(db, PostgresOptions{Table: cfg.PostgresTable, Queue: cfg.SubName, BatchSize: cfg.MaxOutstanding})
+	case BackendMemory:
+		b := NewMemoryBroker()
+		b.Concurrency = cfg.MaxOutstanding
+		return b, nil
+	default:
+		return nil, fmt.Errorf("queue: unknown backend %q", cfg.Backend)
+	}
+}
+
+// clone copies a message so brokers never share it with their callers.
+func (m *Message) clone() *Message {
+	return &Message{
+		ID:         m.ID,
+		Data:       append([]byte(nil), m.Data...),
+		Attributes: maps.Clone(m.Attributes),
+		RunAt:      m.RunAt,
+	}
+}
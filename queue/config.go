@@ -1,9 +1,23 @@
 package queue
 
 type QueueConfig struct {
+	Backend   string `config:"BOPQ_BACKEND" default:"pubsub" validate:"oneof=pubsub postgres memory"`
 	TopicName string `config:"BOPQ_TOPIC_NAME"`
 	SubName   string `config:"BOPQ_SUB_NAME"`
 	ProjectID string `config:"BOPQ_PROJECT_ID"`
+
+	// PostgresTable holds the messages of the postgres backend, SubName names the queue in it. The
+	// table is not created by NewBroker nor NewQueueWithConfig, run PostgresBroker.Migrate at startup
+	// or the same statements in the migrations of the service.
+	PostgresTable string `config:"BOPQ_POSTGRES_TABLE" default:"queue_messages"`
+	// DeadLetterName is the topic and subscription, or the postgres queue, of the tasks that failed
+	// for good. They are only logged when empty.
+	DeadLetterName string `config:"BOPQ_DEAD_LETTER_NAME"`
+
+	// Concurrency bounds the tasks running at once, unbounded when 0.
+	Concurrency int `config:"BOPQ_CONCURRENCY"`
+	// MaxOutstanding bounds the messages received and not yet acked, the backend default when 0.
+	MaxOutstanding int `config:"BOPQ_MAX_OUTSTANDING"`
 }
 
 func NewQueueConfig(TopicName string, SubName string, ProjectID string) QueueConfig {
@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/ngtrvu/zen-go/log"
+)
+
+// Reasons of dead-lettering, see MetadataDeadLetterReason.
+const (
+	DeadLetterMalformed      = "malformed"
+	DeadLetterPermanentError = "permanent_error"
+	DeadLetterMaxAttempts    = "max_attempts"
+	DeadLetterUnknownTask    = "unknown_task"
+	DeadLetterPanic          = "panic"
+)
+
+// DeadLetter is a task that failed for good, as stored in the dead-letter broker of a Queue.
+type DeadLetter struct {
+	// ID is the message ID in the dead-letter broker.
+	ID string
+	// Task is nil when Data is not a TaskMessage.
+	Task     *TaskMessage
+	Data     []byte
+	Reason   string
+	Error    string
+	Attempts int
+	FailedAt time.Time
+}
+
+// NewDeadLetter reads a message of a dead-letter broker.
+func NewDeadLetter(msg *Message) *DeadLetter {
+	letter := &DeadLetter{
+		ID:     msg.ID,
+		Data:   msg.Data,
+		Reason: msg.Attributes[MetadataDeadLetterReason],
+		Error:  msg.Attributes[MetadataError],
+	}
+	letter.Attempts, _ = strconv.Atoi(msg.Attributes[MetadataAttempt])
+	letter.FailedAt, _ = time.Parse(time.RFC3339Nano, msg.Attributes[MetadataFailedAt])
+
+	var task TaskMessage
+	if err := json.Unmarshal(msg.Data, &task); err == nil && task.TaskID != "" {
+		letter.Task = &task
+	}
+	return letter
+}
+
+// ListDeadLetters returns up to limit dead letters, all of them when limit is 0. The broker must be a
+// Browser, such as the MemoryBroker, PostgresBroker and PubSubBroker.
+func ListDeadLetters(ctx context.Context, deadLetters Broker, limit int) ([]*DeadLetter, error) {
+	browser, ok := deadLetters.(Browser)
+	if !ok {
+		return nil, ErrBrowsingNotSupported
+	}
+
+	messages, err := browser.Browse(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]*DeadLetter, 0, len(messages))
+	for _, msg := range messages {
+		letters = append(letters, NewDeadLetter(msg))
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetters sends the dead letters accepted by filter, all when nil, to target with their
+// attempts reset and deletes them from deadLetters. It returns the number of replayed tasks, dead
+// letters that are not tasks are skipped. The dead-letter broker must be a Browser and a Scheduler, or
+// a PubSubBroker which acks the replayed letters.
+func ReplayDeadLetters(ctx context.Context, deadLetters Broker, target Broker, filter func(*DeadLetter) bool) (int, error) {
+	replayed := 0
+	if scanner, ok := deadLetters.(scanner); ok {
+		err := scanner.scan(ctx, func(msg *Message) (bool, error) {
+			letter := NewDeadLetter(msg)
+			if !replayable(letter, filter) {
+				return false, nil
+			}
+			if err := replayDeadLetter(ctx, target, letter); err != nil {
+				return false, err
+			}
+			replayed++
+			return true, nil
+		})
+		return replayed, err
+	}
+
+	scheduler, ok := deadLetters.(Scheduler)
+	if !ok {
+		return 0, ErrSchedulingNotSupported
+	}
+	letters, err := ListDeadLetters(ctx, deadLetters, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, letter := range letters {
+		if !replayable(letter, filter) {
+			continue
+		}
+		if err := replayDeadLetter(ctx, target, letter); err != nil {
+			return replayed, err
+		}
+		if err := scheduler.Cancel(ctx, letter.ID); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+// scanner is implemented by brokers that cannot delete a listed message but ack it while listing, see
+// PubSubBroker.scan.
+type scanner interface {
+	scan(ctx context.Context, visit func(*Message) (bool, error)) error
+}
+
+func replayable(letter *DeadLetter, filter func(*DeadLetter) bool) bool {
+	return letter.Task != nil && (filter == nil || filter(letter))
+}
+
+// replayDeadLetter sends the task of letter to target as a first attempt.
+func replayDeadLetter(ctx context.Context, target Broker, letter *DeadLetter) error {
+	task := *letter.Task
+	task.RunAt = nil
+	task.Metadata = maps.Clone(task.Metadata)
+	for _, key := range []string{MetadataAttempt, MetadataError, MetadataDeadLetterReason, MetadataFailedAt} {
+		delete(task.Metadata, key)
+	}
+	_, err := sendTask(ctx, target, task)
+	return err
+}
+
+// DeadLetterTask publishes a task that failed for good to the dead-letter broker, or only logs it when
+// there is none. taskMessage is nil when the message is malformed. The returned error nacks msg.
+func (b *Queue) DeadLetterTask(ctx context.Context, msg *Message, taskMessage *TaskMessage, reason string, cause error) error {
+	values := map[string]string{
+		MetadataDeadLetterReason: reason,
+		MetadataError:            metadataError(cause),
+		MetadataFailedAt:         time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	data := msg.Data
+	attributes := maps.Clone(msg.Attributes)
+	if attributes == nil {
+		attributes = make(map[string]string)
+	}
+	if taskMessage != nil {
+		task := *taskMessage
+		task.Metadata = maps.Clone(task.Metadata)
+		if task.Metadata == nil {
+			task.Metadata = make(map[string]string)
+		}
+		values[MetadataAttempt] = strconv.Itoa(task.Attempt())
+		maps.Copy(task.Metadata, values)
+
+		var err error
+		if data, err = json.Marshal(task); err != nil {
+			return err
+		}
+	}
+	maps.Copy(attributes, values)
+
+	logger := log.Module(log.ModuleQueue).Ctx(ctx).With(log.String("message_id", msg.ID), log.String("reason", reason))
+	if b.DeadLetter == nil {
+		logger.Error(cause, "dropped failed task, the queue has no dead-letter broker")
+		return nil
+	}
+
+	id, err := b.DeadLetter.Publish(ctx, &Message{Data: data, Attributes: attributes})
+	if err != nil {
+		logger.Error(err, "failed to dead-letter task")
+		return err
+	}
+	logger.Error(cause, "dead-lettered task", log.String("dead_letter_id", id))
+	return nil
+}
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ScheduleStore keeps the delayed messages of a DelayedBroker, e.g. a PostgresBroker or a
+// MemoryBroker.
+type ScheduleStore interface {
+	Broker
+	Scheduler
+}
+
+// DelayedBroker adds delayed delivery, Cancel and Reschedule to a broker without them such as a
+// PubSubBroker. Messages due later are published to Store and forwarded to Broker by Receive when
+// they are due, so they hold no slot of the Broker subscription meanwhile. Forwarded messages get a
+// new ID from Broker, Cancel and Reschedule take the ID returned by Publish.
+type DelayedBroker struct {
+	Broker Broker
+	Store  ScheduleStore
+}
+
+func (b *DelayedBroker) Publish(ctx context.Context, msg *Message) (string, error) {
+	if msg.RunAt.After(time.Now()) {
+		return b.Store.Publish(ctx, msg)
+	}
+	return b.Broker.Publish(ctx, msg)
+}
+
+// Receive forwards the due messages of Store to Broker while receiving from Broker.
+func (b *DelayedBroker) Receive(ctx context.Context, handler Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	receive := func(i int, broker Broker, handler Handler) {
+		defer wg.Done()
+		// stop the other receiving when one fails
+		defer cancel()
+		errs[i] = broker.Receive(ctx, handler)
+	}
+
+	wg.Add(2)
+	go receive(0, b.Store, b.forward)
+	go receive(1, b.Broker, handler)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// forward publishes a due message of Store to Broker, it is acked once published.
+func (b *DelayedBroker) forward(ctx context.Context, msg *Message) error {
+	due := msg.clone()
+	due.ID = ""
+	due.RunAt = time.Time{}
+	// publish even when the receiving stops, Store settles the message after the handler returns
+	_, err := b.Broker.Publish(context.WithoutCancel(ctx), due)
+	return err
+}
+
+// Cancel deletes a message of Store that is not due yet.
+func (b *DelayedBroker) Cancel(ctx context.Context, id string) error {
+	return b.Store.Cancel(ctx, id)
+}
+
+// Reschedule moves a message of Store that is not due yet.
+func (b *DelayedBroker) Reschedule(ctx context.Context, id string, runAt time.Time) error {
+	return b.Store.Reschedule(ctx, id, runAt)
+}
+
+func (b *DelayedBroker) Close() error {
+	return errors.Join(b.Broker.Close(), b.Store.Close())
+}
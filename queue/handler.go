@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ngtrvu/zen-go/correlation"
+)
+
+// ContextTask is a task executed with the context of the worker and the whole message, the Queue
+// calls ExecuteContext instead of Execute. See Register for tasks with a typed payload.
+type ContextTask interface {
+	TaskInterface
+	ExecuteContext(ctx context.Context, taskMessage TaskMessage) error
+}
+
+// TaskInfo describes the task being executed, see TaskInfoFromContext.
+type TaskInfo struct {
+	// ID is the message ID given by the broker.
+	ID     string
+	TaskID string
+	// Attempt counts the executions, starting at 1.
+	Attempt int
+	// EnqueuedAt is when the task was first sent, zero for tasks sent by older versions.
+	EnqueuedAt time.Time
+	// CorrelationID is the request id of the publisher.
+	CorrelationID string
+	Metadata      map[string]string
+}
+
+type taskInfoKey struct{}
+
+func newTaskInfo(msg *Message, taskMessage TaskMessage) TaskInfo {
+	enqueuedAt, _ := time.Parse(time.RFC3339Nano, taskMessage.Metadata[MetadataEnqueuedAt])
+	return TaskInfo{
+		ID:            msg.ID,
+		TaskID:        taskMessage.TaskID,
+		Attempt:       taskMessage.Attempt(),
+		EnqueuedAt:    enqueuedAt,
+		CorrelationID: taskMessage.Metadata[correlation.KeyRequestID],
+		Metadata:      taskMessage.Metadata,
+	}
+}
+
+// TaskInfoFromContext returns the task executed with ctx.
+func TaskInfoFromContext(ctx context.Context) (TaskInfo, bool) {
+	info, ok := ctx.Value(taskInfoKey{}).(TaskInfo)
+	return info, ok
+}
+
+// NewTaskMessage creates the message of a task with a JSON payload, see Register.
+func NewTaskMessage(taskID string, payload any) (TaskMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return TaskMessage{}, fmt.Errorf("failed to marshal payload of task %s: %w", taskID, err)
+	}
+	return TaskMessage{TaskID: taskID, Payload: data}, nil
+}
+
+// Register adds a task that decodes its JSON payload into T. Messages without a payload, sent with
+// Args only, are decoded from the args as a JSON array, or from their single arg as JSON, so existing
+// publishers keep working. Payloads that cannot be decoded fail permanently.
+func Register[T any](q *Queue, taskID string, handler func(ctx context.Context, payload T) error, opts ...TaskOption) {
+	q.AddTask(&typedTask[T]{Task: NewTask(taskID, TaskTypeAsync), handler: handler}, opts...)
+}
+
+type typedTask[T any] struct {
+	*Task
+	handler func(ctx context.Context, payload T) error
+}
+
+func (t *typedTask[T]) Execute(args []string) error {
+	return t.ExecuteContext(context.Background(), TaskMessage{TaskID: t.TaskID, Args: args})
+}
+
+func (t *typedTask[T]) ExecuteContext(ctx context.Context, taskMessage TaskMessage) error {
+	payload, err := decodePayload[T](taskMessage)
+	if err != nil {
+		return Permanent(fmt.Errorf("invalid payload of task %s: %w", t.TaskID, err))
+	}
+	return t.handler(ctx, payload)
+}
+
+func decodePayload[T any](taskMessage TaskMessage) (T, error) {
+	var payload T
+	if len(taskMessage.Payload) > 0 {
+		err := json.Unmarshal(taskMessage.Payload, &payload)
+		return payload, err
+	}
+
+	// a single legacy arg is the raw string, e.g. Args: []string{"hello"}
+	if raw, ok := any(&payload).(*string); ok && len(taskMessage.Args) == 1 {
+		*raw = taskMessage.Args[0]
+		return payload, nil
+	}
+
+	args, err := json.Marshal(taskMessage.Args)
+	if err != nil {
+		return payload, err
+	}
+	err = json.Unmarshal(args, &payload)
+	if err != nil && len(taskMessage.Args) == 1 {
+		var single T
+		if json.Unmarshal([]byte(taskMessage.Args[0]), &single) == nil {
+			return single, nil
+		}
+	}
+	return payload, err
+}
@@ -0,0 +1,93 @@
+package queue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/correlation"
+	"github.com/ngtrvu/zen-go/queue"
+)
+
+type emailPayload struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+type emailCall struct {
+	payload  emailPayload
+	info     queue.TaskInfo
+	deadline bool
+}
+
+func TestRegister(t *testing.T) {
+	ctx := context.Background()
+	broker := queue.NewMemoryBroker()
+	deadLetters := queue.NewMemoryBroker()
+	q := queue.NewQueueWithBroker(broker)
+	q.DeadLetter = deadLetters
+
+	calls := make(chan emailCall, 10)
+	queue.Register(q, "send_email", func(ctx context.Context, payload emailPayload) error {
+		info, ok := queue.TaskInfoFromContext(ctx)
+		assert.True(t, ok)
+		_, deadline := ctx.Deadline()
+		calls <- emailCall{payload: payload, info: info, deadline: deadline}
+		return nil
+	}, queue.WithTimeout(time.Minute))
+
+	args := make(chan []string, 10)
+	queue.Register(q, "legacy", func(ctx context.Context, payload []string) error {
+		args <- payload
+		return nil
+	})
+	arg := make(chan string, 10)
+	queue.Register(q, "legacy_string", func(ctx context.Context, payload string) error {
+		arg <- payload
+		return nil
+	})
+	startQueue(t, q)
+
+	taskMessage, err := queue.NewTaskMessage("send_email", emailPayload{To: "a@example.com", Subject: "Hello"})
+	require.NoError(t, err)
+	sendCtx := correlation.NewContext(ctx, correlation.IDs{RequestID: "req-1"})
+	id, err := q.Send(sendCtx, taskMessage)
+	require.NoError(t, err)
+
+	call := <-calls
+	assert.Equal(t, emailPayload{To: "a@example.com", Subject: "Hello"}, call.payload)
+	assert.Equal(t, id, call.info.ID)
+	assert.Equal(t, "send_email", call.info.TaskID)
+	assert.Equal(t, 1, call.info.Attempt)
+	assert.Equal(t, "req-1", call.info.CorrelationID)
+	assert.WithinDuration(t, time.Now(), call.info.EnqueuedAt, time.Second)
+	assert.True(t, call.deadline)
+
+	// messages in the args format are still readable
+	_, err = q.Send(ctx, queue.TaskMessage{TaskID: "send_email", Args: []string{`{"to":"b@example.com"}`}})
+	require.NoError(t, err)
+	call = <-calls
+	assert.Equal(t, "b@example.com", call.payload.To)
+
+	_, err = broker.Publish(ctx, &queue.Message{Data: []byte(`{"task_id":"legacy","args":["a","b"]}`)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, <-args)
+
+	for _, value := range []string{"hello", `"quoted"`, "42"} {
+		_, err = q.Send(ctx, queue.TaskMessage{TaskID: "legacy_string", Args: []string{value}})
+		require.NoError(t, err)
+		assert.Equal(t, value, <-arg)
+	}
+
+	// invalid payloads are not retried
+	_, err = q.Send(ctx, queue.TaskMessage{TaskID: "send_email", Payload: []byte(`"not an object"`)})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return deadLetters.Len() == 1 }, time.Second, 5*time.Millisecond)
+	letters, err := queue.ListDeadLetters(ctx, deadLetters, 0)
+	require.NoError(t, err)
+	assert.Equal(t, queue.DeadLetterPermanentError, letters[0].Reason)
+	assert.Contains(t, letters[0].Error, "invalid payload of task send_email")
+}
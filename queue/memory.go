@@ -0,0 +1,224 @@
+package queue
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryConcurrency is the number of messages a MemoryBroker handles at once per Receive.
+const DefaultMemoryConcurrency = 10
+
+// MemoryBroker keeps messages in memory for tests and local workers, they are lost on restart.
+// Nacked messages are redelivered at the back of the queue.
+type MemoryBroker struct {
+	// Concurrency limits the handlers running per Receive, DefaultMemoryConcurrency when 0.
+	Concurrency int
+
+	mu      sync.Mutex
+	pending []*Message
+	// scheduled holds the messages with a future RunAt, sorted by it
+	scheduled []*Message
+	inFlight  int
+	nextID    int
+
+	// wake is closed and replaced when messages are added
+	wake   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{wake: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, msg *Message) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return "", ErrBrokerClosed
+	}
+
+	b.nextID++
+	msg = msg.clone()
+	msg.ID = strconv.Itoa(b.nextID)
+	b.push(msg)
+	return msg.ID, nil
+}
+
+func (b *MemoryBroker) Receive(ctx context.Context, handler Handler) error {
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultMemoryConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		case <-b.done:
+			return nil
+		}
+
+		msg, wake, next := b.pop()
+		for msg == nil {
+			if !b.wait(ctx, wake, next) {
+				return nil
+			}
+			msg, wake, next = b.pop()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			err := handler(ctx, msg.clone())
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.inFlight--
+			if err != nil && !b.closed {
+				msg.RunAt = time.Time{}
+				b.push(msg)
+			}
+		}()
+	}
+}
+
+// wait blocks until wake is closed or next is due, it returns false when Receive must stop.
+func (b *MemoryBroker) wait(ctx context.Context, wake <-chan struct{}, next time.Time) bool {
+	var due <-chan time.Time
+	if !next.IsZero() {
+		timer := time.NewTimer(time.Until(next))
+		defer timer.Stop()
+		due = timer.C
+	}
+
+	select {
+	case <-wake:
+	case <-due:
+	case <-ctx.Done():
+		return false
+	case <-b.done:
+		return false
+	}
+	return true
+}
+
+// Cancel deletes a pending or scheduled message.
+func (b *MemoryBroker) Cancel(ctx context.Context, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.remove(id); !ok {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// Reschedule moves a pending or scheduled message to runAt.
+func (b *MemoryBroker) Reschedule(ctx context.Context, id string, runAt time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg, ok := b.remove(id)
+	if !ok {
+		return ErrMessageNotFound
+	}
+	msg.RunAt = runAt
+	b.push(msg)
+	return nil
+}
+
+// Browse lists the pending messages followed by the scheduled ones.
+func (b *MemoryBroker) Browse(ctx context.Context, limit int) ([]*Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []*Message
+	for _, msg := range slices.Concat(b.pending, b.scheduled) {
+		if limit > 0 && len(messages) == limit {
+			break
+		}
+		messages = append(messages, msg.clone())
+	}
+	return messages, nil
+}
+
+// Len is the number of messages not acked yet, including the scheduled ones and those being handled.
+func (b *MemoryBroker) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending) + len(b.scheduled) + b.inFlight
+}
+
+// Close stops Receive, the pending messages are dropped.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+	return nil
+}
+
+// push must be called with mu held.
+func (b *MemoryBroker) push(msg *Message) {
+	if msg.RunAt.After(time.Now()) {
+		i, _ := slices.BinarySearchFunc(b.scheduled, msg.RunAt, func(m *Message, runAt time.Time) int {
+			// keep the publish order of messages due at the same time
+			if m.RunAt.After(runAt) {
+				return 1
+			}
+			return -1
+		})
+		b.scheduled = slices.Insert(b.scheduled, i, msg)
+	} else {
+		b.pending = append(b.pending, msg)
+	}
+	close(b.wake)
+	b.wake = make(chan struct{})
+}
+
+// remove must be called with mu held.
+func (b *MemoryBroker) remove(id string) (*Message, bool) {
+	for _, list := range []*[]*Message{&b.pending, &b.scheduled} {
+		i := slices.IndexFunc(*list, func(m *Message) bool { return m.ID == id })
+		if i >= 0 {
+			msg := (*list)[i]
+			*list = slices.Delete(*list, i, i+1)
+			return msg, true
+		}
+	}
+	return nil, false
+}
+
+// pop returns the next ready message, or nil, a channel closed when one is added and the time the
+// next scheduled message is due.
+func (b *MemoryBroker) pop() (*Message, <-chan struct{}, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for len(b.scheduled) > 0 && !b.scheduled[0].RunAt.After(now) {
+		b.pending = append(b.pending, b.scheduled[0])
+		b.scheduled = b.scheduled[1:]
+	}
+	if len(b.pending) == 0 {
+		var next time.Time
+		if len(b.scheduled) > 0 {
+			next = b.scheduled[0].RunAt
+		}
+		return nil, b.wake, next
+	}
+
+	msg := b.pending[0]
+	b.pending = b.pending[1:]
+	b.inFlight++
+	return msg, nil, time.Time{}
+}
@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"sync"
+
+	"github.com/ngtrvu/zen-go/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const LabelTaskID = "task_id"
+
+var (
+	queueCountersOnce sync.Once
+	unknownTasks      *metrics.Counter
+	taskPanics        *metrics.Counter
+)
+
+// registerCounters registers the metrics on first use, so importing the package does not add them.
+func registerCounters() {
+	queueCountersOnce.Do(func() {
+		// unknown task ids come from the messages, they are not a label to bound the series
+		unknownTasks = metrics.NewCounterFrom(prometheus.CounterOpts{
+			Name: "queue_unknown_tasks_total",
+			Help: "number of received tasks with an id that was not added to the queue",
+		}, nil)
+		taskPanics = metrics.NewCounterFrom(prometheus.CounterOpts{
+			Name: "queue_task_panics_total",
+			Help: "number of task executions that panicked",
+		}, []string{LabelTaskID})
+	})
+}
+
+func unknownTaskCounter() *metrics.Counter {
+	registerCounters()
+	return unknownTasks
+}
+
+func taskPanicCounter() *metrics.Counter {
+	registerCounters()
+	return taskPanics
+}
@@ -0,0 +1,339 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ngtrvu/zen-go/log"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPostgresTable             = "queue_messages"
+	DefaultPostgresQueue             = "default"
+	DefaultPostgresPollInterval      = time.Second
+	DefaultPostgresVisibilityTimeout = 5 * time.Minute
+	DefaultPostgresBatchSize         = 10
+)
+
+var tableNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+
+// PostgresOptions configures a PostgresBroker, zero values use the defaults.
+type PostgresOptions struct {
+	// Table holds the messages, see PostgresBroker.Migrate.
+	Table string
+	// Queue names the queue in Table so several queues can share it.
+	Queue string
+
+	// PollInterval is the wait between polls when the queue is empty.
+	PollInterval time.Duration
+	// VisibilityTimeout is how long a received message is hidden from other workers, messages of
+	// crashed workers are redelivered after it. The lease is extended while the handler runs.
+	VisibilityTimeout time.Duration
+	// BatchSize is the number of messages claimed per poll, it also bounds the running handlers.
+	BatchSize int
+}
+
+// PostgresBroker stores messages in a PostgreSQL table, workers claim them with SELECT ... FOR UPDATE
+// SKIP LOCKED so they never block each other nor receive the same message. Each claim sets a lock
+// token, a worker only extends, acks or nacks the messages it still holds.
+type PostgresBroker struct {
+	db   *gorm.DB
+	opts PostgresOptions
+}
+
+type postgresMessage struct {
+	ID         string
+	Data       []byte
+	Attributes []byte
+	RunAt      time.Time
+}
+
+func NewPostgresBroker(db *gorm.DB, opts PostgresOptions) (*PostgresBroker, error) {
+	if opts.Table == "" {
+		opts.Table = DefaultPostgresTable
+	}
+	if !tableNamePattern.MatchString(opts.Table) {
+		return nil, fmt.Errorf("queue: invalid postgres table %q", opts.Table)
+	}
+	if opts.Queue == "" {
+		opts.Queue = DefaultPostgresQueue
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPostgresPollInterval
+	}
+	if opts.VisibilityTimeout <= 0 {
+		opts.VisibilityTimeout = DefaultPostgresVisibilityTimeout
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultPostgresBatchSize
+	}
+
+	return &PostgresBroker{db: db, opts: opts}, nil
+}
+
+// Migrate creates the table of the messages when it does not exist, or run the same statements in
+// the migrations of the service.
+func (b *PostgresBroker) Migrate(ctx context.Context) error {
+	return b.db.WithContext(ctx).Exec(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %[1]s (
+	id uuid PRIMARY KEY,
+	queue text NOT NULL,
+	data bytea NOT NULL,
+	attributes jsonb NOT NULL DEFAULT '{}',
+	run_at timestamptz NOT NULL DEFAULT now(),
+	locked_until timestamptz,
+	lock_token uuid,
+	created_at timestamptz NOT NULL DEFAULT now()
+);
+ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS lock_token uuid;
+CREATE INDEX IF NOT EXISTS %[2]s_ready_idx ON %[1]s (queue, run_at);`, b.opts.Table, indexPrefix(b.opts.Table))).Error
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, msg *Message) (string, error) {
+	attributes, err := json.Marshal(msg.Attributes)
+	if err != nil {
+		return "", err
+	}
+
+	var runAt *time.Time
+	if !msg.RunAt.IsZero() {
+		runAt = &msg.RunAt
+	}
+
+	id := uuid.NewString()
+	err = b.db.WithContext(ctx).Exec(
+		fmt.Sprintf("INSERT INTO %s (id, queue, data, attributes, run_at) VALUES (?, ?, ?, ?, COALESCE(?, now()))", b.opts.Table),
+		id, b.opts.Queue, msg.Data, string(attributes), runAt,
+	).Error
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func (b *PostgresBroker) Receive(ctx context.Context, handler Handler) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// slots bounds the running handlers to one batch
+	slots := make(chan struct{}, b.opts.BatchSize)
+	for {
+		free := cap(slots) - len(slots)
+		messages, err := b.claim(ctx, free)
+		if ctx.Err() != nil {
+			// the claim may have locked messages that are not handled
+			b.release(ctx, messages.token)
+			return nil
+		}
+		if err != nil {
+			log.Module(log.ModuleQueue).Error(err, "failed to claim messages")
+		}
+
+		for _, message := range messages.messages {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				b.handle(ctx, handler, message, messages.token)
+			}()
+		}
+
+		// poll again right away while the queue has messages and handlers are free
+		if err == nil && len(messages.messages) == free && free > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(b.opts.PollInterval):
+		}
+	}
+}
+
+// claimed are the messages locked by a claim under token.
+type claimed struct {
+	token    string
+	messages []postgresMessage
+}
+
+// claim locks up to limit ready messages for the visibility timeout.
+func (b *PostgresBroker) claim(ctx context.Context, limit int) (claimed, error) {
+	if limit <= 0 {
+		return claimed{}, nil
+	}
+
+	c := claimed{token: uuid.NewString()}
+	err := b.db.WithContext(ctx).Raw(fmt.Sprintf(`
+UPDATE %[1]s SET locked_until = now() + ? * interval '1 millisecond', lock_token = ?
+WHERE id IN (
+	SELECT id FROM %[1]s
+	WHERE queue = ? AND run_at <= now() AND (locked_until IS NULL OR locked_until < now())
+	ORDER BY run_at, created_at
+	LIMIT ?
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, data, attributes, run_at`, b.opts.Table),
+		b.opts.VisibilityTimeout.Milliseconds(), c.token, b.opts.Queue, limit,
+	).Scan(&c.messages).Error
+	return c, err
+}
+
+// release unlocks the messages of a claim that are not handled, they are redelivered without waiting
+// for the visibility timeout.
+func (b *PostgresBroker) release(ctx context.Context, token string) {
+	if token == "" {
+		return
+	}
+	err := b.db.WithContext(context.WithoutCancel(ctx)).Exec(
+		fmt.Sprintf("UPDATE %s SET locked_until = NULL, lock_token = NULL WHERE lock_token = ?", b.opts.Table),
+		token,
+	).Error
+	if err != nil {
+		log.Module(log.ModuleQueue).Error(err, "failed to release claimed messages")
+	}
+}
+
+// handle deletes the message when handler succeeds and unlocks it for redelivery otherwise. The lease
+// is extended while handler runs, the message is left alone once another worker claimed it.
+func (b *PostgresBroker) handle(ctx context.Context, handler Handler, message postgresMessage, token string) {
+	logger := log.Module(log.ModuleQueue).With(log.String("message_id", message.ID))
+
+	// keep the lease of handlers that outlive the receiving
+	extendCtx, stopExtending := context.WithCancel(context.WithoutCancel(ctx))
+	extended := make(chan struct{})
+	go func() {
+		defer close(extended)
+		b.extend(extendCtx, message.ID, token)
+	}()
+
+	handlerErr := handler(ctx, message.message())
+	stopExtending()
+	<-extended
+
+	// settle the message even when ctx is cancelled while the handler runs
+	db := b.db.WithContext(context.WithoutCancel(ctx))
+	var result *gorm.DB
+	if handlerErr == nil {
+		result = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ? AND lock_token = ?", b.opts.Table), message.ID, token)
+	} else {
+		result = db.Exec(
+			fmt.Sprintf("UPDATE %s SET locked_until = NULL, lock_token = NULL WHERE id = ? AND lock_token = ?", b.opts.Table),
+			message.ID, token,
+		)
+	}
+	if result.Error != nil {
+		logger.Error(result.Error, "failed to settle message")
+	} else if result.RowsAffected == 0 {
+		logger.Error(errLeaseLost, "failed to settle message")
+	}
+}
+
+// errLeaseLost is logged when the lock of a handled message expired and another worker claimed it.
+var errLeaseLost = errors.New("queue: message lease lost")
+
+// extend renews the lock of a message every third of the visibility timeout until ctx is done or the
+// lock is lost.
+func (b *PostgresBroker) extend(ctx context.Context, id string, token string) {
+	ticker := time.NewTicker(b.opts.VisibilityTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result := b.db.WithContext(ctx).Exec(
+			fmt.Sprintf("UPDATE %s SET locked_until = now() + ? * interval '1 millisecond' WHERE id = ? AND lock_token = ?", b.opts.Table),
+			b.opts.VisibilityTimeout.Milliseconds(), id, token,
+		)
+		if ctx.Err() != nil {
+			return
+		}
+		if result.Error != nil {
+			log.Module(log.ModuleQueue).Error(result.Error, "failed to extend message lease", log.String("message_id", id))
+			continue
+		}
+		if result.RowsAffected == 0 {
+			log.Module(log.ModuleQueue).Error(errLeaseLost, "failed to extend message lease", log.String("message_id", id))
+			return
+		}
+	}
+}
+
+// Cancel deletes a message that is not being handled.
+func (b *PostgresBroker) Cancel(ctx context.Context, id string) error {
+	return b.updatePending(ctx, "DELETE FROM %s", id)
+}
+
+// Reschedule moves a message that is not being handled to runAt.
+func (b *PostgresBroker) Reschedule(ctx context.Context, id string, runAt time.Time) error {
+	return b.updatePending(ctx, "UPDATE %s SET run_at = ?", id, runAt)
+}
+
+// Browse lists the messages that are not being handled.
+func (b *PostgresBroker) Browse(ctx context.Context, limit int) ([]*Message, error) {
+	query := b.db.WithContext(ctx).Table(b.opts.Table).
+		Select("id, data, attributes, run_at").
+		Where("queue = ? AND (locked_until IS NULL OR locked_until < now())", b.opts.Queue).
+		Order("created_at, id")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var rows []postgresMessage
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	messages := make([]*Message, 0, len(rows))
+	for _, row := range rows {
+		messages = append(messages, row.message())
+	}
+	return messages, nil
+}
+
+// updatePending runs the statement on the message id unless it is locked by a worker.
+func (b *PostgresBroker) updatePending(ctx context.Context, statement string, id string, values ...any) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrMessageNotFound
+	}
+
+	result := b.db.WithContext(ctx).Exec(
+		fmt.Sprintf(statement, b.opts.Table)+" WHERE id = ? AND queue = ? AND (locked_until IS NULL OR locked_until < now())",
+		append(values, id, b.opts.Queue)...,
+	)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// Close does not close the database, its owner does.
+func (b *PostgresBroker) Close() error {
+	return nil
+}
+
+func (m postgresMessage) message() *Message {
+	msg := &Message{ID: m.ID, Data: m.Data, RunAt: m.RunAt}
+	if err := json.Unmarshal(m.Attributes, &msg.Attributes); err != nil {
+		log.Module(log.ModuleQueue).Error(err, "invalid message attributes", log.String("message_id", m.ID))
+	}
+	return msg
+}
+
+// indexPrefix names the indexes of a table, dropping its schema.
+func indexPrefix(table string) string {
+	return table[strings.LastIndex(table, ".")+1:]
+}
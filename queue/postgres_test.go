@@ -0,0 +1,175 @@
+package queue_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/ngtrvu/zen-go/queue"
+)
+
+// lockToken matches the lock token of a claim and every later statement using it.
+type lockToken struct {
+	value driver.Value
+}
+
+func (t *lockToken) Match(v driver.Value) bool {
+	if t.value == nil {
+		t.value = v
+		return v != nil
+	}
+	return v == t.value
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	require.NoError(t, err)
+	return db, mock
+}
+
+func newMockPostgresBroker(t *testing.T, opts queue.PostgresOptions) (*queue.PostgresBroker, sqlmock.Sqlmock) {
+	db, mock := newMockDB(t)
+
+	opts.PollInterval = time.Hour
+	opts.BatchSize = 1
+	b, err := queue.NewPostgresBroker(db, opts)
+	require.NoError(t, err)
+	return b, mock
+}
+
+func expectClaim(mock sqlmock.Sqlmock, token *lockToken, visibilityTimeout time.Duration) {
+	mock.ExpectQuery(`UPDATE queue_messages SET locked_until = now\(\) \+ \$1 \* interval '1 millisecond', lock_token = \$2`).
+		WithArgs(visibilityTimeout.Milliseconds(), token, queue.DefaultPostgresQueue, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "data", "attributes", "run_at"}).
+			AddRow("0d9f7a52-7c6e-4f4e-9a53-6f3b2f1e0c11", []byte("hello"), []byte(`{}`), time.Now()))
+}
+
+// receiveOne runs Receive until handler returned and the message is settled.
+func receiveOne(t *testing.T, b *queue.PostgresBroker, handler queue.Handler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- b.Receive(ctx, func(ctx context.Context, msg *queue.Message) error {
+			defer cancel()
+			assert.Equal(t, "hello", string(msg.Data))
+			return handler(ctx, msg)
+		})
+	}()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Receive did not return")
+	}
+}
+
+func TestPostgresBrokerSettle(t *testing.T) {
+	t.Run("Ack", func(t *testing.T) {
+		b, mock := newMockPostgresBroker(t, queue.PostgresOptions{})
+		token := &lockToken{}
+		expectClaim(mock, token, queue.DefaultPostgresVisibilityTimeout)
+		mock.ExpectExec(`DELETE FROM queue_messages WHERE id = \$1 AND lock_token = \$2`).
+			WithArgs("0d9f7a52-7c6e-4f4e-9a53-6f3b2f1e0c11", token).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		receiveOne(t, b, func(context.Context, *queue.Message) error { return nil })
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Nack", func(t *testing.T) {
+		b, mock := newMockPostgresBroker(t, queue.PostgresOptions{})
+		token := &lockToken{}
+		expectClaim(mock, token, queue.DefaultPostgresVisibilityTimeout)
+		mock.ExpectExec(`UPDATE queue_messages SET locked_until = NULL, lock_token = NULL WHERE id = \$1 AND lock_token = \$2`).
+			WithArgs("0d9f7a52-7c6e-4f4e-9a53-6f3b2f1e0c11", token).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		receiveOne(t, b, func(context.Context, *queue.Message) error { return assert.AnError })
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPostgresBrokerReleasesClaimOnCancel(t *testing.T) {
+	b, mock := newMockPostgresBroker(t, queue.PostgresOptions{})
+	token := &lockToken{}
+	mock.ExpectQuery(`UPDATE queue_messages SET locked_until = now\(\) \+ \$1 \* interval '1 millisecond', lock_token = \$2`).
+		WithArgs(queue.DefaultPostgresVisibilityTimeout.Milliseconds(), token, queue.DefaultPostgresQueue, 1).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "data", "attributes", "run_at"}))
+	// the cancelled claim may have been committed, its locks are released
+	mock.ExpectExec(`UPDATE queue_messages SET locked_until = NULL, lock_token = NULL WHERE lock_token = \$1`).
+		WithArgs(token).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, b.Receive(ctx, func(context.Context, *queue.Message) error {
+		t.Error("the released message is not handled")
+		return nil
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresBrokerLease(t *testing.T) {
+	const visibilityTimeout = 60 * time.Millisecond
+	b, mock := newMockPostgresBroker(t, queue.PostgresOptions{VisibilityTimeout: visibilityTimeout})
+	token := &lockToken{}
+	expectClaim(mock, token, visibilityTimeout)
+	extend := `UPDATE queue_messages SET locked_until = now\(\) \+ \$1 \* interval '1 millisecond' WHERE id = \$2 AND lock_token = \$3`
+	mock.ExpectExec(extend).
+		WithArgs(visibilityTimeout.Milliseconds(), "0d9f7a52-7c6e-4f4e-9a53-6f3b2f1e0c11", token).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// another worker claimed the message, the lease is no longer extended
+	mock.ExpectExec(extend).
+		WithArgs(visibilityTimeout.Milliseconds(), "0d9f7a52-7c6e-4f4e-9a53-6f3b2f1e0c11", token).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// and the ack leaves the message of the other worker alone
+	mock.ExpectExec(`DELETE FROM queue_messages WHERE id = \$1 AND lock_token = \$2`).
+		WithArgs("0d9f7a52-7c6e-4f4e-9a53-6f3b2f1e0c11", token).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	receiveOne(t, b, func(context.Context, *queue.Message) error {
+		time.Sleep(4 * visibilityTimeout)
+		return nil
+	})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNewQueueWithConfig(t *testing.T) {
+	ctx := context.Background()
+	queue.SetDefaultBroker(nil)
+	defer queue.SetDefaultBroker(nil)
+
+	cfg := queue.QueueConfig{Backend: queue.BackendPostgres, SubName: "emails", DeadLetterName: "emails-dead", Concurrency: 4}
+	_, err := queue.NewQueueWithConfig(ctx, cfg, nil)
+	assert.Error(t, err)
+	assert.Panics(t, func() { queue.NewQueue(ctx, cfg) })
+
+	db, mock := newMockDB(t)
+	q, err := queue.NewQueueWithConfig(ctx, cfg, db)
+	require.NoError(t, err)
+	assert.IsType(t, &queue.PostgresBroker{}, q.Broker)
+	assert.IsType(t, &queue.PostgresBroker{}, q.DeadLetter)
+	assert.Equal(t, 4, q.Concurrency)
+
+	// the queue broker is the default broker of SendDelayTask
+	mock.ExpectExec(`INSERT INTO queue_messages`).
+		WithArgs(sqlmock.AnyArg(), "emails", sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = queue.SendDelayTask(ctx, queue.TaskMessage{TaskID: "send_email"})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
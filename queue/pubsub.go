@@ -2,51 +2,303 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/pubsub"
 	"github.com/ngtrvu/zen-go/log"
 )
 
+const (
+	// AttributeRunAt carries Message.RunAt in the Pub/Sub attributes, as RFC 3339.
+	AttributeRunAt = "x-run-at"
+	// DefaultPubSubMaxHold is how long a PubSubBroker holds a message that is not due yet.
+	DefaultPubSubMaxHold = time.Minute
+	// DefaultPubSubBrowseIdle is how long Browse waits for more messages.
+	DefaultPubSubBrowseIdle = 2 * time.Second
+)
+
+// Publisher is the topic of SendDelayTask set by InitPublisher.
 var Publisher *pubsub.Topic
 
-func InitPublisher(ctx context.Context, projectID, topic string) {
-	if Publisher == nil {
-		client, err := pubsub.NewClient(ctx, projectID)
-		if err != nil {
-			log.Error("failed to create pubsub client: %v", err)
-			panic(fmt.Sprintf("failed to create pubsub client: %v", err))
-		}
+// PubSubBroker publishes to a Google Pub/Sub topic and receives from a subscription of it.
+//
+// Pub/Sub has no delayed delivery: a message received before its RunAt is held until then, the client
+// extending its lease, for at most MaxHold and nacked after it to be held again on redelivery. Held
+// messages count against ReceiveSettings.MaxOutstandingMessages, only delays within the message
+// retention work and pending messages cannot be cancelled nor rescheduled. Wrap the broker in a
+// DelayedBroker to keep the delayed messages, including retries, in a scheduling table instead, see
+// NewBroker.
+type PubSubBroker struct {
+	// MaxHold bounds how long a message is held before its RunAt, DefaultPubSubMaxHold when 0. Keep
+	// it below ReceiveSettings.MaxExtension.
+	MaxHold time.Duration
+	// BrowseIdle ends Browse when no new message arrived for it, DefaultPubSubBrowseIdle when 0.
+	BrowseIdle time.Duration
+	// ReceiveSettings configures the subscription on Receive, zero values use the client defaults.
+	ReceiveSettings pubsub.ReceiveSettings
 
-		Publisher = client.Topic(topic)
-	}
+	client     *pubsub.Client
+	ownsClient bool
+	topic      *pubsub.Topic
+	subName    string
 }
 
-func SendDelayTask(ctx context.Context, taskMessage TaskMessage) (string, error) {
-	if Publisher == nil {
-		log.Error("Publisher is not initialized")
-		return "", fmt.Errorf("Publisher is not initialized")
+// NewPubSubBroker creates a client for cfg.ProjectID, Close releases it.
+func NewPubSubBroker(ctx context.Context, cfg QueueConfig) (*PubSubBroker, error) {
+	client, err := pubsub.NewClient(ctx, cfg.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pubsub client: %w", err)
 	}
 
-	log.Info("AddTask %v", taskMessage)
+	b := NewPubSubBrokerWithClient(client, cfg.TopicName, cfg.SubName)
+	b.ownsClient = true
+	return b, nil
+}
 
-	taskData, err := json.Marshal(taskMessage)
-	if err != nil {
-		log.Error("failed to marshal task: %v", err)
-		return "", err
+// NewPubSubBrokerWithClient uses a client owned by the caller, Close does not close it.
+func NewPubSubBrokerWithClient(client *pubsub.Client, topicName string, subName string) *PubSubBroker {
+	return &PubSubBroker{client: client, topic: client.Topic(topicName), subName: subName}
+}
+
+func (b *PubSubBroker) Publish(ctx context.Context, msg *Message) (string, error) {
+	attributes := msg.Attributes
+	if !msg.RunAt.IsZero() {
+		attributes = maps.Clone(attributes)
+		if attributes == nil {
+			attributes = make(map[string]string)
+		}
+		attributes[AttributeRunAt] = msg.RunAt.UTC().Format(time.RFC3339Nano)
 	}
 
-	result := Publisher.Publish(ctx, &pubsub.Message{
-		Data: taskData,
+	result := b.topic.Publish(ctx, &pubsub.Message{
+		Data:       msg.Data,
+		Attributes: attributes,
 	})
 
 	// Get the result and handle any errors
-	id, err := result.Get(ctx)
+	return result.Get(ctx)
+}
+
+func (b *PubSubBroker) Receive(ctx context.Context, handler Handler) error {
+	if b.subName == "" {
+		return errors.New("queue: pubsub broker has no subscription")
+	}
+
+	// a subscription handle receives once at a time
+	sub := b.client.Subscription(b.subName)
+	sub.ReceiveSettings = b.ReceiveSettings
+	err := sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		message := newPubSubMessage(msg)
+		if !b.hold(ctx, message.RunAt) {
+			msg.Nack()
+			return
+		}
+
+		if err := handler(ctx, message); err != nil {
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// Browse receives the outstanding messages without acking them and returns the limit first ones by
+// publish time, all of them when limit is 0. They are held until no new message arrived for
+// BrowseIdle and nacked, so they are redelivered right away. The messages a Receive of the same
+// subscription takes meanwhile are missed, browse subscriptions without workers such as the dead
+// letters of a Queue.
+func (b *PubSubBroker) Browse(ctx context.Context, limit int) ([]*Message, error) {
+	var received []*pubsub.Message
+	err := b.receiveHeld(ctx, func(msg *pubsub.Message) (bool, error) {
+		received = append(received, msg)
+		return false, nil
+	})
 	if err != nil {
-		log.Error("failed to publish message: %v", err)
-		return "", err
+		return nil, err
+	}
+
+	slices.SortStableFunc(received, func(a, b *pubsub.Message) int {
+		return a.PublishTime.Compare(b.PublishTime)
+	})
+	if limit > 0 && len(received) > limit {
+		received = received[:limit]
+	}
+	messages := make([]*Message, 0, len(received))
+	for _, msg := range received {
+		messages = append(messages, newPubSubMessage(msg))
+	}
+	return messages, nil
+}
+
+// scan receives the outstanding messages and calls visit for each one at a time. The messages visit
+// acks are acked, the others are held until the scan ends and nacked. It ends when visit fails or no
+// new message arrived for BrowseIdle.
+func (b *PubSubBroker) scan(ctx context.Context, visit func(*Message) (bool, error)) error {
+	return b.receiveHeld(ctx, func(msg *pubsub.Message) (bool, error) {
+		return visit(newPubSubMessage(msg))
+	})
+}
+
+func (b *PubSubBroker) receiveHeld(ctx context.Context, visit func(*pubsub.Message) (bool, error)) error {
+	if b.subName == "" {
+		return errors.New("queue: pubsub broker has no subscription")
+	}
+	idle := b.BrowseIdle
+	if idle <= 0 {
+		idle = DefaultPubSubBrowseIdle
+	}
+
+	receiveCtx, cancelReceive := context.WithCancel(ctx)
+	defer cancelReceive()
+
+	sub := b.client.Subscription(b.subName)
+	sub.ReceiveSettings = b.ReceiveSettings
+	// every held message is outstanding
+	sub.ReceiveSettings.MaxOutstandingMessages = -1
+	sub.ReceiveSettings.MaxOutstandingBytes = -1
+	// unary pulls, a streaming pull leases the nacked messages to the closing stream
+	sub.ReceiveSettings.Synchronous = true
+
+	var (
+		mu       sync.Mutex
+		seen     = make(map[string]bool)
+		visitErr error
+		held     sync.WaitGroup
+		released bool
+		release  = make(chan struct{})
+	)
+	// releaseLocked ends the scan, the held messages are nacked before the receiving stops so the
+	// client sends the nacks
+	releaseLocked := func() {
+		if !released {
+			released = true
+			close(release)
+		}
+	}
+	timer := time.AfterFunc(idle, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		releaseLocked()
+	})
+	defer timer.Stop()
+	go func() {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			mu.Lock()
+			releaseLocked()
+			mu.Unlock()
+		}
+		held.Wait()
+		cancelReceive()
+	}()
+
+	err := sub.Receive(receiveCtx, func(_ context.Context, msg *pubsub.Message) {
+		mu.Lock()
+		if released || seen[msg.ID] {
+			mu.Unlock()
+			msg.Nack()
+			return
+		}
+		seen[msg.ID] = true
+		held.Add(1)
+		defer held.Done()
+		timer.Reset(idle)
+		ack, err := visit(msg)
+		if err != nil {
+			visitErr = err
+			releaseLocked()
+		}
+		mu.Unlock()
+
+		if ack {
+			msg.Ack()
+			return
+		}
+		<-release
+		msg.Nack()
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	releaseLocked()
+	if visitErr != nil {
+		return visitErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// newPubSubMessage reads Message.RunAt from the attributes of msg.
+func newPubSubMessage(msg *pubsub.Message) *Message {
+	message := &Message{ID: msg.ID, Data: msg.Data, Attributes: msg.Attributes}
+	if value, ok := msg.Attributes[AttributeRunAt]; ok {
+		message.Attributes = maps.Clone(msg.Attributes)
+		delete(message.Attributes, AttributeRunAt)
+		runAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			log.Module(log.ModuleQueue).Error(err, "invalid message run at", log.String("message_id", msg.ID))
+		}
+		message.RunAt = runAt
+	}
+	return message
+}
+
+// hold waits until runAt, it returns false when runAt is after MaxHold or ctx is done first.
+func (b *PubSubBroker) hold(ctx context.Context, runAt time.Time) bool {
+	wait := time.Until(runAt)
+	if wait <= 0 {
+		return true
+	}
+	maxHold := b.MaxHold
+	if maxHold <= 0 {
+		maxHold = DefaultPubSubMaxHold
 	}
 
-	return id, nil
+	timer := time.NewTimer(min(wait, maxHold))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait <= maxHold
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Close flushes the pending publishes and closes the client when the broker created it.
+func (b *PubSubBroker) Close() error {
+	b.topic.Stop()
+	if b.ownsClient {
+		return b.client.Close()
+	}
+	return nil
+}
+
+// InitPublisher makes SendDelayTask publish to a Pub/Sub topic, it panics when the client cannot be
+// created. Prefer SetDefaultBroker.
+func InitPublisher(ctx context.Context, projectID, topic string) {
+	if Publisher == nil {
+		client, err := pubsub.NewClient(ctx, projectID)
+		if err != nil {
+			log.Error("failed to create pubsub client: %v", err)
+			panic(fmt.Sprintf("failed to create pubsub client: %v", err))
+		}
+
+		Publisher = client.Topic(topic)
+		SetDefaultBroker(&PubSubBroker{topic: Publisher})
+	}
 }
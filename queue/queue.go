@@ -3,69 +3,420 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
 
-	"cloud.google.com/go/pubsub"
+	"github.com/ngtrvu/zen-go/correlation"
 	"github.com/ngtrvu/zen-go/log"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+var (
+	defaultBrokerMu sync.RWMutex
+	defaultBroker   Broker
 )
 
 type Queue struct {
-	Subscriber *pubsub.Subscription
-	Tasks      map[string]TaskInterface
+	Broker Broker
+	Tasks  map[string]TaskInterface
+
+	// RetryPolicy applies to the tasks added without WithRetryPolicy, DefaultRetryPolicy when zero.
+	RetryPolicy RetryPolicy
+	// DeadLetter receives the tasks that failed for good, they are only logged when nil.
+	DeadLetter Broker
+	// OnUnknownTask handles the tasks with an id that was not added, returning nil acks them. They
+	// are logged and dead-lettered when nil, see DeadLetterTask.
+	OnUnknownTask func(ctx context.Context, msg *Message, taskMessage TaskMessage) error
+	// Concurrency bounds the tasks running at once, the broker bounds the messages received at once,
+	// see QueueConfig.MaxOutstanding.
+	Concurrency int
+
+	options map[string]taskOptions
+
+	mu      sync.Mutex
+	workers map[*worker]struct{}
+}
+
+// TaskOption configures a task added to a Queue.
+type TaskOption func(*taskOptions)
+
+type taskOptions struct {
+	retryPolicy *RetryPolicy
+	timeout     time.Duration
+	slots       chan struct{}
+	limiter     *rate.Limiter
 }
 
+// WithRetryPolicy overrides the retry policy of the queue for a task.
+func WithRetryPolicy(policy RetryPolicy) TaskOption {
+	return func(o *taskOptions) {
+		o.retryPolicy = &policy
+	}
+}
+
+// WithTimeout bounds the executions of a task, its context is cancelled after timeout. Only a
+// ContextTask can honour it.
+func WithTimeout(timeout time.Duration) TaskOption {
+	return func(o *taskOptions) {
+		o.timeout = timeout
+	}
+}
+
+// NewQueue creates the broker selected by cfg.Backend and makes it the default broker of SendDelayTask
+// when there is none. It panics when the broker cannot be created and it has no database for the
+// postgres backend, prefer NewQueueWithConfig.
 func NewQueue(ctx context.Context, cfg QueueConfig) *Queue {
-	client, err := pubsub.NewClient(ctx, cfg.ProjectID)
+	q, err := NewQueueWithConfig(ctx, cfg, nil)
 	if err != nil {
-		log.Error("failed to create pubsub client: %v", err)
-		panic(fmt.Sprintf("failed to create pubsub client: %v", err))
+		log.Error("failed to create queue: %v", err)
+		panic(fmt.Sprintf("failed to create queue: %v", err))
 	}
+	return q
+}
 
-	InitPublisher(ctx, cfg.ProjectID, cfg.TopicName)
+// NewQueueWithConfig creates the broker selected by cfg.Backend with NewBroker, the dead-letter broker
+// of cfg.DeadLetterName and applies cfg.Concurrency. The broker becomes the default broker of
+// SendDelayTask when there is none. db is required by the postgres backend and enables delayed tasks
+// on Pub/Sub, it may be nil otherwise.
+func NewQueueWithConfig(ctx context.Context, cfg QueueConfig, db *gorm.DB) (*Queue, error) {
+	broker, err := NewBroker(ctx, cfg, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create queue broker: %w", err)
+	}
+
+	q := NewQueueWithBroker(broker)
+	q.Concurrency = cfg.Concurrency
+	if cfg.DeadLetterName != "" {
+		deadLetterCfg := cfg
+		deadLetterCfg.TopicName = cfg.DeadLetterName
+		deadLetterCfg.SubName = cfg.DeadLetterName
+		deadLetterDB := db
+		if cfg.Backend == BackendPubSub || cfg.Backend == "" {
+			// dead letters are never delayed, a bare PubSubBroker lists and replays them
+			deadLetterDB = nil
+		}
+		q.DeadLetter, err = NewBroker(ctx, deadLetterCfg, deadLetterDB)
+		if err != nil {
+			broker.Close()
+			return nil, fmt.Errorf("failed to create dead-letter broker: %w", err)
+		}
+	}
 
-	sub := client.Subscription(cfg.SubName)
-	tasks := make(map[string]TaskInterface)
+	defaultBrokerMu.Lock()
+	if defaultBroker == nil {
+		defaultBroker = broker
+		if pubsubBroker, ok := broker.(*PubSubBroker); ok && Publisher == nil {
+			Publisher = pubsubBroker.topic
+		}
+	}
+	defaultBrokerMu.Unlock()
 
-	return &Queue{Subscriber: sub, Tasks: tasks}
+	return q, nil
 }
 
+// NewQueueWithBroker creates a queue receiving from broker, the options of QueueConfig such as
+// Concurrency and DeadLetter are set on the returned Queue.
+func NewQueueWithBroker(broker Broker) *Queue {
+	return &Queue{Broker: broker, Tasks: make(map[string]TaskInterface), options: make(map[string]taskOptions)}
+}
+
+// Start receives and executes tasks until ctx is cancelled or Stop is called, then waits for the
+// running tasks.
 func (b *Queue) Start(ctx context.Context) {
-	err := b.Subscriber.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
-		log.Info("received message: %v", string(msg.Data))
+	w, receiveCtx := b.startWorker(ctx)
+	defer b.stopWorker(w)
 
-		var taskMessage TaskMessage
-		err := json.Unmarshal(msg.Data, &taskMessage)
-		if err != nil {
-			log.Error("failed to unmarshal task: %v", err)
-			msg.Ack()
-			return
-		}
+	err := b.Broker.Receive(receiveCtx, func(ctx context.Context, msg *Message) error {
+		return b.handle(ctx, w, msg)
+	})
+	if err != nil {
+		log.Error("failed to receive message: %v", err)
+	}
 
-		// search task by task type
-		task := b.Tasks[taskMessage.TaskID]
-		err = task.Execute(taskMessage.Args)
-		if err != nil {
-			log.Error("failed to execute task: %v", err)
-			msg.Nack()
-			return
+	log.Info("Queue stopped")
+}
+
+// handle executes the task of msg. Failed tasks are published again with a backoff and dead-lettered
+// once their retry policy gives up, the returned error only nacks msg when that fails.
+func (b *Queue) handle(receiveCtx context.Context, w *worker, msg *Message) error {
+	// tasks are not cancelled when the receiving stops, only when Stop gives up waiting for them
+	ctx, cancel := w.detach(receiveCtx)
+	defer cancel()
+
+	logger := log.Module(log.ModuleQueue)
+	logger.Info("received message", log.String("message_id", msg.ID), log.String("data", string(msg.Data)))
+
+	var taskMessage TaskMessage
+	err := json.Unmarshal(msg.Data, &taskMessage)
+	if err != nil {
+		logger.Error(err, "failed to unmarshal task", log.String("message_id", msg.ID))
+		return b.DeadLetterTask(ctx, msg, nil, DeadLetterMalformed, err)
+	}
+
+	// restore the publisher's request id and trace context
+	ctx = correlation.FromMap(ctx, taskMessage.Metadata)
+	attempt := taskMessage.Attempt()
+	logger = logger.Ctx(ctx).With(log.String("task_id", taskMessage.TaskID), log.Int("attempt", attempt))
+
+	// search task by task type
+	task, ok := b.Tasks[taskMessage.TaskID]
+	if !ok {
+		unknownTaskCounter().Inc()
+		if b.OnUnknownTask != nil {
+			return b.OnUnknownTask(ctx, msg, taskMessage)
 		}
+		return b.DeadLetterTask(ctx, msg, &taskMessage, DeadLetterUnknownTask, fmt.Errorf("unknown task %q", taskMessage.TaskID))
+	}
+
+	release, err := b.acquire(receiveCtx, w, taskMessage.TaskID)
+	if err != nil {
+		// stopping, the broker redelivers the message
+		return err
+	}
+	defer release()
+	info := newTaskInfo(msg, taskMessage)
+	untrack := w.track(msg, info)
+	defer untrack()
+
+	logger.Info("executing task")
 
+	err = b.execute(ctx, task, info, taskMessage)
+	if err == nil {
 		// ack message when task executed successfully
-		msg.Ack()
-	})
+		return nil
+	}
+	if w.abortCtx.Err() != nil {
+		logger.Error(err, "task interrupted by shutdown")
+		return err
+	}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		taskPanicCounter().With(LabelTaskID, taskMessage.TaskID).Inc()
+		logger.Error(err, "task panicked", log.String("stack", string(panicErr.Stack)))
+	} else {
+		logger.Error(err, "failed to execute task")
+	}
 
-	if err != context.Canceled {
-		log.Error("cancelled: %v", err)
+	policy := b.retryPolicy(taskMessage.TaskID)
+	if !policy.ShouldRetry(attempt, err) {
+		reason := DeadLetterMaxAttempts
+		if panicErr != nil {
+			reason = DeadLetterPanic
+		} else if IsPermanent(err) {
+			reason = DeadLetterPermanentError
+		}
+		return b.DeadLetterTask(ctx, msg, &taskMessage, reason, err)
 	}
 
-	if err != nil {
-		log.Error("failed to receive message: %v", err)
+	// publish the next attempt and ack this one, so the broker does not redeliver it right away
+	retry := taskMessage
+	retry.Metadata = maps.Clone(taskMessage.Metadata)
+	if retry.Metadata == nil {
+		retry.Metadata = make(map[string]string)
+	}
+	retry.Metadata[MetadataAttempt] = strconv.Itoa(attempt + 1)
+	retry.Metadata[MetadataError] = metadataError(err)
+	backoff := policy.Backoff(attempt)
+	runAt := time.Now().Add(backoff)
+	retry.RunAt = &runAt
+	if _, err := sendTask(ctx, b.Broker, retry); err != nil {
+		logger.Error(err, "failed to retry task")
+		return err
+	}
+	logger.Info("retrying task", log.Duration("backoff", backoff))
+	return nil
+}
+
+// PanicError is the error of a task that panicked, it is permanent so the task is dead-lettered.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+// execute runs the task, turning a panic into a permanent PanicError.
+func (b *Queue) execute(ctx context.Context, task TaskInterface, info TaskInfo, taskMessage TaskMessage) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = Permanent(&PanicError{Value: value, Stack: debug.Stack()})
+		}
+	}()
+
+	contextTask, ok := task.(ContextTask)
+	if !ok {
+		return task.Execute(taskMessage.Args)
+	}
+
+	ctx = context.WithValue(ctx, taskInfoKey{}, info)
+	if timeout := b.options[taskMessage.TaskID].timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
+	return contextTask.ExecuteContext(ctx, taskMessage)
+}
 
-	log.Info("Queue started")
+func (b *Queue) retryPolicy(taskID string) RetryPolicy {
+	if options := b.options[taskID]; options.retryPolicy != nil {
+		return *options.retryPolicy
+	}
+	if b.RetryPolicy.MaxAttempts > 0 {
+		return b.RetryPolicy
+	}
+	return DefaultRetryPolicy
 }
 
-func (b *Queue) AddTask(task TaskInterface) {
+func (b *Queue) AddTask(task TaskInterface, opts ...TaskOption) {
+	var options taskOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if b.options == nil {
+		b.options = make(map[string]taskOptions)
+	}
+
 	b.Tasks[task.GetTaskID()] = task
-	log.Debug("Added task: %v %v", task.GetTaskType(), task.GetTaskID())
+	b.options[task.GetTaskID()] = options
+	log.Module(log.ModuleQueue).Debug("added task", log.String("task_type", task.GetTaskType()), log.String("task_id", task.GetTaskID()))
+}
+
+// ReplayDeadLetters sends the dead letters of the queue back to its broker, see ReplayDeadLetters.
+func (b *Queue) ReplayDeadLetters(ctx context.Context, filter func(*DeadLetter) bool) (int, error) {
+	if b.DeadLetter == nil {
+		return 0, errors.New("queue: the queue has no dead-letter broker")
+	}
+	return ReplayDeadLetters(ctx, b.DeadLetter, b.Broker, filter)
+}
+
+// Send publishes a task with the broker of the queue.
+func (b *Queue) Send(ctx context.Context, taskMessage TaskMessage) (string, error) {
+	return sendTask(ctx, b.Broker, taskMessage)
+}
+
+// Cancel deletes the pending task id returned by Send, it fails with ErrMessageNotFound once the task
+// is running and with ErrSchedulingNotSupported when the broker is not a Scheduler.
+func (b *Queue) Cancel(ctx context.Context, id string) error {
+	return cancelTask(ctx, b.Broker, id)
+}
+
+// Reschedule moves the pending task id returned by Send to runAt, see Cancel.
+func (b *Queue) Reschedule(ctx context.Context, id string, runAt time.Time) error {
+	return rescheduleTask(ctx, b.Broker, id, runAt)
+}
+
+// SetDefaultBroker sets the broker of SendDelayTask.
+func SetDefaultBroker(broker Broker) {
+	defaultBrokerMu.Lock()
+	defer defaultBrokerMu.Unlock()
+	defaultBroker = broker
+}
+
+// SendDelayTask publishes a task with the default broker, see SetDefaultBroker and InitPublisher. The
+// task runs at taskMessage.RunAt or after taskMessage.Countdown when set.
+func SendDelayTask(ctx context.Context, taskMessage TaskMessage) (string, error) {
+	broker, err := getDefaultBroker()
+	if err != nil {
+		return "", err
+	}
+	return sendTask(ctx, broker, taskMessage)
+}
+
+// CancelTask deletes a pending task of the default broker, see Queue.Cancel.
+func CancelTask(ctx context.Context, id string) error {
+	broker, err := getDefaultBroker()
+	if err != nil {
+		return err
+	}
+	return cancelTask(ctx, broker, id)
+}
+
+// RescheduleTask moves a pending task of the default broker to runAt, see Queue.Reschedule.
+func RescheduleTask(ctx context.Context, id string, runAt time.Time) error {
+	broker, err := getDefaultBroker()
+	if err != nil {
+		return err
+	}
+	return rescheduleTask(ctx, broker, id, runAt)
+}
+
+func getDefaultBroker() (Broker, error) {
+	defaultBrokerMu.RLock()
+	defer defaultBrokerMu.RUnlock()
+
+	if defaultBroker == nil {
+		log.Error("Publisher is not initialized")
+		return nil, fmt.Errorf("Publisher is not initialized")
+	}
+	return defaultBroker, nil
+}
+
+func cancelTask(ctx context.Context, broker Broker, id string) error {
+	scheduler, ok := broker.(Scheduler)
+	if !ok {
+		return ErrSchedulingNotSupported
+	}
+	return scheduler.Cancel(ctx, id)
+}
+
+func rescheduleTask(ctx context.Context, broker Broker, id string, runAt time.Time) error {
+	scheduler, ok := broker.(Scheduler)
+	if !ok {
+		return ErrSchedulingNotSupported
+	}
+	return scheduler.Reschedule(ctx, id, runAt)
+}
+
+func sendTask(ctx context.Context, broker Broker, taskMessage TaskMessage) (string, error) {
+	if taskMessage.Countdown > 0 && taskMessage.RunAt == nil {
+		runAt := time.Now().Add(taskMessage.Countdown)
+		taskMessage.RunAt = &runAt
+	}
+	taskMessage.Countdown = 0
+	// the metadata of the caller is never written to
+	taskMessage.Metadata = maps.Clone(taskMessage.Metadata)
+	if taskMessage.Metadata == nil {
+		taskMessage.Metadata = make(map[string]string)
+	}
+	if _, ok := taskMessage.Metadata[MetadataEnqueuedAt]; !ok {
+		taskMessage.Metadata[MetadataEnqueuedAt] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	// propagate request id and trace context to the consumer
+	for key, value := range correlation.ToMap(ctx) {
+		if _, ok := taskMessage.Metadata[key]; !ok {
+			taskMessage.Metadata[key] = value
+		}
+	}
+
+	log.InfoCtx(ctx, "AddTask %v", taskMessage)
+
+	taskData, err := json.Marshal(taskMessage)
+	if err != nil {
+		log.Error("failed to marshal task: %v", err)
+		return "", err
+	}
+
+	msg := &Message{
+		Data:       taskData,
+		Attributes: taskMessage.Metadata,
+	}
+	if taskMessage.RunAt != nil {
+		msg.RunAt = *taskMessage.RunAt
+	}
+	id, err := broker.Publish(ctx, msg)
+	if err != nil {
+		log.Error("failed to publish message: %v", err)
+		return "", err
+	}
+
+	return id, nil
 }
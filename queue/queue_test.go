@@ -0,0 +1,355 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/correlation"
+	"github.com/ngtrvu/zen-go/queue"
+)
+
+type recordTask struct {
+	*queue.Task
+
+	mu    sync.Mutex
+	calls [][]string
+	fail  int
+	err   error
+}
+
+func newRecordTask(taskID string) *recordTask {
+	return &recordTask{Task: queue.NewTask(taskID, queue.TaskTypeAsync)}
+}
+
+func (t *recordTask) Execute(args []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.calls = append(t.calls, args)
+	if len(t.calls) <= t.fail {
+		if t.err != nil {
+			return t.err
+		}
+		return errors.New("temporary failure")
+	}
+	return nil
+}
+
+func (t *recordTask) Calls() [][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([][]string(nil), t.calls...)
+}
+
+// startQueue runs q until the test ends.
+func startQueue(t *testing.T, q *queue.Queue) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestQueue(t *testing.T) {
+	broker := queue.NewMemoryBroker()
+	q := queue.NewQueueWithBroker(broker)
+	q.RetryPolicy = queue.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	task := newRecordTask("send_email")
+	task.fail = 1
+	q.AddTask(task)
+	startQueue(t, q)
+
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: "req-1"})
+	id, err := q.Send(ctx, queue.TaskMessage{TaskID: "send_email", Args: []string{"a@example.com"}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	// the failed execution is retried
+	require.Eventually(t, func() bool { return len(task.Calls()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"a@example.com"}, task.Calls()[1])
+	require.Eventually(t, func() bool { return broker.Len() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestSendDelayTask(t *testing.T) {
+	queue.SetDefaultBroker(nil)
+	_, err := queue.SendDelayTask(context.Background(), queue.TaskMessage{TaskID: "send_email"})
+	assert.Error(t, err)
+
+	broker := queue.NewMemoryBroker()
+	queue.SetDefaultBroker(broker)
+	defer queue.SetDefaultBroker(nil)
+
+	ctx := correlation.NewContext(context.Background(), correlation.IDs{RequestID: "req-1"})
+	_, err = queue.SendDelayTask(ctx, queue.TaskMessage{TaskID: "send_email"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, broker.Len())
+
+	// the metadata of the caller is left as is, even when it has the enqueued time
+	metadata := map[string]string{queue.MetadataEnqueuedAt: "2026-01-02T03:04:05Z"}
+	_, err = queue.SendDelayTask(ctx, queue.TaskMessage{TaskID: "send_email", Metadata: metadata})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{queue.MetadataEnqueuedAt: "2026-01-02T03:04:05Z"}, metadata)
+	assert.Equal(t, 2, broker.Len())
+
+	received := make(chan *queue.Message, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go broker.Receive(ctx, func(ctx context.Context, msg *queue.Message) error {
+		received <- msg
+		return nil
+	})
+	msg := <-received
+	assert.Equal(t, "req-1", msg.Attributes[correlation.KeyRequestID])
+	var taskMessage queue.TaskMessage
+	require.NoError(t, json.Unmarshal(msg.Data, &taskMessage))
+	assert.Equal(t, "send_email", taskMessage.TaskID)
+	assert.Equal(t, "req-1", taskMessage.Metadata[correlation.KeyRequestID])
+	assert.NotEmpty(t, taskMessage.Metadata[queue.MetadataEnqueuedAt])
+}
+
+func TestQueueSchedule(t *testing.T) {
+	ctx := context.Background()
+	broker := queue.NewMemoryBroker()
+	q := queue.NewQueueWithBroker(broker)
+	task := newRecordTask("send_email")
+	q.AddTask(task)
+	startQueue(t, q)
+
+	cancelled, err := q.Send(ctx, queue.TaskMessage{TaskID: "send_email", Args: []string{"cancelled"}, Countdown: time.Hour})
+	require.NoError(t, err)
+	runAt := time.Now().Add(time.Hour)
+	rescheduled, err := q.Send(ctx, queue.TaskMessage{TaskID: "send_email", Args: []string{"rescheduled"}, RunAt: &runAt})
+	require.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, task.Calls())
+
+	require.NoError(t, q.Cancel(ctx, cancelled))
+	require.NoError(t, q.Reschedule(ctx, rescheduled, time.Now()))
+	require.Eventually(t, func() bool { return broker.Len() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, [][]string{{"rescheduled"}}, task.Calls())
+
+	// brokers without scheduling
+	q = queue.NewQueueWithBroker(struct{ queue.Broker }{broker})
+	assert.ErrorIs(t, q.Cancel(ctx, rescheduled), queue.ErrSchedulingNotSupported)
+}
+
+func TestQueueRetry(t *testing.T) {
+	ctx := context.Background()
+	broker := queue.NewMemoryBroker()
+	deadLetters := queue.NewMemoryBroker()
+	q := queue.NewQueueWithBroker(broker)
+	q.DeadLetter = deadLetters
+	q.RetryPolicy = queue.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	flaky := newRecordTask("flaky")
+	flaky.fail = 5
+	q.AddTask(flaky)
+	invalid := newRecordTask("invalid")
+	invalid.fail = 5
+	invalid.err = queue.Permanent(errors.New("invalid email"))
+	q.AddTask(invalid, queue.WithRetryPolicy(queue.RetryPolicy{MaxAttempts: 10}))
+	startQueue(t, q)
+
+	_, err := q.Send(ctx, queue.TaskMessage{TaskID: "flaky", Args: []string{"a"}})
+	require.NoError(t, err)
+	_, err = q.Send(ctx, queue.TaskMessage{TaskID: "invalid", Args: []string{"b"}})
+	require.NoError(t, err)
+	_, err = broker.Publish(ctx, &queue.Message{Data: []byte("not json")})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return deadLetters.Len() == 3 }, time.Second, 5*time.Millisecond)
+	assert.Len(t, flaky.Calls(), 3)
+	assert.Len(t, invalid.Calls(), 1)
+
+	letters, err := queue.ListDeadLetters(ctx, deadLetters, 0)
+	require.NoError(t, err)
+	reasons := map[string]*queue.DeadLetter{}
+	for _, letter := range letters {
+		reasons[letter.Reason] = letter
+	}
+
+	maxAttempts := reasons[queue.DeadLetterMaxAttempts]
+	require.NotNil(t, maxAttempts)
+	require.NotNil(t, maxAttempts.Task)
+	assert.Equal(t, "flaky", maxAttempts.Task.TaskID)
+	assert.Equal(t, 3, maxAttempts.Attempts)
+	assert.Equal(t, 3, maxAttempts.Task.Attempt())
+	assert.Equal(t, "temporary failure", maxAttempts.Error)
+	assert.WithinDuration(t, time.Now(), maxAttempts.FailedAt, time.Second)
+
+	permanent := reasons[queue.DeadLetterPermanentError]
+	require.NotNil(t, permanent)
+	assert.Equal(t, 1, permanent.Attempts)
+	assert.Equal(t, "invalid email", permanent.Error)
+
+	malformed := reasons[queue.DeadLetterMalformed]
+	require.NotNil(t, malformed)
+	assert.Nil(t, malformed.Task)
+	assert.Equal(t, "not json", string(malformed.Data))
+
+	// replay the flaky task, it now succeeds
+	flaky.fail = 0
+	replayed, err := q.ReplayDeadLetters(ctx, func(letter *queue.DeadLetter) bool {
+		return letter.Reason != queue.DeadLetterPermanentError
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	require.Eventually(t, func() bool { return len(flaky.Calls()) == 4 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 2, deadLetters.Len())
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := queue.RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 2*time.Second, policy.Backoff(2))
+	assert.Equal(t, 4*time.Second, policy.Backoff(3))
+	assert.Equal(t, 5*time.Second, policy.Backoff(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		backoff := policy.Backoff(2)
+		assert.GreaterOrEqual(t, backoff, time.Second)
+		assert.LessOrEqual(t, backoff, 3*time.Second)
+	}
+
+	failure := errors.New("failure")
+	assert.True(t, policy.ShouldRetry(3, failure))
+	assert.False(t, policy.ShouldRetry(4, failure))
+	assert.False(t, policy.ShouldRetry(1, queue.Permanent(failure)))
+	assert.ErrorIs(t, queue.Permanent(failure), failure)
+	assert.Nil(t, queue.Permanent(nil))
+
+	policy.Retryable = func(err error) bool { return !errors.Is(err, context.Canceled) }
+	assert.True(t, policy.ShouldRetry(1, queue.Permanent(failure)))
+	assert.False(t, policy.ShouldRetry(1, context.Canceled))
+}
+
+type panicTask struct {
+	*queue.Task
+}
+
+func (t *panicTask) Execute(args []string) error {
+	var values map[string]string
+	values[args[0]] = "boom"
+	return nil
+}
+
+func TestQueueUnknownTaskAndPanic(t *testing.T) {
+	ctx := context.Background()
+	broker := queue.NewMemoryBroker()
+	deadLetters := queue.NewMemoryBroker()
+	q := queue.NewQueueWithBroker(broker)
+	q.DeadLetter = deadLetters
+	q.AddTask(&panicTask{Task: queue.NewTask("panic", queue.TaskTypeAsync)})
+	task := newRecordTask("send_email")
+	q.AddTask(task)
+	startQueue(t, q)
+	panics, unknowns := counterValue(t, "queue_task_panics_total"), counterValue(t, "queue_unknown_tasks_total")
+
+	_, err := q.Send(ctx, queue.TaskMessage{TaskID: "missing"})
+	require.NoError(t, err)
+	_, err = q.Send(ctx, queue.TaskMessage{TaskID: "panic", Args: []string{"key"}})
+	require.NoError(t, err)
+	_, err = q.Send(ctx, queue.TaskMessage{TaskID: "send_email", Args: []string{"a@example.com"}})
+	require.NoError(t, err)
+
+	// the worker survives the panic
+	require.Eventually(t, func() bool { return deadLetters.Len() == 2 && broker.Len() == 0 }, time.Second, 5*time.Millisecond)
+	assert.Len(t, task.Calls(), 1)
+
+	letters, err := queue.ListDeadLetters(ctx, deadLetters, 0)
+	require.NoError(t, err)
+	reasons := map[string]*queue.DeadLetter{}
+	for _, letter := range letters {
+		reasons[letter.Reason] = letter
+	}
+	require.Contains(t, reasons, queue.DeadLetterUnknownTask)
+	assert.Equal(t, "missing", reasons[queue.DeadLetterUnknownTask].Task.TaskID)
+	require.Contains(t, reasons, queue.DeadLetterPanic)
+	assert.Contains(t, reasons[queue.DeadLetterPanic].Error, "assignment to entry in nil map")
+
+	assert.Equal(t, panics+1, counterValue(t, "queue_task_panics_total"))
+	assert.Equal(t, unknowns+1, counterValue(t, "queue_unknown_tasks_total"))
+
+	// a custom handler replaces the dead-lettering
+	unknown := make(chan string, 1)
+	q.OnUnknownTask = func(ctx context.Context, msg *queue.Message, taskMessage queue.TaskMessage) error {
+		unknown <- taskMessage.TaskID
+		return nil
+	}
+	_, err = q.Send(ctx, queue.TaskMessage{TaskID: "other"})
+	require.NoError(t, err)
+	assert.Equal(t, "other", <-unknown)
+	assert.Equal(t, 2, deadLetters.Len())
+}
+
+// counterValue sums the series of a counter of the default registry.
+func counterValue(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	var value float64
+	for _, family := range families {
+		if family.GetName() == name {
+			for _, metric := range family.GetMetric() {
+				value += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return value
+}
+
+// attributeLimitBroker rejects attribute values over 1024 bytes like Pub/Sub.
+type attributeLimitBroker struct {
+	*queue.MemoryBroker
+}
+
+func (b attributeLimitBroker) Publish(ctx context.Context, msg *queue.Message) (string, error) {
+	for key, value := range msg.Attributes {
+		if len(value) > 1024 {
+			return "", fmt.Errorf("attribute %s is too long", key)
+		}
+	}
+	return b.MemoryBroker.Publish(ctx, msg)
+}
+
+func TestQueueRetryLongError(t *testing.T) {
+	ctx := context.Background()
+	broker := attributeLimitBroker{queue.NewMemoryBroker()}
+	deadLetters := attributeLimitBroker{queue.NewMemoryBroker()}
+	q := queue.NewQueueWithBroker(broker)
+	q.DeadLetter = deadLetters
+	q.RetryPolicy = queue.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+
+	task := newRecordTask("sql")
+	task.fail = 2
+	task.err = errors.New("é" + strings.Repeat("x", 2048))
+	q.AddTask(task)
+	startQueue(t, q)
+
+	_, err := q.Send(ctx, queue.TaskMessage{TaskID: "sql"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return deadLetters.Len() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Len(t, task.Calls(), 2)
+
+	letters, err := queue.ListDeadLetters(ctx, deadLetters, 0)
+	require.NoError(t, err)
+	assert.Len(t, letters[0].Error, queue.MaxMetadataErrorLength)
+	assert.True(t, strings.HasPrefix(letters[0].Error, "éxx"))
+	assert.True(t, strings.HasSuffix(letters[0].Error, "..."))
+}
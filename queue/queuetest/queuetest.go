@@ -0,0 +1,259 @@
+// Package queuetest checks that queue brokers behave the same.
+package queuetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/queue"
+)
+
+// Timeout bounds the wait for deliveries, raise it for slow backends.
+var Timeout = 10 * time.Second
+
+// Factory returns an empty broker for each test, it is closed by the suite.
+type Factory func(t *testing.T) queue.Broker
+
+// Run runs the conformance suite against the brokers created by newBroker.
+func Run(t *testing.T, newBroker Factory) {
+	ctx := context.Background()
+
+	t.Run("PublishAndReceive", func(t *testing.T) {
+		b := open(t, newBroker)
+
+		ids := map[string]string{}
+		for i := 0; i < 3; i++ {
+			data := fmt.Sprintf(`{"task_id":"task-%d"}`, i)
+			id, err := b.Publish(ctx, &queue.Message{Data: []byte(data), Attributes: map[string]string{"index": fmt.Sprint(i)}})
+			require.NoError(t, err)
+			require.NotEmpty(t, id)
+			ids[id] = data
+		}
+
+		var mu sync.Mutex
+		received := map[string]*queue.Message{}
+		stop := Receive(t, b, func(ctx context.Context, msg *queue.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[msg.ID] = msg
+			return nil
+		})
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received) == 3
+		}, Timeout, 10*time.Millisecond)
+		stop()
+
+		for id, data := range ids {
+			require.Contains(t, received, id)
+			assert.Equal(t, data, string(received[id].Data))
+			assert.NotEmpty(t, received[id].Attributes["index"])
+		}
+	})
+
+	t.Run("NackRedelivers", func(t *testing.T) {
+		b := open(t, newBroker)
+		_, err := b.Publish(ctx, &queue.Message{Data: []byte(`{"task_id":"flaky"}`)})
+		require.NoError(t, err)
+
+		var deliveries atomic.Int32
+		stop := Receive(t, b, func(ctx context.Context, msg *queue.Message) error {
+			if deliveries.Add(1) == 1 {
+				return errors.New("temporary failure")
+			}
+			return nil
+		})
+		require.Eventually(t, func() bool { return deliveries.Load() == 2 }, Timeout, 10*time.Millisecond)
+
+		// acked messages are not redelivered
+		time.Sleep(200 * time.Millisecond)
+		stop()
+		assert.EqualValues(t, 2, deliveries.Load())
+	})
+
+	t.Run("CompetingConsumers", func(t *testing.T) {
+		b := open(t, newBroker)
+		const count = 20
+		for i := 0; i < count; i++ {
+			_, err := b.Publish(ctx, &queue.Message{Data: []byte(fmt.Sprint(i))})
+			require.NoError(t, err)
+		}
+
+		var mu sync.Mutex
+		received := map[string]int{}
+		handler := func(ctx context.Context, msg *queue.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[string(msg.Data)]++
+			return nil
+		}
+		stopFirst := Receive(t, b, handler)
+		stopSecond := Receive(t, b, handler)
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received) == count
+		}, Timeout, 10*time.Millisecond)
+
+		time.Sleep(200 * time.Millisecond)
+		stopFirst()
+		stopSecond()
+		for data, times := range received {
+			assert.Equal(t, 1, times, data)
+		}
+	})
+
+	t.Run("DelayedDelivery", func(t *testing.T) {
+		b := open(t, newBroker)
+		runAt := time.Now().Add(time.Second)
+		_, err := b.Publish(ctx, &queue.Message{Data: []byte("later"), RunAt: runAt})
+		require.NoError(t, err)
+		_, err = b.Publish(ctx, &queue.Message{Data: []byte("now")})
+		require.NoError(t, err)
+
+		var mu sync.Mutex
+		received := map[string]time.Time{}
+		stop := Receive(t, b, func(ctx context.Context, msg *queue.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[string(msg.Data)] = time.Now()
+			return nil
+		})
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received) == 2
+		}, Timeout, 10*time.Millisecond)
+		stop()
+
+		assert.True(t, received["now"].Before(runAt))
+		assert.False(t, received["later"].Before(runAt))
+	})
+
+	t.Run("CancelAndReschedule", func(t *testing.T) {
+		b := open(t, newBroker)
+		scheduler, ok := b.(queue.Scheduler)
+		if !ok {
+			t.Skip("the broker is not a Scheduler")
+		}
+
+		cancelled, err := b.Publish(ctx, &queue.Message{Data: []byte("cancelled"), RunAt: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		rescheduled, err := b.Publish(ctx, &queue.Message{Data: []byte("rescheduled"), RunAt: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+
+		require.NoError(t, scheduler.Cancel(ctx, cancelled))
+		assert.ErrorIs(t, scheduler.Cancel(ctx, cancelled), queue.ErrMessageNotFound)
+		require.NoError(t, scheduler.Reschedule(ctx, rescheduled, time.Now()))
+		assert.ErrorIs(t, scheduler.Reschedule(ctx, cancelled, time.Now()), queue.ErrMessageNotFound)
+
+		received := make(chan string, 2)
+		stop := Receive(t, b, func(ctx context.Context, msg *queue.Message) error {
+			received <- string(msg.Data)
+			return nil
+		})
+		select {
+		case data := <-received:
+			assert.Equal(t, "rescheduled", data)
+		case <-time.After(Timeout):
+			t.Fatal("rescheduled message not received")
+		}
+		time.Sleep(200 * time.Millisecond)
+		stop()
+		assert.Empty(t, received)
+
+		// delivered messages can no longer be changed
+		assert.ErrorIs(t, scheduler.Cancel(ctx, rescheduled), queue.ErrMessageNotFound)
+	})
+
+	t.Run("Browse", func(t *testing.T) {
+		b := open(t, newBroker)
+		browser, ok := b.(queue.Browser)
+		if !ok {
+			t.Skip("the broker is not a Browser")
+		}
+
+		var ids []string
+		for i := 0; i < 3; i++ {
+			id, err := b.Publish(ctx, &queue.Message{Data: []byte(fmt.Sprint(i)), Attributes: map[string]string{"index": fmt.Sprint(i)}})
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+
+		messages, err := browser.Browse(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, ids[0], messages[0].ID)
+		assert.Equal(t, "0", string(messages[0].Data))
+		assert.Equal(t, "0", messages[0].Attributes["index"])
+
+		messages, err = browser.Browse(ctx, 0)
+		require.NoError(t, err)
+		assert.Len(t, messages, 3)
+	})
+
+	t.Run("ReceiveWaitsForHandlers", func(t *testing.T) {
+		b := open(t, newBroker)
+		_, err := b.Publish(ctx, &queue.Message{Data: []byte("slow")})
+		require.NoError(t, err)
+
+		started := make(chan struct{})
+		var finished atomic.Bool
+		stop := Receive(t, b, func(ctx context.Context, msg *queue.Message) error {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			finished.Store(true)
+			return nil
+		})
+
+		select {
+		case <-started:
+		case <-time.After(Timeout):
+			t.Fatal("message not received")
+		}
+		stop()
+		assert.True(t, finished.Load())
+	})
+}
+
+// Receive runs b.Receive with handler in the background, the returned func stops it and waits for
+// it to return.
+func Receive(t *testing.T, b queue.Broker, handler queue.Handler) (stop func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Receive(ctx, handler)
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			cancel()
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+			case <-time.After(Timeout):
+				t.Error("Receive did not return after its context was cancelled")
+			}
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func open(t *testing.T, newBroker Factory) queue.Broker {
+	b := newBroker(t)
+	t.Cleanup(func() { b.Close() })
+	return b
+}
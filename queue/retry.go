@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// DefaultRetryPolicy is used by the tasks of a Queue without a retry policy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 10 * time.Second,
+	MaxBackoff:     10 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// RetryPolicy decides whether and when a failed task runs again.
+type RetryPolicy struct {
+	// MaxAttempts counts the first execution, 1 disables the retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, it grows by Multiplier per attempt up to
+	// MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter randomizes the delays by up to this fraction of them, 0.2 gives 80% to 120%.
+	Jitter float64
+
+	// Retryable reports whether an error is worth a retry, by default all errors except those
+	// wrapped with Permanent.
+	Retryable func(err error) bool
+}
+
+// ShouldRetry reports whether a task that failed with err on attempt runs again.
+func (p RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return !IsPermanent(err)
+}
+
+// Backoff is the delay before the retry following attempt, counting from 1.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(max(attempt-1, 0)))
+	if p.MaxBackoff > 0 {
+		backoff = min(backoff, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not retryable, the task is dead-lettered right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked by Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
@@ -1,12 +1,73 @@
 package queue
 
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
 const (
 	TaskTypeAsync = "async_task"
 )
 
+// Metadata keys set by the Queue on retried and dead-lettered tasks.
+const (
+	// MetadataAttempt counts the executions of a task, starting at 1.
+	MetadataAttempt = "x-attempt"
+	// MetadataError is the error of the last execution, truncated to MaxMetadataErrorLength bytes.
+	MetadataError = "x-error"
+	// MetadataDeadLetterReason is why a task was dead-lettered, see DeadLetterReason.
+	MetadataDeadLetterReason = "x-dead-letter-reason"
+	// MetadataFailedAt is when a task was dead-lettered, as RFC 3339.
+	MetadataFailedAt = "x-failed-at"
+	// MetadataEnqueuedAt is when a task was first sent, as RFC 3339.
+	MetadataEnqueuedAt = "x-enqueued-at"
+)
+
 type TaskMessage struct {
 	TaskID string   `json:"task_id"`
 	Args   []string `json:"args"`
+	// Payload is the JSON input of the tasks added with Register, see NewTaskMessage.
+	Payload json.RawMessage `json:"payload,omitempty"`
+
+	// Metadata carries the request id and trace context of the publisher, see correlation.ToMap.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// RunAt delays the execution until then, the broker holds the task meanwhile.
+	RunAt *time.Time `json:"run_at,omitempty"`
+	// Countdown delays the execution by a duration from the publication, it is converted to RunAt
+	// when the task is sent.
+	Countdown time.Duration `json:"-"`
+}
+
+// MaxMetadataErrorLength bounds MetadataError, metadata are also broker attributes and Pub/Sub rejects
+// attribute values over 1024 bytes.
+const MaxMetadataErrorLength = 512
+
+// metadataError returns the message of err truncated to MaxMetadataErrorLength bytes.
+func metadataError(err error) string {
+	message := err.Error()
+	if len(message) <= MaxMetadataErrorLength {
+		return message
+	}
+
+	// cut at the start of a rune
+	const ellipsis = "..."
+	end := MaxMetadataErrorLength - len(ellipsis)
+	for end > 0 && !utf8.RuneStart(message[end]) {
+		end--
+	}
+	return message[:end] + ellipsis
+}
+
+// Attempt is the number of the current execution, 1 for the first one.
+func (m TaskMessage) Attempt() int {
+	attempt, err := strconv.Atoi(m.Metadata[MetadataAttempt])
+	if err != nil || attempt < 1 {
+		return 1
+	}
+	return attempt
 }
 
 type TaskInterface interface {
@@ -0,0 +1,201 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// WithConcurrency bounds the executions of a task running at once.
+func WithConcurrency(concurrency int) TaskOption {
+	return func(o *taskOptions) {
+		if concurrency > 0 {
+			o.slots = make(chan struct{}, concurrency)
+		}
+	}
+}
+
+// WithRateLimit bounds the executions of a task started per second, allowing bursts of burst.
+func WithRateLimit(perSecond float64, burst int) TaskOption {
+	return func(o *taskOptions) {
+		if perSecond > 0 {
+			o.limiter = rate.NewLimiter(rate.Limit(perSecond), max(burst, 1))
+		}
+	}
+}
+
+// UnfinishedTasksError is returned by Stop when tasks were still running at its deadline. Their
+// contexts are cancelled and their messages redelivered.
+type UnfinishedTasksError struct {
+	Tasks []TaskInfo
+	Err   error
+}
+
+func (e *UnfinishedTasksError) Error() string {
+	tasks := make([]string, 0, len(e.Tasks))
+	for _, task := range e.Tasks {
+		tasks = append(tasks, fmt.Sprintf("%s (%s)", task.TaskID, task.ID))
+	}
+	return fmt.Sprintf("queue: %d tasks did not finish: %s", len(e.Tasks), strings.Join(tasks, ", "))
+}
+
+func (e *UnfinishedTasksError) Unwrap() error {
+	return e.Err
+}
+
+// worker is a running Start.
+type worker struct {
+	// stop ends the receiving, abort cancels the running tasks
+	stop     context.CancelFunc
+	abortCtx context.Context
+	abort    context.CancelFunc
+	done     chan struct{}
+
+	// slots bounds the running tasks to Queue.Concurrency, nil when unbounded
+	slots chan struct{}
+
+	mu       sync.Mutex
+	inFlight map[*Message]TaskInfo
+}
+
+// startWorker registers a worker receiving with the returned context.
+func (b *Queue) startWorker(ctx context.Context) (*worker, context.Context) {
+	receiveCtx, stop := context.WithCancel(ctx)
+	abortCtx, abort := context.WithCancel(context.Background())
+	w := &worker{
+		stop:     stop,
+		abortCtx: abortCtx,
+		abort:    abort,
+		done:     make(chan struct{}),
+		inFlight: make(map[*Message]TaskInfo),
+	}
+	if b.Concurrency > 0 {
+		w.slots = make(chan struct{}, b.Concurrency)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.workers == nil {
+		b.workers = make(map[*worker]struct{})
+	}
+	b.workers[w] = struct{}{}
+	return w, receiveCtx
+}
+
+func (b *Queue) stopWorker(w *worker) {
+	b.mu.Lock()
+	delete(b.workers, w)
+	b.mu.Unlock()
+
+	w.stop()
+	w.abort()
+	close(w.done)
+}
+
+// Stop stops receiving messages and waits for the running tasks. When ctx is done first, the contexts
+// of the remaining tasks are cancelled and they are reported by an UnfinishedTasksError.
+func (b *Queue) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	workers := make([]*worker, 0, len(b.workers))
+	for w := range b.workers {
+		workers = append(workers, w)
+	}
+	b.mu.Unlock()
+
+	for _, w := range workers {
+		w.stop()
+	}
+	for _, w := range workers {
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			var unfinished []TaskInfo
+			for _, w := range workers {
+				unfinished = append(unfinished, w.unfinished()...)
+				w.abort()
+			}
+			if len(unfinished) == 0 {
+				return nil
+			}
+			return &UnfinishedTasksError{Tasks: unfinished, Err: ctx.Err()}
+		}
+	}
+	return nil
+}
+
+// detach returns a context for executing a task that outlives the receiving, it is only cancelled
+// when Stop gives up waiting.
+func (w *worker) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(w.abortCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// acquire waits for the concurrency and rate limits of the task, it fails when ctx is done first.
+func (b *Queue) acquire(ctx context.Context, w *worker, taskID string) (release func(), err error) {
+	options := b.options[taskID]
+	var releases []func()
+	release = func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+
+	if options.slots != nil {
+		if err := acquireSlot(ctx, options.slots); err != nil {
+			return nil, err
+		}
+		releases = append(releases, func() { <-options.slots })
+	}
+	if options.limiter != nil {
+		if err := options.limiter.Wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	// the slots of the queue come last so tasks waiting for their own limits do not hold them
+	if w.slots != nil {
+		if err := acquireSlot(ctx, w.slots); err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, func() { <-w.slots })
+	}
+	return release, nil
+}
+
+func acquireSlot(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *worker) track(msg *Message, info TaskInfo) (untrack func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inFlight[msg] = info
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.inFlight, msg)
+	}
+}
+
+func (w *worker) unfinished() []TaskInfo {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	tasks := make([]TaskInfo, 0, len(w.inFlight))
+	for _, info := range w.inFlight {
+		tasks = append(tasks, info)
+	}
+	return tasks
+}
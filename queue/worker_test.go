@@ -0,0 +1,141 @@
+package queue_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/queue"
+)
+
+// runCounter counts the running executions and keeps the highest count.
+type runCounter struct {
+	running, peak atomic.Int32
+}
+
+func (c *runCounter) start() (done func()) {
+	current := c.running.Add(1)
+	for {
+		highest := c.peak.Load()
+		if current <= highest || c.peak.CompareAndSwap(highest, current) {
+			break
+		}
+	}
+	return func() { c.running.Add(-1) }
+}
+
+func TestQueueConcurrency(t *testing.T) {
+	ctx := context.Background()
+	q := queue.NewQueueWithBroker(queue.NewMemoryBroker())
+	q.Concurrency = 3
+
+	var all, slow runCounter
+	var done atomic.Int32
+	queue.Register(q, "fast", func(ctx context.Context, payload []string) error {
+		defer done.Add(1)
+		defer all.start()()
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	queue.Register(q, "slow", func(ctx context.Context, payload []string) error {
+		defer done.Add(1)
+		defer all.start()()
+		defer slow.start()()
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}, queue.WithConcurrency(1))
+	startQueue(t, q)
+
+	for i := 0; i < 6; i++ {
+		_, err := q.Send(ctx, queue.TaskMessage{TaskID: "fast"})
+		require.NoError(t, err)
+		_, err = q.Send(ctx, queue.TaskMessage{TaskID: "slow"})
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool { return done.Load() == 12 }, 5*time.Second, 5*time.Millisecond)
+	assert.EqualValues(t, 1, slow.peak.Load())
+	assert.EqualValues(t, 3, all.peak.Load())
+}
+
+func TestQueueRateLimit(t *testing.T) {
+	ctx := context.Background()
+	q := queue.NewQueueWithBroker(queue.NewMemoryBroker())
+	var done atomic.Int32
+	queue.Register(q, "limited", func(ctx context.Context, payload []string) error {
+		done.Add(1)
+		return nil
+	}, queue.WithRateLimit(20, 1))
+	startQueue(t, q)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		_, err := q.Send(ctx, queue.TaskMessage{TaskID: "limited"})
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool { return done.Load() == 5 }, 5*time.Second, 5*time.Millisecond)
+	// a burst of 1 then 4 executions 50ms apart
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+}
+
+func TestQueueStop(t *testing.T) {
+	ctx := context.Background()
+	broker := queue.NewMemoryBroker()
+	q := queue.NewQueueWithBroker(broker)
+
+	started := make(chan struct{}, 2)
+	var finished atomic.Int32
+	queue.Register(q, "short", func(ctx context.Context, payload []string) error {
+		started <- struct{}{}
+		time.Sleep(100 * time.Millisecond)
+		finished.Add(1)
+		return ctx.Err()
+	})
+	var cancelled atomic.Bool
+	queue.Register(q, "long", func(ctx context.Context, payload []string) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		cancelled.Store(true)
+		return ctx.Err()
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		q.Start(ctx)
+	}()
+
+	_, err := q.Send(ctx, queue.TaskMessage{TaskID: "short"})
+	require.NoError(t, err)
+	long, err := q.Send(ctx, queue.TaskMessage{TaskID: "long"})
+	require.NoError(t, err)
+	<-started
+	<-started
+
+	stopCtx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	err = q.Stop(stopCtx)
+
+	// the short task finished while the long one was reported and cancelled
+	var unfinished *queue.UnfinishedTasksError
+	require.ErrorAs(t, err, &unfinished)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Len(t, unfinished.Tasks, 1)
+	assert.Equal(t, long, unfinished.Tasks[0].ID)
+	assert.Equal(t, "long", unfinished.Tasks[0].TaskID)
+	assert.EqualValues(t, 1, finished.Load())
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+	assert.True(t, cancelled.Load())
+
+	// the interrupted task is redelivered, nothing new was received
+	assert.Equal(t, 1, broker.Len())
+	assert.NoError(t, q.Stop(ctx))
+}
@@ -0,0 +1,171 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaskChar = '*'
+
+	// values shorter than this are fully masked, longer ones keep maskKeep runes on both ends
+	minPartialMaskLength = 7
+	maskKeep             = 2
+)
+
+// DefaultSensitiveFields are field and column names whose values are always masked.
+var DefaultSensitiveFields = []string{
+	"password", "secret", "token", "access_token", "refresh_token", "authorization", "api_key",
+	"otp", "pin", "phone", "phone_number", "mobile", "email",
+	"id_number", "id_card", "identity_number", "cmnd", "cccd", "passport",
+}
+
+// Detector finds sensitive values inside free text.
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Mask    func(match string) string
+}
+
+var (
+	// BearerTokenDetector matches "Bearer <token>" in headers and messages.
+	BearerTokenDetector = Detector{
+		Name:    "bearer_token",
+		Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`),
+		Mask: func(match string) string {
+			return match[:len("bearer")] + " " + strings.Repeat(string(MaskChar), 6)
+		},
+	}
+
+	// EmailDetector matches email addresses.
+	EmailDetector = Detector{
+		Name:    "email",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+		Mask:    MaskEmail,
+	}
+
+	// PhoneVNDetector matches Vietnamese mobile numbers: 0xxxxxxxxx, 84xxxxxxxxx or +84xxxxxxxxx.
+	PhoneVNDetector = Detector{
+		Name:    "phone_vn",
+		Pattern: regexp.MustCompile(`(?:\+84|\b84|\b0)[35789]\d{8}\b`),
+		Mask:    Mask,
+	}
+
+	// IDCardVNDetector matches 9 digit CMND and 12 digit CCCD numbers. It also matches amounts, IDs
+	// and timestamps, so it is not a default detector: id_number, cmnd, cccd and similar fields are
+	// masked by DefaultSensitiveFields instead.
+	IDCardVNDetector = Detector{
+		Name:    "id_card_vn",
+		Pattern: regexp.MustCompile(`\b(?:\d{9}|\d{12})\b`),
+		Mask:    Mask,
+	}
+)
+
+// DefaultDetectors are applied in order, more specific patterns first.
+var DefaultDetectors = []Detector{BearerTokenDetector, EmailDetector, PhoneVNDetector}
+
+// Options configures a Redactor.
+type Options struct {
+	// SensitiveFields are matched case-insensitively against field keys and SQL column names.
+	SensitiveFields []string
+
+	// Detectors are applied to free text: messages, string values and SQL.
+	Detectors []Detector
+}
+
+type Redactor struct {
+	fields    map[string]struct{}
+	detectors []Detector
+}
+
+func New(opts Options) *Redactor {
+	fields := make(map[string]struct{}, len(opts.SensitiveFields))
+	for _, field := range opts.SensitiveFields {
+		fields[strings.ToLower(field)] = struct{}{}
+	}
+
+	return &Redactor{fields: fields, detectors: opts.Detectors}
+}
+
+// Default uses DefaultSensitiveFields and DefaultDetectors.
+func Default() *Redactor {
+	return New(Options{SensitiveFields: DefaultSensitiveFields, Detectors: DefaultDetectors})
+}
+
+// IsSensitiveField reports whether values under key must be masked.
+func (r *Redactor) IsSensitiveField(key string) bool {
+	_, ok := r.fields[strings.ToLower(strings.Trim(key, "\"`"))]
+	return ok
+}
+
+// String masks every detector match in s.
+func (r *Redactor) String(s string) string {
+	for _, detector := range r.detectors {
+		s = detector.Pattern.ReplaceAllStringFunc(s, detector.Mask)
+	}
+	return s
+}
+
+// Value masks v entirely when key is sensitive, otherwise masks detector matches inside strings.
+// Maps and slices are walked recursively.
+func (r *Redactor) Value(key string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if r.IsSensitiveField(key) {
+		return Mask(fmt.Sprintf("%v", v))
+	}
+
+	switch value := v.(type) {
+	case string:
+		return r.String(value)
+	case map[string]interface{}:
+		return r.Fields(value)
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = r.Value("", item)
+		}
+		return items
+	case error:
+		return r.String(value.Error())
+	}
+	return v
+}
+
+// Fields returns a redacted copy of fields.
+func (r *Redactor) Fields(fields map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		redacted[key] = r.Value(key, value)
+	}
+	return redacted
+}
+
+// Mask keeps the first and last 2 characters of long values and masks the rest,
+// short values are fully masked: 0912345678 -> 09******78.
+func Mask(s string) string {
+	length := utf8.RuneCountInString(s)
+	if length == 0 {
+		return s
+	}
+	if length < minPartialMaskLength {
+		return strings.Repeat(string(MaskChar), length)
+	}
+
+	runes := []rune(s)
+	return string(runes[:maskKeep]) + strings.Repeat(string(MaskChar), length-2*maskKeep) + string(runes[length-maskKeep:])
+}
+
+// MaskEmail keeps the first character of the local part and the domain: nguyen@stag.vn -> n*****@stag.vn.
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return Mask(email)
+	}
+
+	local := []rune(email[:at])
+	return string(local[0]) + strings.Repeat(string(MaskChar), len(local)-1) + email[at:]
+}
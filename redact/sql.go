@@ -0,0 +1,144 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+const sqlMask = "'******'"
+
+var (
+	// column = 'value', column LIKE 'value', column = 123
+	sqlComparisonPattern = regexp.MustCompile(`(?i)([A-Za-z_][\w.]*"?|"[\w]+")\s*(=|!=|<>|\bI?LIKE\b)\s*('(?:[^']|'')*'|[\d.+\-]+)`)
+
+	// INSERT INTO table (col1, col2) VALUES (...), (...)
+	sqlInsertPattern = regexp.MustCompile(`(?is)^(\s*INSERT\s+INTO\s+\S+\s*\()([^)]*)(\)\s*VALUES\s*)(.*)$`)
+)
+
+// SQL masks literals compared to or inserted into sensitive columns, then applies the detectors
+// to catch sensitive values in any other literal.
+func (r *Redactor) SQL(sql string) string {
+	sql = r.redactInsert(sql)
+
+	sql = sqlComparisonPattern.ReplaceAllStringFunc(sql, func(match string) string {
+		parts := sqlComparisonPattern.FindStringSubmatch(match)
+		column := parts[1]
+		if idx := strings.LastIndex(column, "."); idx >= 0 {
+			column = column[idx+1:]
+		}
+		if !r.IsSensitiveField(column) {
+			return match
+		}
+		return strings.TrimSuffix(match, parts[3]) + sqlMask
+	})
+
+	return r.String(sql)
+}
+
+func (r *Redactor) redactInsert(sql string) string {
+	parts := sqlInsertPattern.FindStringSubmatch(sql)
+	if parts == nil {
+		return sql
+	}
+
+	columns := strings.Split(parts[2], ",")
+	sensitive := make([]bool, len(columns))
+	hasSensitive := false
+	for i, column := range columns {
+		sensitive[i] = r.IsSensitiveField(strings.TrimSpace(column))
+		hasSensitive = hasSensitive || sensitive[i]
+	}
+	if !hasSensitive {
+		return sql
+	}
+
+	return parts[1] + parts[2] + parts[3] + redactTuples(parts[4], sensitive)
+}
+
+// redactTuples walks "(v1, v2), (v3, v4) RETURNING ..." and masks values at sensitive positions.
+func redactTuples(values string, sensitive []bool) string {
+	var out strings.Builder
+	depth, position := 0, 0
+	inString := false
+	valueStart := -1
+
+	flush := func(end int) {
+		if valueStart < 0 {
+			return
+		}
+		value := values[valueStart:end]
+		if position < len(sensitive) && sensitive[position] {
+			trimmed := strings.TrimSpace(value)
+			if strings.EqualFold(trimmed, "NULL") {
+				out.WriteString(value)
+			} else {
+				out.WriteString(sqlMask)
+			}
+		} else {
+			out.WriteString(value)
+		}
+		valueStart = -1
+	}
+
+	for i := 0; i < len(values); i++ {
+		c := values[i]
+		if inString {
+			end := i + 1
+			if c == '\'' {
+				if i+1 < len(values) && values[i+1] == '\'' {
+					end++
+				} else {
+					inString = false
+				}
+			}
+			// literals outside the tuples are kept, e.g. in ON CONFLICT ... DO UPDATE
+			if valueStart < 0 {
+				out.WriteString(values[i:end])
+			}
+			i = end - 1
+			continue
+		}
+
+		switch {
+		case c == '\'':
+			// quotes are tracked at any depth so parentheses and commas of nested literals are skipped
+			if depth == 1 && valueStart < 0 {
+				valueStart = i
+			}
+			inString = true
+		case c == '(':
+			depth++
+			if depth == 1 {
+				position = 0
+				out.WriteByte(c)
+				continue
+			}
+			if valueStart < 0 {
+				valueStart = i
+			}
+		case c == ')':
+			depth--
+			if depth == 0 {
+				flush(i)
+				out.WriteByte(c)
+				continue
+			}
+		case c == ',' && depth == 1:
+			flush(i)
+			out.WriteByte(c)
+			position++
+			continue
+		default:
+			if depth == 1 && valueStart < 0 && c != ' ' {
+				valueStart = i
+			}
+		}
+
+		if valueStart < 0 {
+			out.WriteByte(c)
+		}
+	}
+	flush(len(values))
+
+	return out.String()
+}
@@ -0,0 +1,395 @@
+package cloud_storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloud_storage "github.com/ngtrvu/zen-go/storage"
+	"github.com/ngtrvu/zen-go/storage/storagetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, "bucket", func(t *testing.T) cloud_storage.CloudStorageInterface {
+		return cloud_storage.NewMemoryStorage()
+	})
+}
+
+func TestLocalStorage(t *testing.T) {
+	storagetest.Run(t, "bucket", func(t *testing.T) cloud_storage.CloudStorageInterface {
+		s, err := cloud_storage.NewLocalStorage(t.TempDir())
+		require.NoError(t, err)
+		s.BaseURL = "http://localhost:8080/files"
+		s.SigningKey = []byte("secret")
+		return s
+	})
+}
+
+func newSignedLocalStorage(t *testing.T) (*cloud_storage.LocalStorage, *httptest.Server) {
+	s, err := cloud_storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	s.SigningKey = []byte("secret")
+
+	mux := http.NewServeMux()
+	mux.Handle("/files/", s.Handler())
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	s.BaseURL = server.URL + "/files"
+	return s, server
+}
+
+func TestLocalStorage_SignedUploadPut(t *testing.T) {
+	s, _ := newSignedLocalStorage(t)
+	ctx := context.Background()
+
+	upload, err := s.SignedUploadURL(ctx, "bucket", "dir/a b.json", cloud_storage.UploadURLOptions{
+		ContentType: "application/json",
+		MinSize:     2,
+		MaxSize:     16,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", upload.Headers["Content-Type"])
+
+	put := func(rawURL string, contentType string, body string) int {
+		req, err := http.NewRequest(http.MethodPut, rawURL, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusBadRequest, put(upload.URL, "text/plain", `{"a":1}`))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, put(upload.URL, "application/json", `{"a":"too large for the url"}`))
+	assert.Equal(t, http.StatusBadRequest, put(upload.URL, "application/json", `1`))
+	assert.Equal(t, http.StatusForbidden, put(strings.Replace(upload.URL, "max_size=16", "max_size=1600", 1), "application/json", `{"a":1}`))
+
+	ok, err := s.Exists(ctx, "bucket", "dir/a b.json")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.Equal(t, http.StatusNoContent, put(upload.URL, "application/json", `{"a":1}`))
+	attrs, err := cloud_storage.VerifyUpload(ctx, s, "bucket", "dir/a b.json", cloud_storage.UploadURLOptions{ContentType: "application/json"})
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", attrs.ContentType)
+
+	// the uploaded object can be downloaded with a signed GET URL
+	url, err := s.SignedURL(ctx, "bucket", "dir", "a b.json", 60)
+	require.NoError(t, err)
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(data))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	assert.Equal(t, `attachment; filename="a b.json"`, resp.Header.Get("Content-Disposition"))
+
+	resp, err = http.Get(strings.Replace(url, "a%20b.json", "other.json", 1))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	defaultTTL, err := s.SignedUploadURL(ctx, "bucket", "late.json", cloud_storage.UploadURLOptions{TTL: -time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, put(defaultTTL.URL, "application/json", `{}`), "a negative ttl uses the default")
+}
+
+func TestLocalStorage_SignedUploadPost(t *testing.T) {
+	s, _ := newSignedLocalStorage(t)
+	ctx := context.Background()
+
+	upload, err := s.SignedUploadURL(ctx, "bucket", "avatar.png", cloud_storage.UploadURLOptions{
+		Method:      http.MethodPost,
+		ContentType: "image/png",
+		MaxSize:     8,
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, upload.URL, "signature")
+
+	assert.Equal(t, http.StatusNoContent, postForm(t, upload, "image/png", "\x89PNG"))
+	data, err := s.ReadFile(ctx, "bucket", "", "avatar.png")
+	require.NoError(t, err)
+	assert.Equal(t, "\x89PNG", string(data))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, postForm(t, upload, "image/png", "\x89PNG too large"))
+	assert.Equal(t, http.StatusBadRequest, postForm(t, upload, "image/gif", "GIF89a"))
+
+	upload.Fields["signature"] = "forged"
+	assert.Equal(t, http.StatusForbidden, postForm(t, upload, "image/png", "\x89PNG"))
+}
+
+func TestS3Storage_SignedUploadURL(t *testing.T) {
+	server := storagetest.NewS3Server()
+	defer server.Close()
+
+	s, err := cloud_storage.NewS3Storage(cloud_storage.S3Options{
+		Endpoint:        server.URL,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	upload, err := s.SignedUploadURL(ctx, "bucket", "a.csv", cloud_storage.UploadURLOptions{ContentType: "text/csv"})
+	require.NoError(t, err)
+	assert.Contains(t, upload.URL, "X-Amz-SignedHeaders=content-type%3Bhost")
+
+	req, err := http.NewRequest(http.MethodPut, upload.URL, strings.NewReader("a,b\n"))
+	require.NoError(t, err)
+	for key, value := range upload.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	attrs, err := cloud_storage.VerifyUpload(ctx, s, "bucket", "a.csv", cloud_storage.UploadURLOptions{ContentType: "text/csv"})
+	require.NoError(t, err)
+	assert.Equal(t, "text/csv", attrs.ContentType)
+
+	upload, err = s.SignedUploadURL(ctx, "bucket", "b.png", cloud_storage.UploadURLOptions{
+		Method:      http.MethodPost,
+		ContentType: "image/png",
+		MaxSize:     8,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/bucket/", upload.URL)
+	assert.Equal(t, "b.png", upload.Fields["key"])
+	assert.NotEmpty(t, upload.Fields["x-amz-signature"])
+
+	assert.Equal(t, http.StatusNoContent, postForm(t, upload, "image/png", "\x89PNG"))
+	assert.Equal(t, http.StatusBadRequest, postForm(t, upload, "image/png", "\x89PNG too large"))
+
+	_, err = s.SignedUploadURL(ctx, "bucket", "b.png", cloud_storage.UploadURLOptions{TTL: 8 * 24 * time.Hour})
+	assert.Error(t, err)
+}
+
+// postForm uploads content like a browser form, the file comes last.
+func postForm(t *testing.T, upload *cloud_storage.SignedUpload, contentType string, content string) int {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, value := range upload.Fields {
+		require.NoError(t, form.WriteField(key, value))
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="upload"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	require.NoError(t, err)
+	part.Write([]byte(content))
+	require.NoError(t, form.Close())
+
+	resp, err := http.Post(upload.URL, form.FormDataContentType(), &body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSniffContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	tests := []struct {
+		name     string
+		head     []byte
+		declared []string
+		want     string
+	}{
+		{name: "sniffed", head: png, declared: []string{"text/csv"}, want: "image/png"},
+		{name: "text format", head: []byte("a,b\n1,2\n"), declared: []string{"text/csv"}, want: "text/csv"},
+		{name: "json", head: []byte(`{"a": 1}`), declared: []string{"application/json"}, want: "application/json"},
+		{name: "text declared as an image", head: []byte("not an image"), declared: []string{"image/png"}, want: "text/plain; charset=utf-8"},
+		{name: "text declared as html", head: []byte("plain words"), declared: []string{"text/html"}, want: "text/plain; charset=utf-8"},
+		{name: "unknown binary format", head: []byte{0x00, 0x01, 0xFE}, declared: []string{"application/x-parquet"}, want: "application/x-parquet"},
+		{name: "binary declared as a sniffed type", head: []byte{0x00, 0x01, 0xFE}, declared: []string{"image/png"}, want: "application/octet-stream"},
+		{name: "first consistent type", head: []byte("a,b"), declared: []string{"image/png", "", "text/csv"}, want: "text/csv"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, cloud_storage.SniffContentType(test.head, test.declared...))
+		})
+	}
+}
+
+func TestLocalStorage_PathTraversal(t *testing.T) {
+	s, err := cloud_storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	assert.Error(t, s.CreateFile(context.Background(), "bucket", "../../", []byte("x"), "escape.txt"))
+	assert.Error(t, s.CreateFile(context.Background(), "../bucket", "", []byte("x"), "escape.txt"))
+}
+
+func TestLocalStorage_ListChecksum(t *testing.T) {
+	root := t.TempDir()
+	s, err := cloud_storage.NewLocalStorage(root)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, s.CreateFile(ctx, "bucket", "", []byte("hello"), "written.txt"))
+	// files copied in the bucket directory by hand have no metadata
+	require.NoError(t, os.WriteFile(filepath.Join(root, "bucket", "copied.txt"), []byte("hello"), 0o644))
+
+	page, err := s.List(ctx, "bucket", cloud_storage.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Objects, 2)
+	assert.Equal(t, "copied.txt", page.Objects[0].Name)
+	assert.Empty(t, page.Objects[0].MD5, "List does not read the files")
+	assert.Equal(t, "written.txt", page.Objects[1].Name)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", page.Objects[1].MD5)
+
+	attrs, err := s.Stat(ctx, "bucket", "copied.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", attrs.MD5)
+
+	require.NoError(t, s.Copy(ctx, "bucket", "copied.txt", "bucket", "copy.txt"))
+	page, err = s.List(ctx, "bucket", cloud_storage.ListOptions{Prefix: "copy."})
+	require.NoError(t, err)
+	require.Len(t, page.Objects, 1)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", page.Objects[0].MD5)
+}
+
+func TestS3Storage(t *testing.T) {
+	server := storagetest.NewS3Server()
+	defer server.Close()
+
+	storagetest.Run(t, "bucket", func(t *testing.T) cloud_storage.CloudStorageInterface {
+		s, err := cloud_storage.NewS3Storage(cloud_storage.S3Options{
+			Endpoint:        server.URL,
+			AccessKeyID:     "key",
+			SecretAccessKey: "secret",
+			PathStyle:       true,
+		})
+		require.NoError(t, err)
+		return s
+	})
+}
+
+func TestS3Storage_SignedURL(t *testing.T) {
+	server := storagetest.NewS3Server()
+	defer server.Close()
+
+	s, err := cloud_storage.NewS3Storage(cloud_storage.S3Options{
+		Endpoint:        server.URL,
+		Region:          "ap-southeast-1",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, s.CreateFile(ctx, "bucket", "dir", []byte("hello"), "a b.txt"))
+
+	url, err := s.SignedURL(ctx, "bucket", "dir", "a b.txt", 300)
+	require.NoError(t, err)
+	assert.Contains(t, url, "/bucket/dir/a%20b.txt?")
+	assert.Contains(t, url, "X-Amz-Credential=key%2F")
+	assert.Contains(t, url, "%2Fap-southeast-1%2Fs3%2Faws4_request")
+	assert.Contains(t, url, "X-Amz-Expires=300")
+
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = s.SignedURL(ctx, "bucket", "dir", "a b.txt", 0)
+	assert.Error(t, err)
+}
+
+func TestS3Storage_MultipartUpload(t *testing.T) {
+	server := storagetest.NewS3Server()
+	defer server.Close()
+
+	s, err := cloud_storage.NewS3Storage(cloud_storage.S3Options{
+		Endpoint:  server.URL,
+		PathStyle: true,
+		PartSize:  1024,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	content := strings.Repeat("z", 3000)
+	require.NoError(t, s.Upload(ctx, "bucket", "big.txt", strings.NewReader(content), cloud_storage.UploadOptions{
+		Metadata: map[string]string{"owner": "ops"},
+	}))
+	assert.Zero(t, server.Uploads())
+
+	data, err := s.ReadFile(ctx, "bucket", "", "big.txt")
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+
+	attrs, err := s.Stat(ctx, "bucket", "big.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "ops", attrs.Metadata["owner"])
+
+	// a failing reader aborts the upload
+	failing := io.MultiReader(strings.NewReader(content), iotest.ErrReader(errors.New("disk error")))
+	assert.ErrorContains(t, s.Upload(ctx, "bucket", "failed.txt", failing, cloud_storage.UploadOptions{}), "disk error")
+	assert.Zero(t, server.Uploads())
+
+	ok, err := s.Exists(ctx, "bucket", "failed.txt")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestS3Storage_UploadBuffersTheContent(t *testing.T) {
+	server := storagetest.NewS3Server()
+	defer server.Close()
+
+	s, err := cloud_storage.NewS3Storage(cloud_storage.S3Options{Endpoint: server.URL, PathStyle: true})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// a small object does not allocate a part of DefaultS3PartSize
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	require.NoError(t, s.Upload(ctx, "bucket", "small.txt", strings.NewReader("hello"), cloud_storage.UploadOptions{}))
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(cloud_storage.DefaultS3PartSize/4))
+
+	// a reader without a length filling whole parts
+	s, err = cloud_storage.NewS3Storage(cloud_storage.S3Options{Endpoint: server.URL, PathStyle: true, PartSize: 1024})
+	require.NoError(t, err)
+	content := strings.Repeat("z", 2048)
+	require.NoError(t, s.Upload(ctx, "bucket", "parts.txt", iotest.HalfReader(strings.NewReader(content)), cloud_storage.UploadOptions{}))
+	data, err := s.ReadFile(ctx, "bucket", "", "parts.txt")
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := cloud_storage.New(ctx, &cloud_storage.StorageConfig{Backend: cloud_storage.BackendMemory})
+	require.NoError(t, err)
+	assert.IsType(t, &cloud_storage.MemoryStorage{}, s)
+
+	s, err = cloud_storage.New(ctx, &cloud_storage.StorageConfig{Backend: cloud_storage.BackendLocal, LocalRoot: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &cloud_storage.LocalStorage{}, s)
+
+	_, err = cloud_storage.New(ctx, &cloud_storage.StorageConfig{Backend: cloud_storage.BackendS3, S3Endpoint: "minio:9000"})
+	assert.Error(t, err)
+
+	_, err = cloud_storage.New(ctx, &cloud_storage.StorageConfig{Backend: "ftp"})
+	assert.True(t, err != nil && strings.Contains(err.Error(), "ftp"))
+}
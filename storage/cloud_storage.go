@@ -3,45 +3,75 @@ package cloud_storage
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"path/filepath"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/ngtrvu/zen-go/log"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 )
 
+var (
+	ErrObjectNotFound = errors.New("storage: object not found")
+	ErrInvalidRange   = errors.New("storage: invalid range")
+)
+
+// CloudStorageInterface is implemented by the GCS, S3, local filesystem and memory backends, see New.
+// Object names are joined with ObjectName, missing objects fail with ErrObjectNotFound.
 type CloudStorageInterface interface {
-	LoadJSON(bucketName string, filePath string, v any) error
-	LoadJSONL(bucketName string, filePath string) ([][]byte, error)
+	LoadJSON(ctx context.Context, bucketName string, filePath string, v any) error
+	LoadJSONL(ctx context.Context, bucketName string, filePath string) ([][]byte, error)
 	CreateFile(ctx context.Context, bucketName string, uploadPath string, file []byte, fileName string) (err error)
 	ReadFile(ctx context.Context, bucketName string, uploadPath string, fileName string) (data []byte, err error)
 	SignedURL(ctx context.Context, bucketName string, uploadPath string, fileName string, ttl int) (url string, err error)
+	// SignedUploadURL lets a client upload an object directly, check the result with VerifyUpload.
+	SignedUploadURL(ctx context.Context, bucketName string, name string, opts UploadURLOptions) (*SignedUpload, error)
+
+	// Upload streams r into an object without buffering it whole.
+	Upload(ctx context.Context, bucketName string, name string, r io.Reader, opts UploadOptions) error
+	// NewReader streams an object or a range of it, gzip objects are decompressed. The reader must be closed.
+	NewReader(ctx context.Context, bucketName string, name string, opts DownloadOptions) (io.ReadCloser, error)
+	// Download streams an object or a range of it into w and returns the number of bytes written.
+	Download(ctx context.Context, bucketName string, name string, w io.Writer, opts DownloadOptions) (int64, error)
+
+	// List returns a page of the objects sorted by name.
+	List(ctx context.Context, bucketName string, opts ListOptions) (*ListPage, error)
+	Stat(ctx context.Context, bucketName string, name string) (*ObjectAttrs, error)
+	Exists(ctx context.Context, bucketName string, name string) (bool, error)
+
+	// Delete removes an object, deleting a missing object is not an error.
+	Delete(ctx context.Context, bucketName string, name string) error
+	Copy(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error
+	Move(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error
 }
 
+// CloudStorage is the Google Cloud Storage backend.
 type CloudStorage struct {
 	client *storage.Client
 }
 
 func NewCloudStorage() *CloudStorage {
-	cs := new(CloudStorage)
-
-	ctx := context.Background()
-	client, err := storage.NewClient(ctx)
+	cs, err := NewGCSStorage(context.Background())
 	if err != nil {
 		log.Fatal("storage.NewClient: %v", err)
 	}
-	defer client.Close()
 
-	_, cancel := context.WithTimeout(ctx, time.Second*50)
-	defer cancel()
+	return cs
+}
 
-	cs.client = client
+// NewGCSStorage creates a client with the default credentials, Close releases it.
+func NewGCSStorage(ctx context.Context) (*CloudStorage, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return cs
+	return NewCloudStorageWithClient(client), nil
 }
 
 func NewCloudStorageWithClient(client *storage.Client) *CloudStorage {
@@ -51,58 +81,33 @@ func NewCloudStorageWithClient(client *storage.Client) *CloudStorage {
 	return cs
 }
 
+func (cs *CloudStorage) Close() error {
+	return cs.client.Close()
+}
+
 // LoadJSON load json file from cloud storage
 //
 //	bucketName: GCS bucket name
 //	filePath: file path in bucket
 //	v: Output
-func (cs *CloudStorage) LoadJSON(bucketName string, filePath string, v any) error {
-	bucket := cs.client.Bucket(bucketName)
-
-	ctx := context.Background()
-	rc, err := bucket.Object(filePath).NewReader(ctx)
-	if err != nil {
-		return fmt.Errorf("Object(%q).NewReader: %w", filePath, err)
-	}
-	defer rc.Close()
-
-	dataJson, err := io.ReadAll(rc)
+func (cs *CloudStorage) LoadJSON(ctx context.Context, bucketName string, filePath string, v any) error {
+	data, err := readObject(ctx, cs, bucketName, filePath)
 	if err != nil {
-		return fmt.Errorf("ioutil.ReadAll: %w", err)
+		return err
 	}
-	return json.Unmarshal(dataJson, &v)
+	return unmarshalJSON(data, v)
 }
 
-// LoadJSONL loads newline-delimited JSON file from cloud storage
+// LoadJSONL loads newline-delimited JSON file from cloud storage, see NewJSONLIterator for large files
 //
 //	bucketName: GCS bucket name
 //	filePath: file path in bucket
-//	v: Output
-func (cs *CloudStorage) LoadJSONL(bucketName string, filePath string) ([][]byte, error) {
-	bucket := cs.client.Bucket(bucketName)
-
-	ctx := context.Background()
-	rc, err := bucket.Object(filePath).NewReader(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("Object(%q).NewReader: %w", filePath, err)
-	}
-	defer rc.Close()
-
-	data, err := io.ReadAll(rc)
+func (cs *CloudStorage) LoadJSONL(ctx context.Context, bucketName string, filePath string) ([][]byte, error) {
+	data, err := readObject(ctx, cs, bucketName, filePath)
 	if err != nil {
-		return nil, fmt.Errorf("io.ReadAll: %w", err)
-	}
-
-	var v [][]byte
-	lines := bytes.Split(data, []byte("\n"))
-	for _, line := range lines {
-		if len(line) == 0 {
-			continue
-		}
-		v = append(v, line)
+		return nil, err
 	}
-
-	return v, err
+	return splitJSONL(data), nil
 }
 
 // CreateFile Upload file to cloud storage
@@ -112,16 +117,7 @@ func (cs *CloudStorage) LoadJSONL(bucketName string, filePath string) ([][]byte,
 //	file: file content
 //	fileName: file name
 func (cs *CloudStorage) CreateFile(ctx context.Context, bucketName string, uploadPath string, file []byte, fileName string) (err error) {
-	reader := bytes.NewReader(file)
-	writer := cs.client.Bucket(bucketName).Object(filepath.Join(uploadPath, fileName)).NewWriter(ctx)
-	if _, err = io.Copy(writer, reader); err != nil {
-		return
-	}
-
-	if err = writer.Close(); err != nil {
-		return
-	}
-	return
+	return cs.Upload(ctx, bucketName, ObjectName(uploadPath, fileName), bytes.NewReader(file), UploadOptions{})
 }
 
 // ReadFile Read file to cloud storage
@@ -130,13 +126,7 @@ func (cs *CloudStorage) CreateFile(ctx context.Context, bucketName string, uploa
 //	uploadPath: file path in bucket
 //	fileName: file name
 func (cs *CloudStorage) ReadFile(ctx context.Context, bucketName string, uploadPath string, fileName string) (data []byte, err error) {
-	reader, err := cs.client.Bucket(bucketName).Object(uploadPath + fileName).NewReader(ctx)
-	if err != nil {
-		return
-	}
-	defer reader.Close()
-
-	return io.ReadAll(reader)
+	return readObject(ctx, cs, bucketName, ObjectName(uploadPath, fileName))
 }
 
 // SignedURL generate a shared url
@@ -152,5 +142,201 @@ func (cs *CloudStorage) SignedURL(ctx context.Context, bucketName string, upload
 		Expires: time.Now().Add(time.Duration(ttl) * time.Second),
 	}
 
-	return cs.client.Bucket(bucketName).SignedURL(uploadPath+fileName, opts)
+	return cs.client.Bucket(bucketName).SignedURL(ObjectName(uploadPath, fileName), opts)
+}
+
+// SignedUploadURL generate a signed PUT URL or POST policy for a direct upload
+//
+//	bucketName: GCS bucket name
+//	name: object name
+//	opts: method, content type, size range and time to live
+func (cs *CloudStorage) SignedUploadURL(ctx context.Context, bucketName string, name string, opts UploadURLOptions) (*SignedUpload, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	name = ObjectName(name, "")
+	expires := time.Now().Add(opts.TTL)
+	bucket := cs.client.Bucket(bucketName)
+	if opts.Method == http.MethodPost {
+		policyOpts := &storage.PostPolicyV4Options{
+			Expires:    expires,
+			Conditions: []storage.PostPolicyV4Condition{storage.ConditionContentLengthRange(uint64(opts.MinSize), uint64(opts.maxSize()))},
+			Fields:     &storage.PolicyV4Fields{ContentType: opts.ContentType},
+		}
+		policy, err := bucket.GenerateSignedPostPolicyV4(name, policyOpts)
+		if err != nil {
+			return nil, err
+		}
+		return &SignedUpload{Method: http.MethodPost, URL: policy.URL, Fields: policy.Fields, Expires: expires}, nil
+	}
+
+	upload := &SignedUpload{Method: http.MethodPut, Headers: map[string]string{}, Expires: expires}
+	urlOpts := &storage.SignedURLOptions{
+		Scheme:      storage.SigningSchemeV4,
+		Method:      http.MethodPut,
+		ContentType: opts.ContentType,
+		Expires:     expires,
+	}
+	if opts.ContentType != "" {
+		upload.Headers["Content-Type"] = opts.ContentType
+	}
+	if opts.MinSize > 0 || opts.MaxSize > 0 {
+		sizeRange := fmt.Sprintf("%d,%d", opts.MinSize, opts.maxSize())
+		urlOpts.Headers = []string{"x-goog-content-length-range:" + sizeRange}
+		upload.Headers["X-Goog-Content-Length-Range"] = sizeRange
+	}
+
+	upload.URL, err = bucket.SignedURL(name, urlOpts)
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Upload streams an object to cloud storage
+//
+//	bucketName: GCS bucket name
+//	name: object name
+//	r: file content
+//	opts: content type, metadata and compression
+func (cs *CloudStorage) Upload(ctx context.Context, bucketName string, name string, r io.Reader, opts UploadOptions) error {
+	name = ObjectName(name, "")
+	body, contentType, contentEncoding, err := prepareUpload(name, r, opts)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// cancelling the context before closing the writer aborts the upload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writer := cs.client.Bucket(bucketName).Object(name).NewWriter(ctx)
+	writer.ContentType = contentType
+	writer.ContentEncoding = contentEncoding
+	writer.Metadata = opts.Metadata
+	if _, err := io.Copy(writer, body); err != nil {
+		cancel()
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+// NewReader streams an object from cloud storage
+//
+//	bucketName: GCS bucket name
+//	name: object name
+//	opts: range to read
+func (cs *CloudStorage) NewReader(ctx context.Context, bucketName string, name string, opts DownloadOptions) (io.ReadCloser, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	length := opts.Length
+	if length == 0 {
+		length = -1
+	}
+	reader, err := cs.client.Bucket(bucketName).Object(ObjectName(name, "")).NewRangeReader(ctx, opts.Offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("Object(%q).NewRangeReader: %w", name, gcsError(err))
+	}
+
+	// gzip objects are decompressed by GCS and served whole whatever the range
+	if reader.Attrs.Decompressed && opts.ranged() {
+		return decodeObject(reader, "", opts)
+	}
+	return reader, nil
+}
+
+func (cs *CloudStorage) Download(ctx context.Context, bucketName string, name string, w io.Writer, opts DownloadOptions) (int64, error) {
+	return download(ctx, cs, bucketName, name, w, opts)
+}
+
+// List returns a page of objects
+//
+//	bucketName: GCS bucket name
+//	opts: prefix and pagination
+func (cs *CloudStorage) List(ctx context.Context, bucketName string, opts ListOptions) (*ListPage, error) {
+	it := cs.client.Bucket(bucketName).Objects(ctx, &storage.Query{Prefix: opts.Prefix})
+	pager := iterator.NewPager(it, opts.pageSize(), opts.PageToken)
+
+	var objects []*storage.ObjectAttrs
+	nextPageToken, err := pager.NextPage(&objects)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ListPage{NextPageToken: nextPageToken}
+	for _, attrs := range objects {
+		page.Objects = append(page.Objects, *objectAttrs(attrs))
+	}
+	return page, nil
+}
+
+// Stat returns the attributes of an object
+//
+//	bucketName: GCS bucket name
+//	name: object name
+func (cs *CloudStorage) Stat(ctx context.Context, bucketName string, name string) (*ObjectAttrs, error) {
+	attrs, err := cs.client.Bucket(bucketName).Object(ObjectName(name, "")).Attrs(ctx)
+	if err != nil {
+		return nil, gcsError(err)
+	}
+	return objectAttrs(attrs), nil
+}
+
+func (cs *CloudStorage) Exists(ctx context.Context, bucketName string, name string) (bool, error) {
+	return exists(cs.Stat(ctx, bucketName, name))
+}
+
+func (cs *CloudStorage) Delete(ctx context.Context, bucketName string, name string) error {
+	err := cs.client.Bucket(bucketName).Object(ObjectName(name, "")).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Copy copies an object on the server side, across buckets too
+func (cs *CloudStorage) Copy(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	src := cs.client.Bucket(srcBucket).Object(ObjectName(srcName, ""))
+	dst := cs.client.Bucket(dstBucket).Object(ObjectName(dstName, ""))
+
+	_, err := dst.CopierFrom(src).Run(ctx)
+	return gcsError(err)
+}
+
+func (cs *CloudStorage) Move(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	return move(ctx, cs, srcBucket, srcName, dstBucket, dstName)
+}
+
+func objectAttrs(attrs *storage.ObjectAttrs) *ObjectAttrs {
+	return &ObjectAttrs{
+		Bucket:          attrs.Bucket,
+		Name:            attrs.Name,
+		Size:            attrs.Size,
+		ContentType:     attrs.ContentType,
+		ContentEncoding: attrs.ContentEncoding,
+		Metadata:        attrs.Metadata,
+		MD5:             hex.EncodeToString(attrs.MD5),
+		Updated:         attrs.Updated,
+	}
+}
+
+// gcsError maps the GCS not found and range errors to ErrObjectNotFound and ErrInvalidRange,
+// keeping the original in the chain.
+func gcsError(err error) error {
+	var apiErr *googleapi.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrObjectNotExist):
+		return fmt.Errorf("%w: %w", ErrObjectNotFound, err)
+	case errors.As(err, &apiErr) && apiErr.Code == http.StatusRequestedRangeNotSatisfiable:
+		return fmt.Errorf("%w: %w", ErrInvalidRange, err)
+	}
+	return err
 }
@@ -0,0 +1,60 @@
+package cloud_storage
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	BackendGCS    = "gcs"
+	BackendS3     = "s3"
+	BackendLocal  = "local"
+	BackendMemory = "memory"
+)
+
+// StorageConfig selects the storage backend, load it with config.Load.
+type StorageConfig struct {
+	Backend string `config:"STORAGE_BACKEND" default:"gcs" validate:"oneof=gcs s3 local memory"`
+
+	// LocalRoot is the directory holding one sub directory per bucket with the local backend.
+	LocalRoot string `config:"STORAGE_LOCAL_ROOT" default:"./data/storage"`
+	// LocalBaseURL and LocalSigningKey enable the signed URLs of LocalStorage.Handler.
+	LocalBaseURL    string `config:"STORAGE_LOCAL_BASE_URL"`
+	LocalSigningKey string `config:"STORAGE_LOCAL_SIGNING_KEY" secret:"true"`
+
+	S3Endpoint        string `config:"STORAGE_S3_ENDPOINT"`
+	S3Region          string `config:"STORAGE_S3_REGION" default:"us-east-1"`
+	S3AccessKeyID     string `config:"STORAGE_S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `config:"STORAGE_S3_SECRET_ACCESS_KEY" secret:"true"`
+	S3PathStyle       bool   `config:"STORAGE_S3_PATH_STYLE"`
+	S3PartSize        int    `config:"STORAGE_S3_PART_SIZE"`
+}
+
+// New creates the backend selected by cfg.Backend.
+func New(ctx context.Context, cfg *StorageConfig) (CloudStorageInterface, error) {
+	switch cfg.Backend {
+	case BackendGCS, "":
+		return NewGCSStorage(ctx)
+	case BackendS3:
+		return NewS3Storage(S3Options{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PathStyle:       cfg.S3PathStyle,
+			PartSize:        cfg.S3PartSize,
+		})
+	case BackendLocal:
+		ls, err := NewLocalStorage(cfg.LocalRoot)
+		if err != nil {
+			return nil, err
+		}
+		ls.BaseURL = cfg.LocalBaseURL
+		ls.SigningKey = []byte(cfg.LocalSigningKey)
+		return ls, nil
+	case BackendMemory:
+		return NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,100 @@
+package cloud_storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JSONLIterator decodes a newline-delimited JSON object line by line into values of type T,
+// only one line is kept in memory. Empty lines are skipped.
+//
+//	it, err := cloud_storage.NewJSONLIterator[Statement](ctx, storage, bucketName, "exports/statements.jsonl.gz")
+//	if err != nil {
+//		return err
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		statement := it.Value()
+//	}
+//	return it.Err()
+type JSONLIterator[T any] struct {
+	rc     io.ReadCloser
+	reader *bufio.Reader
+	line   int
+	value  T
+	err    error
+}
+
+func NewJSONLIterator[T any](ctx context.Context, s CloudStorageInterface, bucketName string, name string) (*JSONLIterator[T], error) {
+	rc, err := s.NewReader(ctx, bucketName, name, DownloadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLReader[T](rc), nil
+}
+
+// NewJSONLReader decodes the lines of rc, Close closes it.
+func NewJSONLReader[T any](rc io.ReadCloser) *JSONLIterator[T] {
+	return &JSONLIterator[T]{rc: rc, reader: bufio.NewReader(rc)}
+}
+
+// Next decodes the next line, it returns false at the end or on the first error, see Err.
+func (it *JSONLIterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	for {
+		line, err := it.reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			it.err = err
+			return false
+		}
+		if len(line) > 0 {
+			it.line++
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var value T
+			if err := json.Unmarshal(line, &value); err != nil {
+				it.err = fmt.Errorf("storage: jsonl line %d: %w", it.line, err)
+				return false
+			}
+			it.value = value
+			return true
+		}
+
+		if errors.Is(err, io.EOF) {
+			it.err = io.EOF
+			return false
+		}
+	}
+}
+
+// Value is the value decoded by the last call to Next.
+func (it *JSONLIterator[T]) Value() T {
+	return it.value
+}
+
+// Line is the line number of Value, starting at 1.
+func (it *JSONLIterator[T]) Line() int {
+	return it.line
+}
+
+// Err is the error stopping Next, nil at the end of the object.
+func (it *JSONLIterator[T]) Err() error {
+	if errors.Is(it.err, io.EOF) {
+		return nil
+	}
+	return it.err
+}
+
+func (it *JSONLIterator[T]) Close() error {
+	return it.rc.Close()
+}
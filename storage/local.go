@@ -0,0 +1,495 @@
+package cloud_storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// localTempPrefix names the files being written, they are not listed.
+	localTempPrefix = ".upload-"
+
+	// localMetadataDir holds the content type, encoding and metadata of the objects as
+	// Root/.metadata/<bucket>/<object name>.json, bucket names cannot start with a dot.
+	localMetadataDir = ".metadata"
+)
+
+// LocalStorage stores objects as files under Root/<bucket>/<object name>, for development and on-prem.
+type LocalStorage struct {
+	Root string
+
+	// BaseURL is where Handler is served, e.g. http://localhost:8080/files, and SigningKey signs its
+	// URLs. SignedURL falls back to file:// URLs without them.
+	BaseURL    string
+	SigningKey []byte
+}
+
+type localMetadata struct {
+	ContentType     string            `json:"content_type,omitempty"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
+	Metadata        map[string]string `json:"metadata,omitempty"`
+	// MD5 is the hex encoded checksum of the file computed while writing it.
+	MD5 string `json:"md5,omitempty"`
+}
+
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStorage{Root: root}, nil
+}
+
+func (ls *LocalStorage) LoadJSON(ctx context.Context, bucketName string, filePath string, v any) error {
+	data, err := readObject(ctx, ls, bucketName, filePath)
+	if err != nil {
+		return err
+	}
+	return unmarshalJSON(data, v)
+}
+
+func (ls *LocalStorage) LoadJSONL(ctx context.Context, bucketName string, filePath string) ([][]byte, error) {
+	data, err := readObject(ctx, ls, bucketName, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return splitJSONL(data), nil
+}
+
+func (ls *LocalStorage) CreateFile(ctx context.Context, bucketName string, uploadPath string, file []byte, fileName string) error {
+	return ls.Upload(ctx, bucketName, ObjectName(uploadPath, fileName), bytes.NewReader(file), UploadOptions{})
+}
+
+func (ls *LocalStorage) ReadFile(ctx context.Context, bucketName string, uploadPath string, fileName string) ([]byte, error) {
+	return readObject(ctx, ls, bucketName, ObjectName(uploadPath, fileName))
+}
+
+// SignedURL returns a GET URL of Handler valid for ttl seconds, or the file:// URL of the object
+// when BaseURL or SigningKey is not set.
+func (ls *LocalStorage) SignedURL(ctx context.Context, bucketName string, uploadPath string, fileName string, ttl int) (string, error) {
+	name := ObjectName(uploadPath, fileName)
+	filePath, err := ls.filePath(bucketName, name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		return "", localError(err, bucketName, fileName)
+	}
+	if ls.BaseURL == "" || len(ls.SigningKey) == 0 {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filePath)}).String(), nil
+	}
+
+	params := url.Values{}
+	params.Set("expires", strconv.FormatInt(time.Now().Add(time.Duration(ttl)*time.Second).Unix(), 10))
+	u, err := ls.sign(http.MethodGet, bucketName, name, params)
+	if err != nil {
+		return "", err
+	}
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+func (ls *LocalStorage) Upload(ctx context.Context, bucketName string, name string, r io.Reader, opts UploadOptions) error {
+	name = ObjectName(name, "")
+	filePath, err := ls.filePath(bucketName, name)
+	if err != nil {
+		return err
+	}
+
+	body, contentType, contentEncoding, err := prepareUpload(name, r, opts)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	hash := md5.New()
+	if err := writeFile(filePath, io.TeeReader(body, hash)); err != nil {
+		return err
+	}
+	return ls.writeMetadata(filePath, &localMetadata{
+		ContentType:     contentType,
+		ContentEncoding: contentEncoding,
+		Metadata:        opts.Metadata,
+		MD5:             hex.EncodeToString(hash.Sum(nil)),
+	})
+}
+
+func (ls *LocalStorage) NewReader(ctx context.Context, bucketName string, name string, opts DownloadOptions) (io.ReadCloser, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	filePath, err := ls.filePath(bucketName, name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, localError(err, bucketName, name)
+	}
+	metadata, err := ls.readMetadata(filePath)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if metadata.ContentEncoding != "" {
+		return decodeObject(file, metadata.ContentEncoding, opts)
+	}
+	if !opts.ranged() {
+		return file, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if opts.Offset >= info.Size() {
+		file.Close()
+		return nil, fmt.Errorf("%w: offset %d is after the end", ErrInvalidRange, opts.Offset)
+	}
+
+	reader := io.Reader(io.NewSectionReader(file, opts.Offset, info.Size()-opts.Offset))
+	if opts.Length > 0 {
+		reader = io.LimitReader(reader, opts.Length)
+	}
+	return readCloser{Reader: reader, Closer: file}, nil
+}
+
+func (ls *LocalStorage) Download(ctx context.Context, bucketName string, name string, w io.Writer, opts DownloadOptions) (int64, error) {
+	return download(ctx, ls, bucketName, name, w, opts)
+}
+
+func (ls *LocalStorage) List(ctx context.Context, bucketName string, opts ListOptions) (*ListPage, error) {
+	bucketDir, err := ls.bucketDir(bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	// only walk the directory of the prefix, e.g. reports/2024 for reports/2024/01-
+	walkDir := filepath.Join(bucketDir, filepath.FromSlash(path.Dir(opts.Prefix)))
+	if walkDir != bucketDir && !strings.HasPrefix(walkDir, bucketDir+string(filepath.Separator)) {
+		return nil, fmt.Errorf("storage: invalid prefix %q", opts.Prefix)
+	}
+
+	var names []string
+	err = filepath.WalkDir(walkDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), localTempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(bucketDir, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, opts.Prefix) && name > opts.PageToken {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	page := &ListPage{}
+	if len(names) > opts.pageSize() {
+		names = names[:opts.pageSize()]
+		page.NextPageToken = names[len(names)-1]
+	}
+	for _, name := range names {
+		attrs, err := ls.stat(bucketName, name, false)
+		if errors.Is(err, ErrObjectNotFound) {
+			// deleted while listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		page.Objects = append(page.Objects, *attrs)
+	}
+	return page, nil
+}
+
+// Stat reads the whole file to compute its checksum when it was not written by LocalStorage.
+func (ls *LocalStorage) Stat(ctx context.Context, bucketName string, name string) (*ObjectAttrs, error) {
+	return ls.stat(bucketName, name, true)
+}
+
+// stat takes the checksum from the metadata, files without it are only hashed when hashContent is set
+// and have no MD5 otherwise.
+func (ls *LocalStorage) stat(bucketName string, name string, hashContent bool) (*ObjectAttrs, error) {
+	name = ObjectName(name, "")
+	filePath, err := ls.filePath(bucketName, name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, localError(err, bucketName, name)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucketName, name)
+	}
+	metadata, err := ls.readMetadata(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first 512 bytes are enough to sniff the content type of files without metadata
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	checksum := metadata.MD5
+	if checksum == "" && hashContent {
+		hash := md5.New()
+		hash.Write(head[:n])
+		if _, err := io.Copy(hash, file); err != nil {
+			return nil, err
+		}
+		checksum = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	contentType := metadata.ContentType
+	if contentType == "" {
+		contentType = detectContentType(name, head[:n])
+	}
+	return &ObjectAttrs{
+		Bucket:          bucketName,
+		Name:            name,
+		Size:            info.Size(),
+		ContentType:     contentType,
+		ContentEncoding: metadata.ContentEncoding,
+		Metadata:        metadata.Metadata,
+		MD5:             checksum,
+		Updated:         info.ModTime(),
+	}, nil
+}
+
+func (ls *LocalStorage) Exists(ctx context.Context, bucketName string, name string) (bool, error) {
+	filePath, err := ls.filePath(bucketName, name)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// Delete removes the file, its metadata and their empty parent directories.
+func (ls *LocalStorage) Delete(ctx context.Context, bucketName string, name string) error {
+	filePath, err := ls.filePath(bucketName, name)
+	if err != nil {
+		return err
+	}
+	metadataPath := ls.metadataPath(filePath)
+
+	for _, removed := range []string{filePath, metadataPath} {
+		if err := os.Remove(removed); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	bucketDir, _ := ls.bucketDir(bucketName)
+	removeEmptyDirs(filepath.Dir(filePath), bucketDir)
+	removeEmptyDirs(filepath.Dir(metadataPath), filepath.Join(ls.Root, localMetadataDir, bucketName))
+	return nil
+}
+
+func (ls *LocalStorage) Copy(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	srcPath, err := ls.filePath(srcBucket, srcName)
+	if err != nil {
+		return err
+	}
+	dstPath, err := ls.filePath(dstBucket, dstName)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return localError(err, srcBucket, srcName)
+	}
+	defer src.Close()
+
+	metadata, err := ls.readMetadata(srcPath)
+	if err != nil {
+		return err
+	}
+	hash := md5.New()
+	if err := writeFile(dstPath, io.TeeReader(src, hash)); err != nil {
+		return err
+	}
+	metadata.MD5 = hex.EncodeToString(hash.Sum(nil))
+	return ls.writeMetadata(dstPath, metadata)
+}
+
+// Move renames the file, the object is never missing from both places.
+func (ls *LocalStorage) Move(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	srcPath, err := ls.filePath(srcBucket, srcName)
+	if err != nil {
+		return err
+	}
+	dstPath, err := ls.filePath(dstBucket, dstName)
+	if err != nil {
+		return err
+	}
+	if srcPath == dstPath {
+		return nil
+	}
+
+	if _, err := os.Stat(srcPath); err != nil {
+		return localError(err, srcBucket, srcName)
+	}
+	metadata, err := ls.readMetadata(srcPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		return err
+	}
+	if err := ls.writeMetadata(dstPath, metadata); err != nil {
+		return err
+	}
+	return ls.Delete(ctx, srcBucket, srcName)
+}
+
+// filePath maps an object to its file, rejecting names escaping the bucket directory.
+func (ls *LocalStorage) filePath(bucketName string, name string) (string, error) {
+	name = ObjectName(name, "")
+	bucketDir, err := ls.bucketDir(bucketName)
+	if err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(bucketDir, filepath.FromSlash(name))
+	if name == "" || !strings.HasPrefix(filePath, bucketDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("storage: invalid object name %q", name)
+	}
+	return filePath, nil
+}
+
+func (ls *LocalStorage) bucketDir(bucketName string) (string, error) {
+	if bucketName == "" || strings.ContainsAny(bucketName, `/\`) || strings.HasPrefix(bucketName, ".") {
+		return "", fmt.Errorf("storage: invalid bucket name %q", bucketName)
+	}
+	return filepath.Join(ls.Root, bucketName), nil
+}
+
+// metadataPath maps a file under Root to its metadata file.
+func (ls *LocalStorage) metadataPath(filePath string) string {
+	rel, _ := filepath.Rel(ls.Root, filePath)
+	return filepath.Join(ls.Root, localMetadataDir, rel) + ".json"
+}
+
+// readMetadata returns empty metadata for files without it, e.g. copied in the bucket directory by hand.
+func (ls *LocalStorage) readMetadata(filePath string) (*localMetadata, error) {
+	data, err := os.ReadFile(ls.metadataPath(filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &localMetadata{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &localMetadata{}
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return nil, fmt.Errorf("storage: invalid metadata of %s: %w", filePath, err)
+	}
+	return metadata, nil
+}
+
+func (ls *LocalStorage) writeMetadata(filePath string, metadata *localMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return writeFile(ls.metadataPath(filePath), bytes.NewReader(data))
+}
+
+// writeFile writes to a temporary file renamed to filePath so readers never see a partial object.
+func writeFile(filePath string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), localTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// removeEmptyDirs removes dir and its parents up to root, stopping at the first non empty one.
+func removeEmptyDirs(dir string, root string) {
+	for ; dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+func localError(err error, bucketName string, name string) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucketName, name)
+	}
+	return err
+}
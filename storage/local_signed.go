@@ -0,0 +1,279 @@
+package cloud_storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localFieldSize bounds the form fields read before the file of POST uploads.
+const localFieldSize = 4 << 10
+
+// localSignedParams are the query parameters, or form fields, of the URLs signed by LocalStorage.
+var localSignedParams = []string{"expires", "content_type", "min_size", "max_size"}
+
+// errUploadTooSmall is returned by minSizeReader at the end of an upload below the size range.
+var errUploadTooSmall = errors.New("storage: upload too small")
+
+// SignedUploadURL returns an URL of Handler signed with SigningKey, BaseURL and SigningKey must be set.
+func (ls *LocalStorage) SignedUploadURL(ctx context.Context, bucketName string, name string, opts UploadURLOptions) (*SignedUpload, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	name = ObjectName(name, "")
+	if _, err := ls.filePath(bucketName, name); err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(opts.TTL).Truncate(time.Second)
+	params := url.Values{}
+	params.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	if opts.ContentType != "" {
+		params.Set("content_type", opts.ContentType)
+	}
+	if opts.MinSize > 0 {
+		params.Set("min_size", strconv.FormatInt(opts.MinSize, 10))
+	}
+	if opts.MaxSize > 0 {
+		params.Set("max_size", strconv.FormatInt(opts.MaxSize, 10))
+	}
+
+	u, err := ls.sign(opts.Method, bucketName, name, params)
+	if err != nil {
+		return nil, err
+	}
+
+	upload := &SignedUpload{Method: opts.Method, Expires: expires}
+	if opts.Method == http.MethodPost {
+		upload.Fields = map[string]string{}
+		for key := range params {
+			upload.Fields[key] = params.Get(key)
+		}
+	} else {
+		u.RawQuery = params.Encode()
+		if opts.ContentType != "" {
+			upload.Headers = map[string]string{"Content-Type": opts.ContentType}
+		}
+	}
+	upload.URL = u.String()
+	return upload, nil
+}
+
+// sign adds the signature to params and returns the URL of the object, BaseURL/bucket/name.
+func (ls *LocalStorage) sign(method string, bucketName string, name string, params url.Values) (*url.URL, error) {
+	if ls.BaseURL == "" || len(ls.SigningKey) == 0 {
+		return nil, errors.New("storage: local signed urls require BaseURL and SigningKey")
+	}
+
+	base, err := url.Parse(ls.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	params.Set("signature", ls.signature(method, bucketName, name, params))
+	return base.JoinPath(bucketName, name), nil
+}
+
+func (ls *LocalStorage) signature(method string, bucketName string, name string, params url.Values) string {
+	mac := hmac.New(sha256.New, ls.SigningKey)
+	mac.Write([]byte(method + "\n" + bucketName + "\n" + name))
+	for _, param := range localSignedParams {
+		mac.Write([]byte("\n" + params.Get(param)))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature and expiry of params and returns the upload constraints they carry.
+func (ls *LocalStorage) verify(method string, bucketName string, name string, params url.Values) (UploadURLOptions, error) {
+	opts := UploadURLOptions{Method: method, ContentType: params.Get("content_type")}
+	expected := ls.signature(method, bucketName, name, params)
+	if !hmac.Equal([]byte(expected), []byte(params.Get("signature"))) {
+		return opts, errors.New("invalid signature")
+	}
+
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return opts, errors.New("expired signature")
+	}
+
+	// the parameters are signed, they parse
+	opts.MinSize, _ = strconv.ParseInt(params.Get("min_size"), 10, 64)
+	opts.MaxSize, _ = strconv.ParseInt(params.Get("max_size"), 10, 64)
+	return opts, nil
+}
+
+// Handler serves the URLs signed by SignedURL and SignedUploadURL, mount it at the path of BaseURL:
+//
+//	mux.Handle("/files/", storage.Handler())
+//
+// GET downloads an object as an attachment, PUT uploads the request body and POST the
+// UploadFileField file of a multipart form. Uploads breaking the constraints of the URL are not
+// stored.
+func (ls *LocalStorage) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := ""
+		if u, err := url.Parse(ls.BaseURL); err == nil {
+			prefix = strings.TrimSuffix(u.Path, "/")
+		}
+		objectPath, ok := strings.CutPrefix(r.URL.Path, prefix+"/")
+		bucketName, name, _ := strings.Cut(objectPath, "/")
+		if !ok || bucketName == "" || name == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			ls.serveGet(w, r, bucketName, name)
+		case http.MethodPut:
+			ls.servePut(w, r, bucketName, name)
+		case http.MethodPost:
+			ls.servePost(w, r, bucketName, name)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (ls *LocalStorage) serveGet(w http.ResponseWriter, r *http.Request, bucketName string, name string) {
+	if _, err := ls.verify(http.MethodGet, bucketName, name, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	attrs, err := ls.Stat(r.Context(), bucketName, name)
+	if err != nil {
+		writeLocalError(w, err)
+		return
+	}
+	rc, err := ls.NewReader(r.Context(), bucketName, name, DownloadOptions{})
+	if err != nil {
+		writeLocalError(w, err)
+		return
+	}
+	defer rc.Close()
+
+	// the content type is chosen by the uploader, browsers must not render it, e.g. HTML or SVG
+	w.Header().Set("Content-Type", attrs.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}))
+	io.Copy(w, rc)
+}
+
+func (ls *LocalStorage) servePut(w http.ResponseWriter, r *http.Request, bucketName string, name string) {
+	opts, err := ls.verify(http.MethodPut, bucketName, name, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	ls.store(w, r, bucketName, name, r.Body, r.Header.Get("Content-Type"), opts)
+}
+
+func (ls *LocalStorage) servePost(w http.ResponseWriter, r *http.Request, bucketName string, name string) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := url.Values{}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("missing %q file: %v", UploadFileField, err), http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() == UploadFileField {
+			opts, err := ls.verify(http.MethodPost, bucketName, name, fields)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			ls.store(w, r, bucketName, name, part, postContentType(fields, part), opts)
+			return
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, localFieldSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fields.Set(part.FormName(), string(value))
+	}
+}
+
+// store streams body into the object when it matches opts, nothing is stored otherwise.
+func (ls *LocalStorage) store(w http.ResponseWriter, r *http.Request, bucketName string, name string, body io.Reader, contentType string, opts UploadURLOptions) {
+	if opts.ContentType != "" && !sameMediaType(contentType, opts.ContentType) {
+		http.Error(w, fmt.Sprintf("content type must be %s", opts.ContentType), http.StatusBadRequest)
+		return
+	}
+	if opts.MaxSize > 0 {
+		if r.ContentLength > opts.MaxSize && opts.Method == http.MethodPut {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = http.MaxBytesReader(w, io.NopCloser(body), opts.MaxSize)
+	}
+	body = &minSizeReader{Reader: body, min: opts.MinSize}
+
+	err := ls.Upload(r.Context(), bucketName, name, body, UploadOptions{ContentType: contentType})
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errUploadTooSmall):
+		http.Error(w, fmt.Sprintf("upload must be at least %d bytes", opts.MinSize), http.StatusBadRequest)
+	case err != nil:
+		writeLocalError(w, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// postContentType prefers the Content-Type form field, like S3 POST policies, to the header of the file.
+func postContentType(fields url.Values, part *multipart.Part) string {
+	if contentType := fields.Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+	return part.Header.Get("Content-Type")
+}
+
+func writeLocalError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrObjectNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// minSizeReader fails at the end of the reader when less than min bytes were read.
+type minSizeReader struct {
+	io.Reader
+	min  int64
+	read int64
+}
+
+func (r *minSizeReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+	if errors.Is(err, io.EOF) && r.read < r.min {
+		return n, errUploadTooSmall
+	}
+	return n, err
+}
@@ -0,0 +1,237 @@
+package cloud_storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps objects in memory, for tests.
+type MemoryStorage struct {
+	mu sync.RWMutex
+
+	// buckets maps bucket names to their objects by name
+	buckets map[string]map[string]*memoryObject
+}
+
+type memoryObject struct {
+	data            []byte
+	contentType     string
+	contentEncoding string
+	metadata        map[string]string
+	updated         time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{buckets: make(map[string]map[string]*memoryObject)}
+}
+
+func (ms *MemoryStorage) LoadJSON(ctx context.Context, bucketName string, filePath string, v any) error {
+	data, err := readObject(ctx, ms, bucketName, filePath)
+	if err != nil {
+		return err
+	}
+	return unmarshalJSON(data, v)
+}
+
+func (ms *MemoryStorage) LoadJSONL(ctx context.Context, bucketName string, filePath string) ([][]byte, error) {
+	data, err := readObject(ctx, ms, bucketName, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return splitJSONL(data), nil
+}
+
+func (ms *MemoryStorage) CreateFile(ctx context.Context, bucketName string, uploadPath string, file []byte, fileName string) error {
+	return ms.Upload(ctx, bucketName, ObjectName(uploadPath, fileName), bytes.NewReader(file), UploadOptions{})
+}
+
+func (ms *MemoryStorage) ReadFile(ctx context.Context, bucketName string, uploadPath string, fileName string) ([]byte, error) {
+	return readObject(ctx, ms, bucketName, ObjectName(uploadPath, fileName))
+}
+
+// SignedURL returns a memory:// URL, objects in memory cannot be downloaded.
+func (ms *MemoryStorage) SignedURL(ctx context.Context, bucketName string, uploadPath string, fileName string, ttl int) (string, error) {
+	name := ObjectName(uploadPath, fileName)
+	if _, err := ms.get(bucketName, name); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("memory://%s/%s", bucketName, name), nil
+}
+
+// SignedUploadURL returns a memory:// URL, clients cannot upload to memory, use Upload.
+func (ms *MemoryStorage) SignedUploadURL(ctx context.Context, bucketName string, name string, opts UploadURLOptions) (*SignedUpload, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &SignedUpload{
+		Method:  opts.Method,
+		URL:     fmt.Sprintf("memory://%s/%s", bucketName, ObjectName(name, "")),
+		Expires: time.Now().Add(opts.TTL),
+	}, nil
+}
+
+func (ms *MemoryStorage) Upload(ctx context.Context, bucketName string, name string, r io.Reader, opts UploadOptions) error {
+	name = ObjectName(name, "")
+	body, contentType, contentEncoding, err := prepareUpload(name, r, opts)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	ms.put(bucketName, name, &memoryObject{
+		data:            data,
+		contentType:     contentType,
+		contentEncoding: contentEncoding,
+		metadata:        copyMetadata(opts.Metadata),
+		updated:         time.Now(),
+	})
+	return nil
+}
+
+func (ms *MemoryStorage) NewReader(ctx context.Context, bucketName string, name string, opts DownloadOptions) (io.ReadCloser, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	object, err := ms.get(bucketName, ObjectName(name, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	data := object.data
+	if object.contentEncoding != "" {
+		return decodeObject(io.NopCloser(bytes.NewReader(data)), object.contentEncoding, opts)
+	}
+	if opts.ranged() {
+		if opts.Offset >= int64(len(data)) {
+			return nil, fmt.Errorf("%w: offset %d is after the end", ErrInvalidRange, opts.Offset)
+		}
+		data = data[opts.Offset:]
+		if opts.Length > 0 && opts.Length < int64(len(data)) {
+			data = data[:opts.Length]
+		}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (ms *MemoryStorage) Download(ctx context.Context, bucketName string, name string, w io.Writer, opts DownloadOptions) (int64, error) {
+	return download(ctx, ms, bucketName, name, w, opts)
+}
+
+func (ms *MemoryStorage) List(ctx context.Context, bucketName string, opts ListOptions) (*ListPage, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var names []string
+	for name := range ms.buckets[bucketName] {
+		if strings.HasPrefix(name, opts.Prefix) && name > opts.PageToken {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	page := &ListPage{}
+	if len(names) > opts.pageSize() {
+		names = names[:opts.pageSize()]
+		page.NextPageToken = names[len(names)-1]
+	}
+	for _, name := range names {
+		page.Objects = append(page.Objects, *ms.buckets[bucketName][name].attrs(bucketName, name))
+	}
+	return page, nil
+}
+
+func (ms *MemoryStorage) Stat(ctx context.Context, bucketName string, name string) (*ObjectAttrs, error) {
+	name = ObjectName(name, "")
+	object, err := ms.get(bucketName, name)
+	if err != nil {
+		return nil, err
+	}
+	return object.attrs(bucketName, name), nil
+}
+
+func (ms *MemoryStorage) Exists(ctx context.Context, bucketName string, name string) (bool, error) {
+	return exists(ms.Stat(ctx, bucketName, name))
+}
+
+func (ms *MemoryStorage) Delete(ctx context.Context, bucketName string, name string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.buckets[bucketName], ObjectName(name, ""))
+	return nil
+}
+
+func (ms *MemoryStorage) Copy(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	object, err := ms.get(srcBucket, ObjectName(srcName, ""))
+	if err != nil {
+		return err
+	}
+
+	copied := *object
+	copied.updated = time.Now()
+	ms.put(dstBucket, ObjectName(dstName, ""), &copied)
+	return nil
+}
+
+func (ms *MemoryStorage) Move(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	return move(ctx, ms, srcBucket, srcName, dstBucket, dstName)
+}
+
+func (ms *MemoryStorage) get(bucketName string, name string) (*memoryObject, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	object, ok := ms.buckets[bucketName][name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucketName, name)
+	}
+	return object, nil
+}
+
+// put stores object, objects are never modified once stored.
+func (ms *MemoryStorage) put(bucketName string, name string, object *memoryObject) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.buckets[bucketName] == nil {
+		ms.buckets[bucketName] = make(map[string]*memoryObject)
+	}
+	ms.buckets[bucketName][name] = object
+}
+
+func (o *memoryObject) attrs(bucketName string, name string) *ObjectAttrs {
+	return &ObjectAttrs{
+		Bucket:          bucketName,
+		Name:            name,
+		Size:            int64(len(o.data)),
+		ContentType:     o.contentType,
+		ContentEncoding: o.contentEncoding,
+		Metadata:        copyMetadata(o.metadata),
+		MD5:             md5Hex(o.data),
+		Updated:         o.updated,
+	}
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+
+	copied := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
@@ -1,9 +1,9 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: frameworks/storage/go/cloud_storage/cloud_storage.go
+// Source: storage/cloud_storage.go
 //
 // Generated by this command:
 //
-//	mockgen -source=frameworks/storage/go/cloud_storage/cloud_storage.go -destination=frameworks/storage/go/cloud_storage/mocks/cloud_storage_mock.go
+//	mockgen -source=storage/cloud_storage.go -destination=storage/mocks/cloud_storage_mock.go
 //
 
 // Package mock_cloud_storage is a generated GoMock package.
@@ -11,8 +11,10 @@ package mock_cloud_storage
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
 
+	cloud_storage "github.com/ngtrvu/zen-go/storage"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -40,6 +42,20 @@ func (m *MockCloudStorageInterface) EXPECT() *MockCloudStorageInterfaceMockRecor
 	return m.recorder
 }
 
+// Copy mocks base method.
+func (m *MockCloudStorageInterface) Copy(ctx context.Context, srcBucket, srcName, dstBucket, dstName string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Copy", ctx, srcBucket, srcName, dstBucket, dstName)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Copy indicates an expected call of Copy.
+func (mr *MockCloudStorageInterfaceMockRecorder) Copy(ctx, srcBucket, srcName, dstBucket, dstName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Copy", reflect.TypeOf((*MockCloudStorageInterface)(nil).Copy), ctx, srcBucket, srcName, dstBucket, dstName)
+}
+
 // CreateFile mocks base method.
 func (m *MockCloudStorageInterface) CreateFile(ctx context.Context, bucketName, uploadPath string, file []byte, fileName string) error {
 	m.ctrl.T.Helper()
@@ -54,33 +70,121 @@ func (mr *MockCloudStorageInterfaceMockRecorder) CreateFile(ctx, bucketName, upl
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateFile", reflect.TypeOf((*MockCloudStorageInterface)(nil).CreateFile), ctx, bucketName, uploadPath, file, fileName)
 }
 
+// Delete mocks base method.
+func (m *MockCloudStorageInterface) Delete(ctx context.Context, bucketName, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, bucketName, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockCloudStorageInterfaceMockRecorder) Delete(ctx, bucketName, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCloudStorageInterface)(nil).Delete), ctx, bucketName, name)
+}
+
+// Download mocks base method.
+func (m *MockCloudStorageInterface) Download(ctx context.Context, bucketName, name string, w io.Writer, opts cloud_storage.DownloadOptions) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Download", ctx, bucketName, name, w, opts)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Download indicates an expected call of Download.
+func (mr *MockCloudStorageInterfaceMockRecorder) Download(ctx, bucketName, name, w, opts any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockCloudStorageInterface)(nil).Download), ctx, bucketName, name, w, opts)
+}
+
+// Exists mocks base method.
+func (m *MockCloudStorageInterface) Exists(ctx context.Context, bucketName, name string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", ctx, bucketName, name)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Exists indicates an expected call of Exists.
+func (mr *MockCloudStorageInterfaceMockRecorder) Exists(ctx, bucketName, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockCloudStorageInterface)(nil).Exists), ctx, bucketName, name)
+}
+
+// List mocks base method.
+func (m *MockCloudStorageInterface) List(ctx context.Context, bucketName string, opts cloud_storage.ListOptions) (*cloud_storage.ListPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, bucketName, opts)
+	ret0, _ := ret[0].(*cloud_storage.ListPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockCloudStorageInterfaceMockRecorder) List(ctx, bucketName, opts any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockCloudStorageInterface)(nil).List), ctx, bucketName, opts)
+}
+
 // LoadJSON mocks base method.
-func (m *MockCloudStorageInterface) LoadJSON(bucketName, filePath string, v any) error {
+func (m *MockCloudStorageInterface) LoadJSON(ctx context.Context, bucketName, filePath string, v any) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "LoadJSON", bucketName, filePath, v)
+	ret := m.ctrl.Call(m, "LoadJSON", ctx, bucketName, filePath, v)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // LoadJSON indicates an expected call of LoadJSON.
-func (mr *MockCloudStorageInterfaceMockRecorder) LoadJSON(bucketName, filePath, v any) *gomock.Call {
+func (mr *MockCloudStorageInterfaceMockRecorder) LoadJSON(ctx, bucketName, filePath, v any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadJSON", reflect.TypeOf((*MockCloudStorageInterface)(nil).LoadJSON), bucketName, filePath, v)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadJSON", reflect.TypeOf((*MockCloudStorageInterface)(nil).LoadJSON), ctx, bucketName, filePath, v)
 }
 
 // LoadJSONL mocks base method.
-func (m *MockCloudStorageInterface) LoadJSONL(bucketName, filePath string) ([][]byte, error) {
+func (m *MockCloudStorageInterface) LoadJSONL(ctx context.Context, bucketName, filePath string) ([][]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "LoadJSONL", bucketName, filePath)
+	ret := m.ctrl.Call(m, "LoadJSONL", ctx, bucketName, filePath)
 	ret0, _ := ret[0].([][]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // LoadJSONL indicates an expected call of LoadJSONL.
-func (mr *MockCloudStorageInterfaceMockRecorder) LoadJSONL(bucketName, filePath any) *gomock.Call {
+func (mr *MockCloudStorageInterfaceMockRecorder) LoadJSONL(ctx, bucketName, filePath any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadJSONL", reflect.TypeOf((*MockCloudStorageInterface)(nil).LoadJSONL), bucketName, filePath)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadJSONL", reflect.TypeOf((*MockCloudStorageInterface)(nil).LoadJSONL), ctx, bucketName, filePath)
+}
+
+// Move mocks base method.
+func (m *MockCloudStorageInterface) Move(ctx context.Context, srcBucket, srcName, dstBucket, dstName string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Move", ctx, srcBucket, srcName, dstBucket, dstName)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Move indicates an expected call of Move.
+func (mr *MockCloudStorageInterfaceMockRecorder) Move(ctx, srcBucket, srcName, dstBucket, dstName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Move", reflect.TypeOf((*MockCloudStorageInterface)(nil).Move), ctx, srcBucket, srcName, dstBucket, dstName)
+}
+
+// NewReader mocks base method.
+func (m *MockCloudStorageInterface) NewReader(ctx context.Context, bucketName, name string, opts cloud_storage.DownloadOptions) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewReader", ctx, bucketName, name, opts)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewReader indicates an expected call of NewReader.
+func (mr *MockCloudStorageInterfaceMockRecorder) NewReader(ctx, bucketName, name, opts any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewReader", reflect.TypeOf((*MockCloudStorageInterface)(nil).NewReader), ctx, bucketName, name, opts)
 }
 
 // ReadFile mocks base method.
@@ -112,3 +216,47 @@ func (mr *MockCloudStorageInterfaceMockRecorder) SignedURL(ctx, bucketName, uplo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignedURL", reflect.TypeOf((*MockCloudStorageInterface)(nil).SignedURL), ctx, bucketName, uploadPath, fileName, ttl)
 }
+
+// SignedUploadURL mocks base method.
+func (m *MockCloudStorageInterface) SignedUploadURL(ctx context.Context, bucketName, name string, opts cloud_storage.UploadURLOptions) (*cloud_storage.SignedUpload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SignedUploadURL", ctx, bucketName, name, opts)
+	ret0, _ := ret[0].(*cloud_storage.SignedUpload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SignedUploadURL indicates an expected call of SignedUploadURL.
+func (mr *MockCloudStorageInterfaceMockRecorder) SignedUploadURL(ctx, bucketName, name, opts any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SignedUploadURL", reflect.TypeOf((*MockCloudStorageInterface)(nil).SignedUploadURL), ctx, bucketName, name, opts)
+}
+
+// Stat mocks base method.
+func (m *MockCloudStorageInterface) Stat(ctx context.Context, bucketName, name string) (*cloud_storage.ObjectAttrs, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", ctx, bucketName, name)
+	ret0, _ := ret[0].(*cloud_storage.ObjectAttrs)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Stat indicates an expected call of Stat.
+func (mr *MockCloudStorageInterfaceMockRecorder) Stat(ctx, bucketName, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockCloudStorageInterface)(nil).Stat), ctx, bucketName, name)
+}
+
+// Upload mocks base method.
+func (m *MockCloudStorageInterface) Upload(ctx context.Context, bucketName, name string, r io.Reader, opts cloud_storage.UploadOptions) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upload", ctx, bucketName, name, r, opts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upload indicates an expected call of Upload.
+func (mr *MockCloudStorageInterfaceMockRecorder) Upload(ctx, bucketName, name, r, opts any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upload", reflect.TypeOf((*MockCloudStorageInterface)(nil).Upload), ctx, bucketName, name, r, opts)
+}
@@ -0,0 +1,243 @@
+package cloud_storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListPageSize is the number of objects returned by List when ListOptions.PageSize is not set.
+	DefaultListPageSize = 1000
+
+	ContentEncodingGzip = "gzip"
+)
+
+// ObjectAttrs describes a stored object.
+type ObjectAttrs struct {
+	Bucket string
+	Name   string
+	Size   int64
+
+	// ContentType, ContentEncoding and Metadata are not returned by List on S3.
+	ContentType     string
+	ContentEncoding string
+	Metadata        map[string]string
+
+	// MD5 is the hex encoded MD5 checksum of the content, empty when the backend does not know it,
+	// e.g. S3 multipart uploads and GCS composite objects.
+	MD5 string
+
+	Updated time.Time
+}
+
+// UploadOptions describes an uploaded object.
+type UploadOptions struct {
+	// ContentType is detected from the name and the first bytes when empty.
+	ContentType string
+
+	// Metadata are custom key values, S3 lower cases the keys.
+	Metadata map[string]string
+
+	// Gzip compresses the content while uploading and sets the gzip content encoding,
+	// downloads decompress it transparently.
+	Gzip bool
+}
+
+// DownloadOptions selects a range of the object. Ranges of gzip objects apply to the decompressed content.
+type DownloadOptions struct {
+	Offset int64
+
+	// Length is the number of bytes read from Offset, 0 reads until the end.
+	Length int64
+}
+
+// ListOptions selects the objects returned by List.
+type ListOptions struct {
+	// Prefix keeps the objects whose name starts with it.
+	Prefix string
+
+	// PageSize is the maximum number of objects returned, DefaultListPageSize by default.
+	PageSize int
+
+	// PageToken is the NextPageToken of the previous page, empty for the first page.
+	PageToken string
+}
+
+// ListPage is a page of objects sorted by name.
+type ListPage struct {
+	Objects []ObjectAttrs
+
+	// NextPageToken fetches the next page, empty on the last page.
+	NextPageToken string
+}
+
+// ObjectName joins uploadPath and fileName into an object name with "/" separators and no leading "/".
+func ObjectName(uploadPath string, fileName string) string {
+	return strings.TrimPrefix(path.Join(uploadPath, fileName), "/")
+}
+
+func (opts ListOptions) pageSize() int {
+	if opts.PageSize <= 0 {
+		return DefaultListPageSize
+	}
+	return opts.PageSize
+}
+
+func (opts DownloadOptions) validate() error {
+	if opts.Offset < 0 || opts.Length < 0 {
+		return fmt.Errorf("%w: offset %d, length %d", ErrInvalidRange, opts.Offset, opts.Length)
+	}
+	return nil
+}
+
+func (opts DownloadOptions) ranged() bool {
+	return opts.Offset > 0 || opts.Length > 0
+}
+
+// readCloser closes Closer after reading from a reader wrapping it.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// prepareUpload detects the content type from the first bytes and compresses the content with opts.Gzip,
+// the returned reader must be closed.
+func prepareUpload(name string, r io.Reader, opts UploadOptions) (body io.ReadCloser, contentType string, contentEncoding string, err error) {
+	buffered := bufio.NewReaderSize(r, 512)
+	contentType = opts.ContentType
+	if contentType == "" {
+		head, err := buffered.Peek(512)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, "", "", err
+		}
+		contentType = detectContentType(name, head)
+	}
+
+	if !opts.Gzip {
+		return io.NopCloser(buffered), contentType, "", nil
+	}
+	return gzipCompress(buffered), contentType, ContentEncodingGzip, nil
+}
+
+// gzipCompress compresses r from a goroutine, closing the returned reader stops it.
+func gzipCompress(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, r)
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// decodeObject decompresses gzip objects then skips to the range of opts, for backends reading them whole.
+func decodeObject(rc io.ReadCloser, contentEncoding string, opts DownloadOptions) (io.ReadCloser, error) {
+	r := io.Reader(rc)
+	if contentEncoding == ContentEncodingGzip {
+		zr, err := gzip.NewReader(rc)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		r = zr
+	}
+
+	if opts.Offset > 0 {
+		if _, err := io.CopyN(io.Discard, r, opts.Offset); err != nil {
+			rc.Close()
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%w: offset %d is after the end", ErrInvalidRange, opts.Offset)
+			}
+			return nil, err
+		}
+	}
+	if opts.Length > 0 {
+		r = io.LimitReader(r, opts.Length)
+	}
+	return readCloser{Reader: r, Closer: rc}, nil
+}
+
+// download copies the reader of a backend into w.
+func download(ctx context.Context, s CloudStorageInterface, bucketName string, name string, w io.Writer, opts DownloadOptions) (int64, error) {
+	rc, err := s.NewReader(ctx, bucketName, name, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	return io.Copy(w, rc)
+}
+
+func readObject(ctx context.Context, s CloudStorageInterface, bucketName string, name string) ([]byte, error) {
+	rc, err := s.NewReader(ctx, bucketName, name, DownloadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+func unmarshalJSON(data []byte, v any) error {
+	return json.Unmarshal(data, &v)
+}
+
+// splitJSONL returns the non empty lines of newline-delimited JSON.
+func splitJSONL(data []byte) [][]byte {
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// detectContentType guesses the content type from the extension of name, then from the content.
+func detectContentType(name string, data []byte) string {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType
+	}
+	return http.DetectContentType(data)
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// exists turns the ErrObjectNotFound of a Stat into false.
+func exists(attrs *ObjectAttrs, err error) (bool, error) {
+	if errors.Is(err, ErrObjectNotFound) {
+		return false, nil
+	}
+	return attrs != nil, err
+}
+
+// move copies then deletes the source, for backends without a rename.
+func move(ctx context.Context, s CloudStorageInterface, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	if srcBucket == dstBucket && ObjectName(srcName, "") == ObjectName(dstName, "") {
+		return nil
+	}
+	if err := s.Copy(ctx, srcBucket, srcName, dstBucket, dstName); err != nil {
+		return err
+	}
+	return s.Delete(ctx, srcBucket, srcName)
+}
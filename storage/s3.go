@@ -0,0 +1,754 @@
+package cloud_storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm        = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	s3EmptyPayload     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3DateFormat       = "20060102T150405Z"
+	s3MaxPresignExpiry = 7 * 24 * time.Hour
+	s3MetaPrefix       = "x-amz-meta-"
+
+	// DefaultS3PartSize is the size of the parts of multipart uploads, S3 requires at least 5 MiB.
+	DefaultS3PartSize = 8 << 20
+)
+
+// S3Options configures an S3-compatible backend: AWS S3, MinIO, Ceph, Cloudflare R2...
+type S3Options struct {
+	// Endpoint is the service URL, e.g. https://s3.ap-southeast-1.amazonaws.com or http://minio:9000.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PathStyle puts the bucket in the path instead of the host name, required by MinIO.
+	PathStyle bool
+
+	// PartSize is the part size of uploads larger than it, DefaultS3PartSize by default.
+	// Each upload buffers one part in memory.
+	PartSize int
+
+	HTTPClient *http.Client
+}
+
+// S3Storage is the S3-compatible backend, requests are signed with AWS Signature Version 4.
+type S3Storage struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// S3Error is an error response of the S3 API.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("storage: s3 %s: %s (status %d)", e.Code, e.Message, e.StatusCode)
+}
+
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint %q", opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = DefaultS3PartSize
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3Storage{opts: opts, endpoint: endpoint, client: client, now: time.Now}, nil
+}
+
+func (s *S3Storage) LoadJSON(ctx context.Context, bucketName string, filePath string, v any) error {
+	data, err := readObject(ctx, s, bucketName, filePath)
+	if err != nil {
+		return err
+	}
+	return unmarshalJSON(data, v)
+}
+
+func (s *S3Storage) LoadJSONL(ctx context.Context, bucketName string, filePath string) ([][]byte, error) {
+	data, err := readObject(ctx, s, bucketName, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return splitJSONL(data), nil
+}
+
+func (s *S3Storage) CreateFile(ctx context.Context, bucketName string, uploadPath string, file []byte, fileName string) error {
+	return s.Upload(ctx, bucketName, ObjectName(uploadPath, fileName), bytes.NewReader(file), UploadOptions{})
+}
+
+func (s *S3Storage) ReadFile(ctx context.Context, bucketName string, uploadPath string, fileName string) ([]byte, error) {
+	return readObject(ctx, s, bucketName, ObjectName(uploadPath, fileName))
+}
+
+// SignedURL returns a presigned GET URL valid for ttl seconds, at most 7 days.
+func (s *S3Storage) SignedURL(ctx context.Context, bucketName string, uploadPath string, fileName string, ttl int) (string, error) {
+	expiry := time.Duration(ttl) * time.Second
+	if expiry <= 0 || expiry > s3MaxPresignExpiry {
+		return "", fmt.Errorf("storage: s3 signed url ttl must be between 1s and %v", s3MaxPresignExpiry)
+	}
+
+	return s.presign(http.MethodGet, bucketName, ObjectName(uploadPath, fileName), expiry, nil), nil
+}
+
+// Upload sends objects smaller than PartSize with PutObject, larger ones with a multipart upload.
+func (s *S3Storage) Upload(ctx context.Context, bucketName string, name string, r io.Reader, opts UploadOptions) error {
+	name = ObjectName(name, "")
+	body, contentType, contentEncoding, err := prepareUpload(name, r, opts)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	if contentEncoding != "" {
+		header.Set("Content-Encoding", contentEncoding)
+	}
+	for key, value := range opts.Metadata {
+		header.Set(s3MetaPrefix+key, value)
+	}
+
+	// the first part grows with the content, small objects do not cost a PartSize buffer
+	part := &bytes.Buffer{}
+	if sized, ok := r.(interface{ Len() int }); ok && !opts.Gzip {
+		// the sniffed head was already read from r, MinRead covers it and the final read
+		part.Grow(min(sized.Len(), s.opts.PartSize) + bytes.MinRead)
+	}
+	if _, err := part.ReadFrom(io.LimitReader(body, int64(s.opts.PartSize))); err != nil {
+		return err
+	}
+	if part.Len() < s.opts.PartSize {
+		return s.putObject(ctx, bucketName, name, header, part.Bytes())
+	}
+	return s.multipartUpload(ctx, bucketName, name, header, part.Bytes(), body)
+}
+
+func (s *S3Storage) NewReader(ctx context.Context, bucketName string, name string, opts DownloadOptions) (io.ReadCloser, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	name = ObjectName(name, "")
+
+	resp, err := s.getObject(ctx, bucketName, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.Get("Content-Encoding") != ContentEncodingGzip {
+		return resp.Body, nil
+	}
+
+	// the range applied to the compressed content, read it whole
+	if opts.ranged() {
+		resp.Body.Close()
+		if resp, err = s.getObject(ctx, bucketName, name, DownloadOptions{}); err != nil {
+			return nil, err
+		}
+	}
+	return decodeObject(resp.Body, resp.Header.Get("Content-Encoding"), opts)
+}
+
+func (s *S3Storage) Download(ctx context.Context, bucketName string, name string, w io.Writer, opts DownloadOptions) (int64, error) {
+	return download(ctx, s, bucketName, name, w, opts)
+}
+
+// SignedUploadURL returns a presigned PUT URL or a POST policy, at most valid 7 days.
+// Only POST policies enforce the size range.
+func (s *S3Storage) SignedUploadURL(ctx context.Context, bucketName string, name string, opts UploadURLOptions) (*SignedUpload, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	if opts.TTL > s3MaxPresignExpiry {
+		return nil, fmt.Errorf("storage: s3 signed url ttl must be at most %v", s3MaxPresignExpiry)
+	}
+
+	name = ObjectName(name, "")
+	expires := s.now().Add(opts.TTL).Truncate(time.Second)
+	if opts.Method == http.MethodPost {
+		return s.postPolicy(bucketName, name, opts, expires)
+	}
+
+	header := http.Header{}
+	if opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+	upload := &SignedUpload{
+		Method:  http.MethodPut,
+		URL:     s.presign(http.MethodPut, bucketName, name, opts.TTL, header),
+		Headers: map[string]string{},
+		Expires: expires,
+	}
+	for key := range header {
+		upload.Headers[key] = header.Get(key)
+	}
+	return upload, nil
+}
+
+// List uses ListObjectsV2, the objects have no content type nor metadata.
+func (s *S3Storage) List(ctx context.Context, bucketName string, opts ListOptions) (*ListPage, error) {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("max-keys", strconv.Itoa(opts.pageSize()))
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	if opts.PageToken != "" {
+		query.Set("continuation-token", opts.PageToken)
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, bucketName, "", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result s3ListResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("storage: s3 list: %w", err)
+	}
+
+	page := &ListPage{}
+	if result.IsTruncated {
+		page.NextPageToken = result.NextContinuationToken
+	}
+	for _, object := range result.Contents {
+		page.Objects = append(page.Objects, ObjectAttrs{
+			Bucket:  bucketName,
+			Name:    object.Key,
+			Size:    object.Size,
+			MD5:     s3ETagMD5(object.ETag),
+			Updated: object.LastModified,
+		})
+	}
+	return page, nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, bucketName string, name string) (*ObjectAttrs, error) {
+	name = ObjectName(name, "")
+	req, err := s.newRequest(ctx, http.MethodHead, bucketName, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return s3ObjectAttrs(bucketName, name, resp), nil
+}
+
+func (s *S3Storage) Exists(ctx context.Context, bucketName string, name string) (bool, error) {
+	return exists(s.Stat(ctx, bucketName, name))
+}
+
+func (s *S3Storage) Delete(ctx context.Context, bucketName string, name string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, bucketName, ObjectName(name, ""), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Copy uses CopyObject, limited to objects of 5 GB.
+func (s *S3Storage) Copy(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, dstBucket, ObjectName(dstName, ""), nil, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Copy-Source", s3URIEncode("/"+srcBucket+"/"+ObjectName(srcName, ""), false))
+
+	return s.doXML(req, nil)
+}
+
+func (s *S3Storage) Move(ctx context.Context, srcBucket string, srcName string, dstBucket string, dstName string) error {
+	return move(ctx, s, srcBucket, srcName, dstBucket, dstName)
+}
+
+func (s *S3Storage) putObject(ctx context.Context, bucketName string, name string, header http.Header, data []byte) error {
+	req, err := s.newPayloadRequest(ctx, http.MethodPut, bucketName, name, nil, data)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// multipartUpload sends the first part then the rest of body part by part, the upload is aborted on errors.
+func (s *S3Storage) multipartUpload(ctx context.Context, bucketName string, name string, header http.Header, part []byte, body io.Reader) error {
+	req, err := s.newRequest(ctx, http.MethodPost, bucketName, name, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.doXML(req, &initiated); err != nil {
+		return err
+	}
+
+	completed := s3CompleteMultipartUpload{}
+	err = func() error {
+		for number := 1; len(part) > 0; number++ {
+			etag, err := s.uploadPart(ctx, bucketName, name, initiated.UploadID, number, part)
+			if err != nil {
+				return err
+			}
+			completed.Parts = append(completed.Parts, s3CompletedPart{PartNumber: number, ETag: etag})
+
+			n, err := io.ReadFull(body, part[:s.opts.PartSize])
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return err
+			}
+			part = part[:n]
+		}
+
+		payload, err := xml.Marshal(completed)
+		if err != nil {
+			return err
+		}
+		query := url.Values{"uploadId": {initiated.UploadID}}
+		req, err := s.newPayloadRequest(ctx, http.MethodPost, bucketName, name, query, payload)
+		if err != nil {
+			return err
+		}
+		return s.doXML(req, nil)
+	}()
+	if err != nil {
+		s.abortMultipartUpload(bucketName, name, initiated.UploadID)
+		return err
+	}
+	return nil
+}
+
+func (s *S3Storage) uploadPart(ctx context.Context, bucketName string, name string, uploadID string, number int, part []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	req, err := s.newPayloadRequest(ctx, http.MethodPut, bucketName, name, query, part)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// abortMultipartUpload deletes the uploaded parts, with its own context as the upload one may be cancelled.
+func (s *S3Storage) abortMultipartUpload(bucketName string, name string, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := s.newRequest(ctx, http.MethodDelete, bucketName, name, url.Values{"uploadId": {uploadID}}, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := s.do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// getObject sends a GetObject request, gzip objects are not decompressed.
+func (s *S3Storage) getObject(ctx context.Context, bucketName string, name string, opts DownloadOptions) (*http.Response, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, bucketName, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	// stops net/http from decompressing gzip objects on its own
+	req.Header.Set("Accept-Encoding", "identity")
+	if opts.ranged() {
+		rangeHeader := fmt.Sprintf("bytes=%d-", opts.Offset)
+		if opts.Length > 0 {
+			rangeHeader += strconv.FormatInt(opts.Offset+opts.Length-1, 10)
+		}
+		req.Header.Set("Range", rangeHeader)
+	}
+
+	return s.do(req)
+}
+
+// doXML sends req and decodes the XML response into v when not nil.
+func (s *S3Storage) doXML(req *http.Request, v any) error {
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// CompleteMultipartUpload and CopyObject may fail after sending the 200 status, the error is in the body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(body, []byte("<Error>")) {
+		s3Err := &S3Error{StatusCode: resp.StatusCode}
+		xml.Unmarshal(body, s3Err)
+		return s3Err
+	}
+	if v == nil {
+		return nil
+	}
+	return xml.Unmarshal(body, v)
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		Size         int64
+		ETag         string
+		LastModified time.Time
+	}
+}
+
+func s3ObjectAttrs(bucketName string, name string, resp *http.Response) *ObjectAttrs {
+	attrs := &ObjectAttrs{
+		Bucket:          bucketName,
+		Name:            name,
+		Size:            resp.ContentLength,
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		MD5:             s3ETagMD5(resp.Header.Get("ETag")),
+	}
+	attrs.Updated, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	for key, values := range resp.Header {
+		if metaKey, ok := strings.CutPrefix(strings.ToLower(key), s3MetaPrefix); ok && len(values) > 0 {
+			if attrs.Metadata == nil {
+				attrs.Metadata = make(map[string]string)
+			}
+			attrs.Metadata[metaKey] = values[0]
+		}
+	}
+	return attrs
+}
+
+// s3ETagMD5 returns the ETag when it is the MD5 of the content, it is not for multipart uploads.
+func s3ETagMD5(etag string) string {
+	etag = strings.Trim(etag, `"`)
+	if len(etag) != 32 {
+		return ""
+	}
+	if _, err := hex.DecodeString(etag); err != nil {
+		return ""
+	}
+	return strings.ToLower(etag)
+}
+
+// objectURL returns the URL of an object, or of the bucket when name is empty.
+func (s *S3Storage) objectURL(bucketName string, name string, query url.Values) *url.URL {
+	u := *s.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	objectPath := "/" + name
+	if s.opts.PathStyle {
+		objectPath = "/" + bucketName + objectPath
+	} else {
+		u.Host = bucketName + "." + u.Host
+	}
+
+	u.Path = basePath + objectPath
+	u.RawPath = s3URIEncode(basePath, false) + s3URIEncode(objectPath, false)
+	u.RawQuery = s3CanonicalQuery(query)
+	return &u
+}
+
+func (s *S3Storage) newRequest(ctx context.Context, method string, bucketName string, name string, query url.Values, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(bucketName, name, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// newPayloadRequest sends payload with its SHA-256 so the signature covers it.
+func (s *S3Storage) newPayloadRequest(ctx context.Context, method string, bucketName string, name string, query url.Values, payload []byte) (*http.Request, error) {
+	req, err := s.newRequest(ctx, method, bucketName, name, query, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(payload))
+	hash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	return req, nil
+}
+
+// do signs and sends req, non 2xx responses are returned as errors.
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	s.sign(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	s3Err := &S3Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	xml.Unmarshal(body, s3Err)
+	switch {
+	case resp.StatusCode == http.StatusNotFound && (s3Err.Code == "" || s3Err.Code == "NoSuchKey"):
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, req.URL.Path)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRange, req.Header.Get("Range"))
+	}
+	if s3Err.Code == "" {
+		s3Err.Code = http.StatusText(resp.StatusCode)
+	}
+	return nil, s3Err
+}
+
+// sign adds the Signature Version 4 authorization header. The payload is signed when its hash is set
+// in X-Amz-Content-Sha256 or when there is none, streamed payloads are not.
+func (s *S3Storage) sign(req *http.Request) {
+	now := s.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3DateFormat))
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = s3UnsignedPayload
+		if req.Body == nil || req.Body == http.NoBody {
+			payloadHash = s3EmptyPayload
+		}
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(req.URL.Host, req.Header)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := s.scope(now)
+	signature := s.signature(now, scope, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.opts.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// presign returns a URL carrying the signature in its query, the client must send header.
+func (s *S3Storage) presign(method string, bucketName string, name string, expiry time.Duration, header http.Header) string {
+	now := s.now().UTC()
+	scope := s.scope(now)
+
+	u := s.objectURL(bucketName, name, nil)
+	signedHeaders, canonicalHeaders := s3CanonicalHeaders(u.Host, header)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.opts.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(s3DateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		s3CanonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(now, scope, canonicalRequest))
+	u.RawQuery = s3CanonicalQuery(query)
+	return u.String()
+}
+
+// postPolicy signs a POST policy limiting the key, size and content type of a form upload.
+func (s *S3Storage) postPolicy(bucketName string, name string, opts UploadURLOptions, expires time.Time) (*SignedUpload, error) {
+	now := s.now().UTC()
+	fields := map[string]string{
+		"key":              name,
+		"x-amz-algorithm":  s3Algorithm,
+		"x-amz-credential": s.opts.AccessKeyID + "/" + s.scope(now),
+		"x-amz-date":       now.Format(s3DateFormat),
+	}
+	conditions := []any{
+		map[string]string{"bucket": bucketName},
+		[]any{"eq", "$key", name},
+		map[string]string{"x-amz-algorithm": fields["x-amz-algorithm"]},
+		map[string]string{"x-amz-credential": fields["x-amz-credential"]},
+		map[string]string{"x-amz-date": fields["x-amz-date"]},
+		[]any{"content-length-range", opts.MinSize, opts.maxSize()},
+	}
+	if opts.ContentType != "" {
+		fields["Content-Type"] = opts.ContentType
+		conditions = append(conditions, []any{"eq", "$Content-Type", opts.ContentType})
+	}
+
+	policy, err := json.Marshal(map[string]any{
+		"expiration": expires.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	fields["policy"] = base64.StdEncoding.EncodeToString(policy)
+	fields["x-amz-signature"] = s.policySignature(now, fields["policy"])
+
+	return &SignedUpload{
+		Method:  http.MethodPost,
+		URL:     s.objectURL(bucketName, "", nil).String(),
+		Fields:  fields,
+		Expires: expires,
+	}, nil
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.opts.Region + "/s3/aws4_request"
+}
+
+func (s *S3Storage) signature(now time.Time, scope string, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, now.Format(s3DateFormat), scope, hex.EncodeToString(hash[:])}, "\n")
+
+	return hex.EncodeToString(hmacSHA256(s.signingKey(now), stringToSign))
+}
+
+// policySignature signs the base64 encoded POST policy.
+func (s *S3Storage) policySignature(now time.Time, policy string) string {
+	return hex.EncodeToString(hmacSHA256(s.signingKey(now), policy))
+}
+
+func (s *S3Storage) signingKey(now time.Time) []byte {
+	key := hmacSHA256([]byte("AWS4"+s.opts.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.opts.Region)
+	key = hmacSHA256(key, "s3")
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalHeaders signs host, content-type, content-md5, range and the x-amz-* headers.
+func s3CanonicalHeaders(host string, header http.Header) (string, string) {
+	headers := map[string]string{"host": host}
+	for key, values := range header {
+		key = strings.ToLower(key)
+		if key == "content-type" || key == "content-md5" || key == "range" || strings.HasPrefix(key, "x-amz-") {
+			headers[key] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var canonical strings.Builder
+	for _, key := range keys {
+		canonical.WriteString(key + ":" + headers[key] + "\n")
+	}
+	return strings.Join(keys, ";"), canonical.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3URIEncode(key, true)+"="+s3URIEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode percent-encodes everything but the unreserved characters, and "/" unless encodeSlash.
+func s3URIEncode(s string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			encoded.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
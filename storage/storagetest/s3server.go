@@ -0,0 +1,390 @@
+package storagetest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3Server is an in-memory fake of the S3 object API with path-style URLs, it does not verify signatures
+// but rejects unsigned requests. POST policies are checked for their size range and content type.
+type S3Server struct {
+	*httptest.Server
+
+	mu      sync.RWMutex
+	objects map[string]*s3Object
+
+	// uploads are the multipart uploads in progress by upload ID
+	uploads      map[string]*s3Upload
+	nextUploadID int
+}
+
+type s3Object struct {
+	data     []byte
+	header   http.Header
+	modified time.Time
+}
+
+type s3Upload struct {
+	key    string
+	header http.Header
+	parts  map[int][]byte
+}
+
+// NewS3Server starts a fake S3 server, Close stops it.
+func NewS3Server() *S3Server {
+	s := &S3Server{objects: make(map[string]*s3Object), uploads: make(map[string]*s3Upload)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *S3Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket == "" {
+		writeS3Error(w, http.StatusBadRequest, "InvalidRequest", "bucket is required")
+		return
+	}
+	if name == "" && r.Method == http.MethodPost {
+		s.postObject(w, r, bucket)
+		return
+	}
+
+	if r.Header.Get("Authorization") == "" && r.URL.Query().Get("X-Amz-Signature") == "" {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied", "missing signature")
+		return
+	}
+	if name == "" {
+		if r.Method != http.MethodGet || r.URL.Query().Get("list-type") != "2" {
+			writeS3Error(w, http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported on buckets")
+			return
+		}
+		s.list(w, r, bucket)
+		return
+	}
+
+	key := bucket + "/" + name
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createMultipartUpload(w, r, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeMultipartUpload(w, r, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		s.mu.Lock()
+		delete(s.uploads, query.Get("uploadId"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copy(w, r.Header.Get("X-Amz-Copy-Source"), key)
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		object := &s3Object{data: data, header: objectHeader(r.Header), modified: time.Now()}
+		s.put(key, object)
+		w.Header().Set("ETag", object.etag())
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object := s.get(key)
+		if object == nil {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+			return
+		}
+		for header, values := range object.header {
+			w.Header()[header] = values
+		}
+		w.Header().Set("ETag", object.etag())
+		if r.Header.Get("Range") == "" {
+			// ServeContent leaves it out for encoded content
+			w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		}
+		http.ServeContent(w, r, "", object.modified, bytes.NewReader(object.data))
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (s *S3Server) createMultipartUpload(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	s.nextUploadID++
+	uploadID := strconv.Itoa(s.nextUploadID)
+	s.uploads[uploadID] = &s3Upload{key: key, header: objectHeader(r.Header), parts: make(map[int][]byte)}
+	s.mu.Unlock()
+
+	xml.NewEncoder(w).Encode(struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		UploadId string
+	}{UploadId: uploadID})
+}
+
+func (s *S3Server) uploadPart(w http.ResponseWriter, r *http.Request, uploadID string, partNumber string) {
+	number, err := strconv.Atoi(partNumber)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "the upload does not exist")
+		return
+	}
+	upload.parts[number] = data
+	w.Header().Set("ETag", (&s3Object{data: data}).etag())
+}
+
+func (s *S3Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, uploadID string) {
+	var completed struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&completed); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, ok := s.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "the upload does not exist")
+		return
+	}
+
+	var data []byte
+	for _, part := range completed.Parts {
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok || (&s3Object{data: partData}).etag() != part.ETag {
+			writeS3Error(w, http.StatusBadRequest, "InvalidPart", "part "+strconv.Itoa(part.PartNumber))
+			return
+		}
+		data = append(data, partData...)
+	}
+	delete(s.uploads, uploadID)
+	s.objects[upload.key] = &s3Object{data: data, header: upload.header, modified: time.Now()}
+
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string
+	}{Key: upload.key})
+}
+
+// postObject stores the file of a browser-based upload signed with a POST policy.
+func (s *S3Server) postObject(w http.ResponseWriter, r *http.Request, bucket string) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedPOSTRequest", err.Error())
+		return
+	}
+	if r.FormValue("x-amz-signature") == "" {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied", "missing signature")
+		return
+	}
+
+	var policy struct {
+		Conditions []json.RawMessage `json:"conditions"`
+	}
+	data, err := base64.StdEncoding.DecodeString(r.FormValue("policy"))
+	if err == nil {
+		err = json.Unmarshal(data, &policy)
+	}
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidPolicyDocument", "invalid policy")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument", "missing file")
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	for _, raw := range policy.Conditions {
+		var condition []any
+		if json.Unmarshal(raw, &condition) != nil || len(condition) != 3 {
+			continue
+		}
+		switch {
+		case condition[0] == "content-length-range":
+			minSize, _ := condition[1].(float64)
+			maxSize, _ := condition[2].(float64)
+			if float64(len(content)) < minSize {
+				writeS3Error(w, http.StatusBadRequest, "EntityTooSmall", "the upload is below the policy minimum")
+				return
+			}
+			if float64(len(content)) > maxSize {
+				writeS3Error(w, http.StatusBadRequest, "EntityTooLarge", "the upload exceeds the policy maximum")
+				return
+			}
+		case condition[0] == "eq" && condition[1] == "$Content-Type" && r.FormValue("Content-Type") != condition[2]:
+			writeS3Error(w, http.StatusForbidden, "AccessDenied", "policy condition failed: Content-Type")
+			return
+		}
+	}
+
+	objectHeader := http.Header{}
+	if contentType := r.FormValue("Content-Type"); contentType != "" {
+		objectHeader.Set("Content-Type", contentType)
+	} else if contentType := header.Header.Get("Content-Type"); contentType != "" {
+		objectHeader.Set("Content-Type", contentType)
+	}
+	s.put(bucket+"/"+r.FormValue("key"), &s3Object{data: content, header: objectHeader, modified: time.Now()})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Uploads is the number of multipart uploads in progress.
+func (s *S3Server) Uploads() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.uploads)
+}
+
+func (s *S3Server) list(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	prefix := bucket + "/" + query.Get("prefix")
+	maxKeys, err := strconv.Atoi(query.Get("max-keys"))
+	if err != nil || maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > bucket+"/"+query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string
+		Size         int
+		ETag         string
+		LastModified time.Time
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		KeyCount              int
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []content
+	}{Name: bucket}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = strings.TrimPrefix(keys[len(keys)-1], bucket+"/")
+	}
+	for _, key := range keys {
+		object := s.objects[key]
+		result.Contents = append(result.Contents, content{
+			Key:          strings.TrimPrefix(key, bucket+"/"),
+			Size:         len(object.data),
+			ETag:         object.etag(),
+			LastModified: object.modified.UTC(),
+		})
+	}
+	result.KeyCount = len(result.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (s *S3Server) copy(w http.ResponseWriter, source string, key string) {
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	object := s.get(source)
+	if object == nil {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", "the copy source does not exist")
+		return
+	}
+
+	copied := *object
+	copied.modified = time.Now()
+	s.put(key, &copied)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified time.Time
+	}{ETag: copied.etag(), LastModified: copied.modified.UTC()})
+}
+
+func (s *S3Server) get(key string) *s3Object {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.objects[key]
+}
+
+func (s *S3Server) put(key string, object *s3Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = object
+}
+
+// objectHeader keeps the headers stored with an object.
+func objectHeader(header http.Header) http.Header {
+	stored := http.Header{}
+	for key, values := range header {
+		key = http.CanonicalHeaderKey(key)
+		if key == "Content-Type" || key == "Content-Encoding" || strings.HasPrefix(strings.ToLower(key), "x-amz-meta-") {
+			stored[key] = values
+		}
+	}
+	return stored
+}
+
+func (o *s3Object) etag() string {
+	sum := md5.Sum(o.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
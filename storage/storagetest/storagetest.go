@@ -0,0 +1,383 @@
+// Package storagetest checks that storage backends behave the same, and fakes S3 for tests.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloud_storage "github.com/ngtrvu/zen-go/storage"
+)
+
+// Factory returns an empty backend for each test.
+type Factory func(t *testing.T) cloud_storage.CloudStorageInterface
+
+// Run runs the conformance suite against the backends created by newStorage, bucket must be writable.
+func Run(t *testing.T, bucket string, newStorage Factory) {
+	ctx := context.Background()
+
+	t.Run("CreateAndRead", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "reports/2024/", []byte("hello"), "a.txt"))
+
+		data, err := s.ReadFile(ctx, bucket, "reports/2024/", "a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "dir/", []byte("first"), "a.txt"))
+		require.NoError(t, s.CreateFile(ctx, bucket, "dir/", []byte("second"), "a.txt"))
+
+		data, err := s.ReadFile(ctx, bucket, "dir/", "a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(data))
+	})
+
+	t.Run("EmptyFile", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "dir/", []byte{}, "empty.txt"))
+
+		data, err := s.ReadFile(ctx, bucket, "dir/", "empty.txt")
+		require.NoError(t, err)
+		assert.Empty(t, data)
+	})
+
+	t.Run("PathJoining", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "/reports/2024", []byte("hello"), "a.txt"))
+
+		for _, uploadPath := range []string{"reports/2024", "reports/2024/", "/reports/2024/"} {
+			data, err := s.ReadFile(ctx, bucket, uploadPath, "a.txt")
+			require.NoError(t, err, uploadPath)
+			assert.Equal(t, "hello", string(data))
+		}
+		ok, err := s.Exists(ctx, bucket, "reports/2024/a.txt")
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		s := newStorage(t)
+
+		_, err := s.ReadFile(ctx, bucket, "dir/", "missing.txt")
+		assert.ErrorIs(t, err, cloud_storage.ErrObjectNotFound)
+
+		var v map[string]any
+		assert.ErrorIs(t, s.LoadJSON(ctx, bucket, "missing.json", &v), cloud_storage.ErrObjectNotFound)
+
+		_, err = s.LoadJSONL(ctx, bucket, "missing.jsonl")
+		assert.ErrorIs(t, err, cloud_storage.ErrObjectNotFound)
+
+		_, err = s.Stat(ctx, bucket, "missing.txt")
+		assert.ErrorIs(t, err, cloud_storage.ErrObjectNotFound)
+
+		ok, err := s.Exists(ctx, bucket, "missing.txt")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.ErrorIs(t, s.Copy(ctx, bucket, "missing.txt", bucket, "copy.txt"), cloud_storage.ErrObjectNotFound)
+		assert.ErrorIs(t, s.Move(ctx, bucket, "missing.txt", bucket, "moved.txt"), cloud_storage.ErrObjectNotFound)
+	})
+
+	t.Run("LoadJSON", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "data/", []byte(`{"symbol":"VNM","close":71.5}`), "price.json"))
+
+		var price struct {
+			Symbol string  `json:"symbol"`
+			Close  float64 `json:"close"`
+		}
+		require.NoError(t, s.LoadJSON(ctx, bucket, "data/price.json", &price))
+		assert.Equal(t, "VNM", price.Symbol)
+		assert.Equal(t, 71.5, price.Close)
+	})
+
+	t.Run("LoadJSONL", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "data/", []byte("{\"i\":1}\n\n{\"i\":2}\n"), "rows.jsonl"))
+
+		lines, err := s.LoadJSONL(ctx, bucket, "data/rows.jsonl")
+		require.NoError(t, err)
+		require.Len(t, lines, 2)
+		assert.JSONEq(t, `{"i":2}`, string(lines[1]))
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "dir/", []byte("hello"), "a.txt"))
+
+		attrs, err := s.Stat(ctx, bucket, "dir/a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, bucket, attrs.Bucket)
+		assert.Equal(t, "dir/a.txt", attrs.Name)
+		assert.Equal(t, int64(5), attrs.Size)
+		assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", attrs.MD5)
+		assert.Contains(t, attrs.ContentType, "text/plain")
+		assert.False(t, attrs.Updated.IsZero())
+	})
+
+	t.Run("List", func(t *testing.T) {
+		s := newStorage(t)
+		for _, name := range []string{"logs/b.txt", "logs/a.txt", "logs/sub/c.txt", "logs-old/d.txt", "other/e.txt"} {
+			require.NoError(t, s.CreateFile(ctx, bucket, "", []byte(name), name))
+		}
+
+		page, err := s.List(ctx, bucket, cloud_storage.ListOptions{Prefix: "logs/"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"logs/a.txt", "logs/b.txt", "logs/sub/c.txt"}, objectNames(page))
+		assert.Empty(t, page.NextPageToken)
+		assert.Equal(t, int64(len("logs/a.txt")), page.Objects[0].Size)
+
+		page, err = s.List(ctx, bucket, cloud_storage.ListOptions{Prefix: "logs"})
+		require.NoError(t, err)
+		assert.Len(t, page.Objects, 4)
+
+		page, err = s.List(ctx, bucket, cloud_storage.ListOptions{Prefix: "missing/"})
+		require.NoError(t, err)
+		assert.Empty(t, page.Objects)
+	})
+
+	t.Run("ListPages", func(t *testing.T) {
+		s := newStorage(t)
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			require.NoError(t, s.CreateFile(ctx, bucket, "pages/", []byte(name), name+".txt"))
+		}
+
+		var names []string
+		opts := cloud_storage.ListOptions{Prefix: "pages/", PageSize: 2}
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 3)
+			page, err := s.List(ctx, bucket, opts)
+			require.NoError(t, err)
+			assert.LessOrEqual(t, len(page.Objects), 2)
+			names = append(names, objectNames(page)...)
+			if page.NextPageToken == "" {
+				break
+			}
+			opts.PageToken = page.NextPageToken
+		}
+		assert.Equal(t, []string{"pages/a.txt", "pages/b.txt", "pages/c.txt", "pages/d.txt", "pages/e.txt"}, names)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "dir/", []byte("hello"), "a.txt"))
+
+		require.NoError(t, s.Delete(ctx, bucket, "dir/a.txt"))
+		ok, err := s.Exists(ctx, bucket, "dir/a.txt")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		assert.NoError(t, s.Delete(ctx, bucket, "dir/a.txt"))
+	})
+
+	t.Run("CopyAndMove", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "src/", []byte("hello"), "a.txt"))
+
+		require.NoError(t, s.Copy(ctx, bucket, "src/a.txt", bucket, "copy/a.txt"))
+		data, err := s.ReadFile(ctx, bucket, "copy/", "a.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+
+		require.NoError(t, s.Move(ctx, bucket, "src/a.txt", bucket, "moved/b.txt"))
+		data, err = s.ReadFile(ctx, bucket, "moved/", "b.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+
+		ok, err := s.Exists(ctx, bucket, "src/a.txt")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// moving onto itself keeps the object
+		require.NoError(t, s.Move(ctx, bucket, "moved/b.txt", bucket, "/moved/b.txt"))
+		ok, err = s.Exists(ctx, bucket, "moved/b.txt")
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("UploadAndDownload", func(t *testing.T) {
+		s := newStorage(t)
+		content := strings.Repeat("0123456789", 1000)
+		require.NoError(t, s.Upload(ctx, bucket, "exports/data.bin", strings.NewReader(content), cloud_storage.UploadOptions{
+			ContentType: "application/x-ndjson",
+			Metadata:    map[string]string{"owner": "ops"},
+		}))
+
+		var buf bytes.Buffer
+		n, err := s.Download(ctx, bucket, "exports/data.bin", &buf, cloud_storage.DownloadOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content, buf.String())
+
+		attrs, err := s.Stat(ctx, bucket, "exports/data.bin")
+		require.NoError(t, err)
+		assert.Equal(t, "application/x-ndjson", attrs.ContentType)
+		assert.Equal(t, map[string]string{"owner": "ops"}, attrs.Metadata)
+		assert.Empty(t, attrs.ContentEncoding)
+
+		require.NoError(t, s.Upload(ctx, bucket, "exports/data.json", strings.NewReader(`{"a":1}`), cloud_storage.UploadOptions{}))
+		attrs, err = s.Stat(ctx, bucket, "exports/data.json")
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", attrs.ContentType)
+	})
+
+	t.Run("RangeReads", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "", []byte("0123456789"), "digits.txt"))
+
+		assert.Equal(t, "345", readRange(t, s, bucket, "digits.txt", cloud_storage.DownloadOptions{Offset: 3, Length: 3}))
+		assert.Equal(t, "789", readRange(t, s, bucket, "digits.txt", cloud_storage.DownloadOptions{Offset: 7}))
+		assert.Equal(t, "01", readRange(t, s, bucket, "digits.txt", cloud_storage.DownloadOptions{Length: 2}))
+		assert.Equal(t, "89", readRange(t, s, bucket, "digits.txt", cloud_storage.DownloadOptions{Offset: 8, Length: 10}))
+
+		_, err := s.NewReader(ctx, bucket, "digits.txt", cloud_storage.DownloadOptions{Offset: 20})
+		assert.ErrorIs(t, err, cloud_storage.ErrInvalidRange)
+		_, err = s.NewReader(ctx, bucket, "digits.txt", cloud_storage.DownloadOptions{Offset: -1})
+		assert.ErrorIs(t, err, cloud_storage.ErrInvalidRange)
+		_, err = s.NewReader(ctx, bucket, "missing.txt", cloud_storage.DownloadOptions{})
+		assert.ErrorIs(t, err, cloud_storage.ErrObjectNotFound)
+	})
+
+	t.Run("Gzip", func(t *testing.T) {
+		s := newStorage(t)
+		content := strings.Repeat("{\"symbol\":\"VNM\"}\n", 1000)
+		require.NoError(t, s.Upload(ctx, bucket, "exports/rows.jsonl", strings.NewReader(content), cloud_storage.UploadOptions{Gzip: true}))
+
+		attrs, err := s.Stat(ctx, bucket, "exports/rows.jsonl")
+		require.NoError(t, err)
+		assert.Equal(t, cloud_storage.ContentEncodingGzip, attrs.ContentEncoding)
+		assert.Less(t, attrs.Size, int64(len(content)))
+
+		data, err := s.ReadFile(ctx, bucket, "exports", "rows.jsonl")
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+
+		lines, err := s.LoadJSONL(ctx, bucket, "exports/rows.jsonl")
+		require.NoError(t, err)
+		assert.Len(t, lines, 1000)
+
+		// ranges apply to the decompressed content
+		assert.Equal(t, `"VNM"}`, readRange(t, s, bucket, "exports/rows.jsonl", cloud_storage.DownloadOptions{Offset: 27, Length: 6}))
+	})
+
+	t.Run("JSONLIterator", func(t *testing.T) {
+		s := newStorage(t)
+		type row struct {
+			I int `json:"i"`
+		}
+		require.NoError(t, s.Upload(ctx, bucket, "rows.jsonl", strings.NewReader("{\"i\":1}\n\n{\"i\":2}\r\n{\"i\":3}"), cloud_storage.UploadOptions{Gzip: true}))
+
+		it, err := cloud_storage.NewJSONLIterator[row](ctx, s, bucket, "rows.jsonl")
+		require.NoError(t, err)
+		var rows []row
+		for it.Next() {
+			rows = append(rows, it.Value())
+		}
+		require.NoError(t, it.Err())
+		require.NoError(t, it.Close())
+		assert.Equal(t, []row{{1}, {2}, {3}}, rows)
+
+		require.NoError(t, s.CreateFile(ctx, bucket, "", []byte("{\"i\":1}\n{\"i\":\"x\"}\n"), "bad.jsonl"))
+		it, err = cloud_storage.NewJSONLIterator[row](ctx, s, bucket, "bad.jsonl")
+		require.NoError(t, err)
+		defer it.Close()
+		assert.True(t, it.Next())
+		assert.False(t, it.Next())
+		assert.ErrorContains(t, it.Err(), "line 2")
+
+		_, err = cloud_storage.NewJSONLIterator[row](ctx, s, bucket, "missing.jsonl")
+		assert.ErrorIs(t, err, cloud_storage.ErrObjectNotFound)
+	})
+
+	t.Run("SignedURL", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateFile(ctx, bucket, "dir/", []byte("hello"), "a.txt"))
+
+		url, err := s.SignedURL(ctx, bucket, "dir/", "a.txt", 60)
+		require.NoError(t, err)
+		assert.Contains(t, url, "a.txt")
+	})
+
+	t.Run("SignedUploadURL", func(t *testing.T) {
+		s := newStorage(t)
+
+		upload, err := s.SignedUploadURL(ctx, bucket, "uploads/a.png", cloud_storage.UploadURLOptions{ContentType: "image/png", MaxSize: 1024})
+		require.NoError(t, err)
+		assert.Equal(t, "PUT", upload.Method)
+		assert.Contains(t, upload.URL, "a.png")
+		assert.True(t, upload.Expires.After(time.Now()))
+
+		upload, err = s.SignedUploadURL(ctx, bucket, "uploads/a.png", cloud_storage.UploadURLOptions{Method: "POST"})
+		require.NoError(t, err)
+		assert.Equal(t, "POST", upload.Method)
+
+		_, err = s.SignedUploadURL(ctx, bucket, "uploads/a.png", cloud_storage.UploadURLOptions{Method: "PATCH"})
+		assert.Error(t, err)
+		_, err = s.SignedUploadURL(ctx, bucket, "uploads/a.png", cloud_storage.UploadURLOptions{MinSize: 10, MaxSize: 5})
+		assert.Error(t, err)
+	})
+
+	t.Run("VerifyUpload", func(t *testing.T) {
+		s := newStorage(t)
+		png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+		opts := cloud_storage.UploadURLOptions{ContentType: "image/png", MinSize: 8, MaxSize: 64}
+
+		require.NoError(t, s.Upload(ctx, bucket, "ok.png", bytes.NewReader(png), cloud_storage.UploadOptions{ContentType: "image/png"}))
+		attrs, err := cloud_storage.VerifyUpload(ctx, s, bucket, "ok.png", opts)
+		require.NoError(t, err)
+		assert.EqualValues(t, len(png), attrs.Size)
+
+		rejected := map[string]cloud_storage.UploadOptions{
+			"large.png":   {ContentType: "image/png"},
+			"type.png":    {ContentType: "image/jpeg"},
+			"sniffed.png": {ContentType: "image/png"},
+			"text.png":    {ContentType: "image/png"},
+			"binary.png":  {ContentType: "image/png"},
+		}
+		contents := map[string][]byte{
+			"large.png":   append(png, make([]byte, 64)...),
+			"type.png":    png,
+			"sniffed.png": []byte("%PDF-1.4 not a png at all"),
+			"text.png":    []byte("just text declared as a png"),
+			"binary.png":  {0x00, 0x01, 0xFE, 0xFF, 0x00, 0x01, 0xFE, 0xFF},
+		}
+		for name, uploadOpts := range rejected {
+			require.NoError(t, s.Upload(ctx, bucket, name, bytes.NewReader(contents[name]), uploadOpts))
+
+			_, err := cloud_storage.VerifyUpload(ctx, s, bucket, name, opts)
+			assert.ErrorIs(t, err, cloud_storage.ErrUploadRejected, name)
+
+			ok, err := s.Exists(ctx, bucket, name)
+			require.NoError(t, err)
+			assert.False(t, ok, name)
+		}
+
+		_, err = cloud_storage.VerifyUpload(ctx, s, bucket, "missing.png", opts)
+		assert.ErrorIs(t, err, cloud_storage.ErrObjectNotFound)
+	})
+}
+
+func objectNames(page *cloud_storage.ListPage) []string {
+	names := make([]string, 0, len(page.Objects))
+	for _, object := range page.Objects {
+		names = append(names, object.Name)
+	}
+	return names
+}
+
+func readRange(t *testing.T, s cloud_storage.CloudStorageInterface, bucket string, name string, opts cloud_storage.DownloadOptions) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	_, err := s.Download(context.Background(), bucket, name, &buf, opts)
+	require.NoError(t, err)
+	return buf.String()
+}
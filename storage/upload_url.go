@@ -0,0 +1,176 @@
+package cloud_storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultUploadURLTTL is the validity of signed upload URLs when UploadURLOptions.TTL is not set.
+	DefaultUploadURLTTL = 15 * time.Minute
+
+	// UploadFileField is the form field of the file in POST uploads, it must be the last field.
+	UploadFileField = "file"
+)
+
+var ErrUploadRejected = errors.New("storage: upload rejected")
+
+// UploadURLOptions constrains the upload allowed by a signed URL.
+type UploadURLOptions struct {
+	// Method is http.MethodPut, the default, or http.MethodPost for HTML form uploads.
+	Method string
+
+	// ContentType the client must send, any when empty.
+	ContentType string
+
+	// MinSize and MaxSize bound the size in bytes, 0 leaves them open. Signed PUT URLs of S3 cannot
+	// enforce them, VerifyUpload does.
+	MinSize int64
+	MaxSize int64
+
+	// TTL is the validity of the URL, DefaultUploadURLTTL by default.
+	TTL time.Duration
+}
+
+// SignedUpload tells a client how to upload an object directly to the bucket.
+type SignedUpload struct {
+	Method string
+	URL    string
+
+	// Headers must be sent with the request.
+	Headers map[string]string
+
+	// Fields are the form fields of POST uploads, sent before the UploadFileField file.
+	Fields map[string]string
+
+	Expires time.Time
+}
+
+func (opts UploadURLOptions) withDefaults() (UploadURLOptions, error) {
+	if opts.Method == "" {
+		opts.Method = http.MethodPut
+	}
+	if opts.Method != http.MethodPut && opts.Method != http.MethodPost {
+		return opts, fmt.Errorf("storage: signed upload method must be PUT or POST, got %q", opts.Method)
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultUploadURLTTL
+	}
+	if opts.MinSize < 0 || opts.MaxSize < 0 || (opts.MaxSize > 0 && opts.MinSize > opts.MaxSize) {
+		return opts, fmt.Errorf("storage: invalid upload size range [%d, %d]", opts.MinSize, opts.MaxSize)
+	}
+	return opts, nil
+}
+
+// maxSize is the upper bound of the size range of POST policies.
+func (opts UploadURLOptions) maxSize() int64 {
+	if opts.MaxSize > 0 {
+		return opts.MaxSize
+	}
+	return 5 << 40
+}
+
+// VerifyUpload confirms that an object uploaded with a signed URL landed and matches opts, call it
+// when the client reports the upload. Objects breaking the constraints are deleted and the error
+// wraps ErrUploadRejected. The content is sniffed so clients cannot lie about the content type.
+func VerifyUpload(ctx context.Context, s CloudStorageInterface, bucketName string, name string, opts UploadURLOptions) (*ObjectAttrs, error) {
+	attrs, err := s.Stat(ctx, bucketName, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkUpload(ctx, s, attrs, opts); err != nil {
+		if deleteErr := s.Delete(ctx, bucketName, name); deleteErr != nil {
+			return nil, errors.Join(err, deleteErr)
+		}
+		return nil, err
+	}
+	return attrs, nil
+}
+
+func checkUpload(ctx context.Context, s CloudStorageInterface, attrs *ObjectAttrs, opts UploadURLOptions) error {
+	if attrs.Size < opts.MinSize || (opts.MaxSize > 0 && attrs.Size > opts.MaxSize) {
+		return fmt.Errorf("%w: size %d out of [%d, %d]", ErrUploadRejected, attrs.Size, opts.MinSize, opts.MaxSize)
+	}
+	if opts.ContentType == "" {
+		return nil
+	}
+	if !sameMediaType(attrs.ContentType, opts.ContentType) {
+		return fmt.Errorf("%w: content type %q, expected %q", ErrUploadRejected, attrs.ContentType, opts.ContentType)
+	}
+
+	rc, err := s.NewReader(ctx, attrs.Bucket, attrs.Name, DownloadOptions{})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(rc, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	// the expected type is only trusted where sniffing cannot tell, e.g. text/csv for text content
+	if sniffed := SniffContentType(head[:n], opts.ContentType); !sameMediaType(sniffed, opts.ContentType) {
+		return fmt.Errorf("%w: content looks like %q, expected %q", ErrUploadRejected, sniffed, opts.ContentType)
+	}
+	return nil
+}
+
+// sniffedTypes are the types http.DetectContentType recognizes, content declared as one of them is
+// not of that type when sniffing does not find it.
+var sniffedTypes = map[string]bool{
+	"application/ogg": true, "application/pdf": true, "application/postscript": true, "application/vnd.ms-fontobject": true,
+	"application/wasm": true, "application/x-gzip": true, "application/x-rar-compressed": true, "application/zip": true,
+	"audio/aiff": true, "audio/basic": true, "audio/midi": true, "audio/mpeg": true, "audio/wave": true,
+	"font/collection": true, "font/otf": true, "font/ttf": true, "font/woff": true, "font/woff2": true,
+	"image/bmp": true, "image/gif": true, "image/jpeg": true, "image/png": true, "image/webp": true, "image/x-icon": true,
+	"text/html": true, "text/xml": true, "video/avi": true, "video/mp4": true, "video/webm": true,
+}
+
+// SniffContentType returns the content type of head, the first 512 bytes of a file. Sniffing cannot
+// tell text formats apart, nor recognize every binary format, so the first declared type refines
+// the result when it is consistent: a text format such as text/csv or application/json for text
+// content, a format sniffing does not recognize for binary content. It checks the verified uploads
+// of signed upload URLs, and the files of upload.Parse.
+func SniffContentType(head []byte, declared ...string) string {
+	sniffed := http.DetectContentType(head)
+	text := strings.HasPrefix(sniffed, "text/plain")
+	if !text && sniffed != "application/octet-stream" {
+		return sniffed
+	}
+
+	for _, contentType := range declared {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType == "application/octet-stream" {
+			continue
+		}
+		if text && isTextType(mediaType) || !text && !sniffedTypes[mediaType] && !isTextType(mediaType) {
+			return contentType
+		}
+	}
+	return sniffed
+}
+
+// isTextType reports the text formats that content sniffed as plain text can be, HTML and XML are
+// sniffed so they are not.
+func isTextType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return !sniffedTypes[mediaType]
+	}
+	return mediaType == "application/json" || mediaType == "application/x-ndjson"
+}
+
+// sameMediaType compares content types without their parameters, e.g. charset.
+func sameMediaType(a string, b string) bool {
+	mediaTypeA, _, errA := mime.ParseMediaType(a)
+	mediaTypeB, _, errB := mime.ParseMediaType(b)
+	return errA == nil && errB == nil && mediaTypeA == mediaTypeB
+}
@@ -0,0 +1,109 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	cloud_storage "github.com/ngtrvu/zen-go/storage"
+)
+
+// Sink stores the files of Parse.
+type Sink interface {
+	// Save streams r into a new file called name and returns its location. The content is not
+	// stored when r fails, e.g. with ErrFileTooLarge.
+	Save(ctx context.Context, name string, contentType string, r io.Reader) (location string, err error)
+	// Remove removes a saved file, removing a missing file is not an error.
+	Remove(ctx context.Context, location string) error
+}
+
+// DiskSink saves files in Dir, the location is the file path.
+type DiskSink struct {
+	Dir string
+}
+
+func (s DiskSink) Save(ctx context.Context, name string, contentType string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(s.Dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(s.Dir, name)
+	return filePath, os.Rename(tmp.Name(), filePath)
+}
+
+func (s DiskSink) Remove(ctx context.Context, location string) error {
+	if err := os.Remove(location); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// StorageSink uploads files to Bucket under Prefix, the location is the object name.
+type StorageSink struct {
+	Storage cloud_storage.CloudStorageInterface
+	Bucket  string
+	Prefix  string
+}
+
+func (s StorageSink) Save(ctx context.Context, name string, contentType string, r io.Reader) (string, error) {
+	objectName := cloud_storage.ObjectName(s.Prefix, name)
+	return objectName, s.Storage.Upload(ctx, s.Bucket, objectName, r, cloud_storage.UploadOptions{ContentType: contentType})
+}
+
+func (s StorageSink) Remove(ctx context.Context, location string) error {
+	return s.Storage.Delete(ctx, s.Bucket, location)
+}
+
+// MemorySink keeps files in memory, for small files and tests. The location is the name.
+type MemorySink struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func (s *MemorySink) Save(ctx context.Context, name string, contentType string, r io.Reader) (string, error) {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string][]byte)
+	}
+	s.files[name] = buf.Bytes()
+	return name, nil
+}
+
+func (s *MemorySink) Remove(ctx context.Context, location string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, location)
+	return nil
+}
+
+// Bytes returns the content of a saved file, nil when it does not exist.
+func (s *MemorySink) Bytes(location string) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.files[location]
+}
@@ -0,0 +1,314 @@
+// Package upload streams the files of multipart requests to disk or cloud storage, enforcing per-endpoint
+// policies on their type, size and count.
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	cloud_storage "github.com/ngtrvu/zen-go/storage"
+)
+
+const (
+	DefaultMaxFileSize = int64(10 << 20)
+	DefaultMaxFiles    = 1
+
+	// maxFieldsSize bounds the non file fields of a request.
+	maxFieldsSize = int64(1 << 20)
+	sniffSize     = 512
+)
+
+var (
+	ErrNotMultipart    = errors.New("upload: request is not multipart/form-data")
+	ErrMissingFile     = errors.New("upload: missing file")
+	ErrFileTooLarge    = errors.New("upload: file too large")
+	ErrTooManyFiles    = errors.New("upload: too many files")
+	ErrTypeNotAllowed  = errors.New("upload: file type not allowed")
+	ErrUnexpectedField = errors.New("upload: unexpected file field")
+)
+
+var extensionPattern = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// Policy is what an endpoint accepts.
+//
+//	var documentPolicy = upload.Policy{
+//		Fields:       []string{"documents"},
+//		AllowedTypes: []string{"application/pdf", "image/*"},
+//		MaxFileSize:  20 << 20,
+//		MaxFiles:     5,
+//	}
+type Policy struct {
+	// Fields are the form fields accepted as files, any when empty.
+	Fields []string
+
+	// AllowedTypes are media types such as "application/pdf", or "image/*", any when empty.
+	AllowedTypes []string
+
+	// MaxFileSize is the size limit of each file in bytes, DefaultMaxFileSize when 0.
+	MaxFileSize int64
+
+	// MaxFiles is the number of files accepted per request, DefaultMaxFiles when 0.
+	MaxFiles int
+
+	// RequireFile fails requests without files with ErrMissingFile.
+	RequireFile bool
+}
+
+// File is an uploaded file stored by a Sink.
+type File struct {
+	Field string
+
+	// FileName is the name sent by the client, never use it as a path.
+	FileName string
+
+	// ContentType is sniffed from the content, the type declared by the client is only trusted for
+	// formats sniffing cannot recognize such as CSV, see cloud_storage.SniffContentType. Text content
+	// declared as an image is text/plain.
+	ContentType string
+	Size        int64
+
+	// SHA256 and MD5 are the hex encoded checksums of the content.
+	SHA256 string
+	MD5    string
+
+	// Location is where the Sink stored the file, e.g. a path or an object name.
+	Location string
+}
+
+// Result holds the files and the other fields of a request.
+type Result struct {
+	Files  []*File
+	Values url.Values
+}
+
+// File returns the first file of field, nil when there is none.
+func (r *Result) File(field string) *File {
+	for _, file := range r.Files {
+		if file.Field == field {
+			return file
+		}
+	}
+	return nil
+}
+
+// FilesOf returns the files of field in the order of the request.
+func (r *Result) FilesOf(field string) []*File {
+	var files []*File
+	for _, file := range r.Files {
+		if file.Field == field {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Remove removes the files from sink, e.g. when the request fails after the upload.
+func (r *Result) Remove(ctx context.Context, sink Sink) error {
+	var errs []error
+	for _, file := range r.Files {
+		errs = append(errs, sink.Remove(ctx, file.Location))
+	}
+	return errors.Join(errs...)
+}
+
+// Parse streams the files of a multipart request into sink, nothing is buffered whole. When a file
+// breaks the policy the files stored so far are removed and the error wraps one of the Err values.
+func Parse(r *http.Request, policy Policy, sink Sink) (*Result, error) {
+	ctx := r.Context()
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "multipart/form-data" {
+		return nil, ErrNotMultipart
+	}
+	r.Body = http.MaxBytesReader(nil, r.Body, policy.maxRequestSize())
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotMultipart, err)
+	}
+
+	result := &Result{Values: url.Values{}}
+	if err := parseParts(ctx, reader, policy, sink, result); err != nil {
+		if removeErr := result.Remove(ctx, sink); removeErr != nil {
+			return nil, errors.Join(err, removeErr)
+		}
+		return nil, err
+	}
+	if policy.RequireFile && len(result.Files) == 0 {
+		return nil, ErrMissingFile
+	}
+	return result, nil
+}
+
+func parseParts(ctx context.Context, reader *multipart.Reader, policy Policy, sink Sink, result *Result) error {
+	fieldsSize := int64(0)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return tooLarge(err)
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldsSize-fieldsSize+1))
+			if err != nil {
+				return tooLarge(err)
+			}
+			fieldsSize += int64(len(value))
+			if fieldsSize > maxFieldsSize {
+				return fmt.Errorf("%w: form fields exceed %d bytes", ErrFileTooLarge, maxFieldsSize)
+			}
+			result.Values.Add(part.FormName(), string(value))
+			continue
+		}
+
+		if len(policy.Fields) > 0 && !slices.Contains(policy.Fields, part.FormName()) {
+			return fmt.Errorf("%w: %q", ErrUnexpectedField, part.FormName())
+		}
+		if len(result.Files) >= policy.maxFiles() {
+			return fmt.Errorf("%w: at most %d", ErrTooManyFiles, policy.maxFiles())
+		}
+
+		file, err := save(ctx, part, policy, sink)
+		if err != nil {
+			return err
+		}
+		result.Files = append(result.Files, file)
+	}
+}
+
+// save checks the type of part from its first bytes and streams it into sink with its checksums.
+func save(ctx context.Context, part *multipart.Part, policy Policy, sink Sink) (*File, error) {
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(part, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, tooLarge(err)
+	}
+	head = head[:n]
+
+	file := &File{
+		Field:       part.FormName(),
+		FileName:    part.FileName(),
+		ContentType: contentType(head, part),
+	}
+	if !policy.allows(file.ContentType) {
+		return nil, fmt.Errorf("%w: %s", ErrTypeNotAllowed, file.ContentType)
+	}
+
+	sha256Hash, md5Hash := sha256.New(), md5.New()
+	body := &limitReader{
+		r:   io.TeeReader(io.MultiReader(bytes.NewReader(head), part), io.MultiWriter(sha256Hash, md5Hash)),
+		max: policy.maxFileSize(),
+	}
+	location, err := sink.Save(ctx, uuid.NewString()+extension(file), file.ContentType, body)
+	if err != nil {
+		if location != "" {
+			sink.Remove(ctx, location)
+		}
+		return nil, tooLarge(err)
+	}
+
+	file.Location = location
+	file.Size = body.read
+	file.SHA256 = hex.EncodeToString(sha256Hash.Sum(nil))
+	file.MD5 = hex.EncodeToString(md5Hash.Sum(nil))
+	return file, nil
+}
+
+// contentType trusts the type declared by the client, or its file extension, only when sniffing is
+// inconclusive and the content is consistent with it.
+func contentType(head []byte, part *multipart.Part) string {
+	return cloud_storage.SniffContentType(head, part.Header.Get("Content-Type"), mime.TypeByExtension(filepath.Ext(part.FileName())))
+}
+
+// extension names the stored file after its verified content type, the extension of the client file
+// name is kept when it maps to that type.
+func extension(file *File) string {
+	mediaType, _, err := mime.ParseMediaType(file.ContentType)
+	if err != nil {
+		return ""
+	}
+	ext := strings.ToLower(filepath.Ext(file.FileName))
+	if byExtension, _, err := mime.ParseMediaType(mime.TypeByExtension(ext)); err == nil && byExtension == mediaType && extensionPattern.MatchString(ext) {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+func (p Policy) allows(contentType string) bool {
+	if len(p.AllowedTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range p.AllowedTypes {
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) maxFileSize() int64 {
+	if p.MaxFileSize <= 0 {
+		return DefaultMaxFileSize
+	}
+	return p.MaxFileSize
+}
+
+func (p Policy) maxFiles() int {
+	if p.MaxFiles <= 0 {
+		return DefaultMaxFiles
+	}
+	return p.MaxFiles
+}
+
+// maxRequestSize leaves room for the fields and the multipart framing.
+func (p Policy) maxRequestSize() int64 {
+	return int64(p.maxFiles())*p.maxFileSize() + 2*maxFieldsSize
+}
+
+// tooLarge maps the error of a request body over the limit to ErrFileTooLarge.
+func tooLarge(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return fmt.Errorf("%w: request exceeds %d bytes", ErrFileTooLarge, maxBytesErr.Limit)
+	}
+	return err
+}
+
+// limitReader fails with ErrFileTooLarge once more than max bytes are read.
+type limitReader struct {
+	r    io.Reader
+	max  int64
+	read int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, l.max)
+	}
+	return n, err
+}
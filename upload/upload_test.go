@@ -0,0 +1,219 @@
+package upload_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	cloud_storage "github.com/ngtrvu/zen-go/storage"
+	"github.com/ngtrvu/zen-go/upload"
+)
+
+var (
+	pdf = []byte("%PDF-1.4\n1 0 obj << /Type /Catalog >> endobj\n")
+	png = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+)
+
+type part struct {
+	field       string
+	fileName    string
+	contentType string
+	content     []byte
+}
+
+func newRequest(t *testing.T, parts ...part) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, p := range parts {
+		if p.fileName == "" {
+			require.NoError(t, form.WriteField(p.field, string(p.content)))
+			continue
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="`+p.field+`"; filename="`+p.fileName+`"`)
+		if p.contentType != "" {
+			header.Set("Content-Type", p.contentType)
+		}
+		w, err := form.CreatePart(header)
+		require.NoError(t, err)
+		w.Write(p.content)
+	}
+	require.NoError(t, form.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestParse(t *testing.T) {
+	sink := &upload.MemorySink{}
+	r := newRequest(t,
+		part{field: "title", content: []byte("contract")},
+		part{field: "documents", fileName: "a.pdf", contentType: "application/octet-stream", content: pdf},
+		part{field: "documents", fileName: "scan.PNG", content: png},
+		part{field: "notes", fileName: "notes.csv", contentType: "text/csv", content: []byte("a,b\n1,2\n")},
+	)
+
+	result, err := upload.Parse(r, upload.Policy{
+		AllowedTypes: []string{"application/pdf", "image/*", "text/csv"},
+		MaxFiles:     3,
+	}, sink)
+	require.NoError(t, err)
+	assert.Equal(t, "contract", result.Values.Get("title"))
+	require.Len(t, result.Files, 3)
+	require.Len(t, result.FilesOf("documents"), 2)
+
+	document := result.File("documents")
+	assert.Equal(t, "a.pdf", document.FileName)
+	assert.Equal(t, "application/pdf", document.ContentType)
+	assert.EqualValues(t, len(pdf), document.Size)
+	sum := sha256.Sum256(pdf)
+	assert.Equal(t, hex.EncodeToString(sum[:]), document.SHA256)
+	assert.Len(t, document.MD5, 32)
+	assert.True(t, strings.HasSuffix(document.Location, ".pdf"))
+	assert.Equal(t, pdf, sink.Bytes(document.Location))
+
+	assert.True(t, strings.HasSuffix(result.FilesOf("documents")[1].Location, ".png"))
+	assert.Equal(t, "text/csv", result.File("notes").ContentType, "declared type of text formats")
+	assert.Nil(t, result.File("missing"))
+}
+
+func TestParse_Policy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy upload.Policy
+		parts  []part
+		err    error
+	}{
+		{
+			name:   "type not allowed",
+			policy: upload.Policy{AllowedTypes: []string{"image/*"}, MaxFiles: 2},
+			parts:  []part{{field: "file", fileName: "a.png", content: png}, {field: "file", fileName: "fake.png", contentType: "image/png", content: pdf}},
+			err:    upload.ErrTypeNotAllowed,
+		},
+		{
+			name:   "text declared as an image",
+			policy: upload.Policy{AllowedTypes: []string{"image/*"}},
+			parts:  []part{{field: "file", fileName: "avatar.png", contentType: "image/png", content: []byte("hello, this is not an image")}},
+			err:    upload.ErrTypeNotAllowed,
+		},
+		{
+			name:   "binary declared as a sniffed type",
+			policy: upload.Policy{AllowedTypes: []string{"image/*"}},
+			parts:  []part{{field: "file", fileName: "avatar.png", contentType: "image/png", content: []byte{0x00, 0x01, 0xFE, 0xFF, 0x00}}},
+			err:    upload.ErrTypeNotAllowed,
+		},
+		{
+			name:   "file too large",
+			policy: upload.Policy{MaxFileSize: 16},
+			parts:  []part{{field: "file", fileName: "a.pdf", content: pdf}},
+			err:    upload.ErrFileTooLarge,
+		},
+		{
+			name:   "too many files",
+			policy: upload.Policy{MaxFiles: 1},
+			parts:  []part{{field: "file", fileName: "a.png", content: png}, {field: "file", fileName: "b.png", content: png}},
+			err:    upload.ErrTooManyFiles,
+		},
+		{
+			name:   "unexpected field",
+			policy: upload.Policy{Fields: []string{"avatar"}},
+			parts:  []part{{field: "file", fileName: "a.png", content: png}},
+			err:    upload.ErrUnexpectedField,
+		},
+		{
+			name:   "missing file",
+			policy: upload.Policy{RequireFile: true},
+			parts:  []part{{field: "title", content: []byte("no file")}},
+			err:    upload.ErrMissingFile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := upload.Parse(newRequest(t, tt.parts...), tt.policy, upload.DiskSink{Dir: dir})
+			assert.ErrorIs(t, err, tt.err)
+
+			// the files saved before the failure are removed
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	_, err := upload.Parse(r, upload.Policy{}, &upload.MemorySink{})
+	assert.ErrorIs(t, err, upload.ErrNotMultipart)
+}
+
+func TestParse_Extension(t *testing.T) {
+	result, err := upload.Parse(newRequest(t,
+		part{field: "file", fileName: "photo.pdf", content: png},
+		part{field: "file", fileName: "page.html", contentType: "image/png", content: []byte("hello, this is not an image")},
+		part{field: "file", fileName: "data.json", contentType: "application/json", content: []byte(`{"a": 1}`)},
+	), upload.Policy{MaxFiles: 3}, &upload.MemorySink{})
+	require.NoError(t, err)
+	require.Len(t, result.Files, 3)
+
+	assert.Equal(t, "image/png", result.Files[0].ContentType)
+	assert.True(t, strings.HasSuffix(result.Files[0].Location, ".png"), "named after the sniffed type")
+	assert.Equal(t, "text/plain; charset=utf-8", result.Files[1].ContentType)
+	assert.False(t, strings.HasSuffix(result.Files[1].Location, ".html"))
+	assert.False(t, strings.HasSuffix(result.Files[1].Location, ".png"))
+	assert.Equal(t, "application/json", result.Files[2].ContentType)
+	assert.True(t, strings.HasSuffix(result.Files[2].Location, ".json"))
+}
+
+func TestDiskSink(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "uploads")
+	result, err := upload.Parse(newRequest(t, part{field: "file", fileName: "../../a.pdf", content: pdf}), upload.Policy{}, upload.DiskSink{Dir: dir})
+	require.NoError(t, err)
+
+	file := result.File("file")
+	assert.Equal(t, dir, filepath.Dir(file.Location))
+	data, err := os.ReadFile(file.Location)
+	require.NoError(t, err)
+	assert.Equal(t, pdf, data)
+
+	require.NoError(t, result.Remove(context.Background(), upload.DiskSink{Dir: dir}))
+	assert.NoFileExists(t, file.Location)
+}
+
+func TestStorageSink(t *testing.T) {
+	ctx := context.Background()
+	storage := cloud_storage.NewMemoryStorage()
+	sink := upload.StorageSink{Storage: storage, Bucket: "bucket", Prefix: "contracts"}
+
+	result, err := upload.Parse(newRequest(t, part{field: "file", fileName: "a.pdf", content: pdf}), upload.Policy{}, sink)
+	require.NoError(t, err)
+
+	file := result.File("file")
+	assert.True(t, strings.HasPrefix(file.Location, "contracts/"))
+	attrs, err := storage.Stat(ctx, "bucket", file.Location)
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", attrs.ContentType)
+	assert.Equal(t, file.MD5, attrs.MD5)
+
+	_, err = upload.Parse(newRequest(t, part{field: "file", fileName: "a.pdf", content: pdf}), upload.Policy{MaxFileSize: 16}, sink)
+	assert.ErrorIs(t, err, upload.ErrFileTooLarge)
+
+	page, err := storage.List(ctx, "bucket", cloud_storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, page.Objects, 1)
+}
@@ -2,33 +2,409 @@ package utils
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
+
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatPNG  = "png"
+
+	DefaultJPEGQuality = 85
+
+	// minJPEGQuality is the lowest quality tried to fit ImageOptions.MaxBytes.
+	minJPEGQuality = 30
+
+	exifOrientationTag = 0x0112
+)
+
+var (
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	ErrImageTooLarge    = errors.New("image too large")
 )
 
+// MaxImagePixels bounds the width x height of the images decoded, a few bytes of header can claim
+// dimensions that take gigabytes to decode.
+var MaxImagePixels = 50_000_000
+
+// ImageOptions controls how ProcessImage normalises an image.
+type ImageOptions struct {
+	// MaxWidth and MaxHeight bound the size keeping the aspect ratio, 0 leaves a side open.
+	// Images are never enlarged.
+	MaxWidth  int
+	MaxHeight int
+
+	// Format is ImageFormatJPEG or ImageFormatPNG, the format of the input when empty. Inputs in
+	// other formats, e.g. GIF or WebP, are encoded as JPEG.
+	Format string
+
+	// Quality is the JPEG quality, DefaultJPEGQuality when 0.
+	Quality int
+
+	// MaxBytes lowers the JPEG quality until the output fits, down to a quality of 30.
+	MaxBytes int
+}
+
+// ProcessImage decodes an image, rotates it upright following its EXIF orientation, resizes it and
+// encodes it again. The output carries no EXIF metadata such as GPS position or camera serial.
+//
+//	selfie, err := utils.ProcessImage(data, utils.ImageOptions{MaxWidth: 1600, MaxHeight: 1600, Format: utils.ImageFormatJPEG, MaxBytes: 500 << 10})
+func ProcessImage(imgData []byte, opts ImageOptions) ([]byte, error) {
+	img, format, err := DecodeImage(imgData)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Format == "" {
+		opts.Format = format
+	}
+	return encodeImage(FitImage(img, opts.MaxWidth, opts.MaxHeight), opts)
+}
+
+// ResizeImage fits an image in a maximumSize square keeping its format, orientation is fixed and
+// EXIF metadata stripped.
 func ResizeImage(imgData []byte, maximumSize int) ([]byte, error) {
-	return imgData, nil
+	return ProcessImage(imgData, ImageOptions{MaxWidth: maximumSize, MaxHeight: maximumSize})
+}
+
+// Thumbnails fits an image in a square of each size, decoding it once. opts.MaxWidth and
+// opts.MaxHeight are ignored.
+func Thumbnails(imgData []byte, sizes []int, opts ImageOptions) (map[int][]byte, error) {
+	img, format, err := DecodeImage(imgData)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Format == "" {
+		opts.Format = format
+	}
+
+	thumbnails := make(map[int][]byte, len(sizes))
+	for _, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid thumbnail size %d", size)
+		}
+		thumbnail, err := encodeImage(FitImage(img, size, size), opts)
+		if err != nil {
+			return nil, err
+		}
+		thumbnails[size] = thumbnail
+	}
+	return thumbnails, nil
 }
 
 func ConvertPNGToJPG(imgData []byte, quality int) ([]byte, error) {
-	// Create a bytes.Reader from imgData
-	imgReader := bytes.NewReader(imgData)
+	config, err := png.DecodeConfig(bytes.NewReader(imgData))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkImageSize(config); err != nil {
+		return nil, err
+	}
 
 	// Decode the PNG image
-	img, err := png.Decode(imgReader)
+	img, err := png.Decode(bytes.NewReader(imgData))
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a bytes.Buffer to write the JPEG image to
-	jpgBuffer := new(bytes.Buffer)
+	// Encode the image to JPEG, transparent pixels become white
+	return encodeJPEG(img, quality)
+}
+
+// DecodeImage decodes a JPEG, PNG, GIF or WebP image rotated upright following its EXIF orientation,
+// it returns the format name. Images over MaxImagePixels fail with ErrImageTooLarge before decoding.
+func DecodeImage(imgData []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(imgData))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, "", ErrUnsupportedImage
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkImageSize(config); err != nil {
+		return nil, "", err
+	}
 
-	// Encode the image to JPEG
-	err = jpeg.Encode(jpgBuffer, img, &jpeg.Options{Quality: quality})
+	img, format, err := image.Decode(bytes.NewReader(imgData))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, "", ErrUnsupportedImage
+	}
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	return OrientImage(img, ImageOrientation(imgData)), format, nil
+}
+
+func checkImageSize(config image.Config) error {
+	if config.Width <= 0 || config.Height <= 0 {
+		return fmt.Errorf("%w: invalid size %dx%d", ErrUnsupportedImage, config.Width, config.Height)
+	}
+	if int64(config.Width)*int64(config.Height) > int64(MaxImagePixels) {
+		return fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+	return nil
+}
+
+// FitImage scales an image down to fit maxWidth x maxHeight keeping its aspect ratio, 0 leaves a side
+// open. Smaller images are returned unchanged.
+func FitImage(img image.Image, maxWidth int, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+	if scale == 1.0 {
+		return img
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// OrientImage applies an EXIF orientation, 1 to 8, so the image displays upright without it.
+func OrientImage(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// orientations 5 to 8 swap width and height
+	dstWidth, dstHeight := w, h
+	if orientation >= 5 {
+		dstWidth, dstHeight = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90 counterclockwise, displayed rotated clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90 clockwise, displayed rotated counterclockwise
+				sx, sy = w-1-y, x
+			}
+			dst.SetNRGBA(x, y, src.NRGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// ImageOrientation reads the EXIF orientation of a JPEG image, 1 (upright) when absent.
+func ImageOrientation(imgData []byte) int {
+	exif := jpegEXIF(imgData)
+	if len(exif) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(exif[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	// compared before the conversion, a large offset overflows int on 32-bit platforms
+	offset := order.Uint32(exif[4:8])
+	if offset > uint32(len(exif)-2) {
+		return 1
+	}
+	ifd := int(offset)
+	entries := int(order.Uint16(exif[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(exif) {
+			return 1
+		}
+		if order.Uint16(exif[entry:]) == exifOrientationTag {
+			if orientation := int(order.Uint16(exif[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// StripImageMetadata removes EXIF, XMP, IPTC and comments from a JPEG or PNG image without re-encoding
+// it, other formats are returned unchanged. The EXIF orientation is lost too, use ProcessImage to keep
+// photos upright.
+func StripImageMetadata(imgData []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(imgData, []byte{0xFF, 0xD8}):
+		return stripJPEGMetadata(imgData)
+	case bytes.HasPrefix(imgData, []byte("\x89PNG\r\n\x1a\n")):
+		return stripPNGMetadata(imgData)
+	default:
+		return imgData, nil
+	}
+}
+
+// jpegEXIF returns the TIFF structure of the EXIF segment of a JPEG image.
+func jpegEXIF(imgData []byte) []byte {
+	var exif []byte
+	walkJPEGSegments(imgData, func(marker byte, segment []byte) bool {
+		payload := segment[4:]
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			exif = payload[6:]
+			return false
+		}
+		return true
+	})
+	return exif
+}
+
+// walkJPEGSegments calls fn with the marker and the bytes of each segment before the image data, fn
+// returns false to stop. It returns the offset of the first byte that is not a walked segment.
+func walkJPEGSegments(imgData []byte, fn func(marker byte, segment []byte) bool) int {
+	offset := 2
+	for offset+4 <= len(imgData) && imgData[offset] == 0xFF {
+		marker := imgData[offset+1]
+		// start of scan, the entropy coded data follows
+		if marker == 0xDA {
+			break
+		}
+		// the length counts its own 2 bytes
+		length := int(binary.BigEndian.Uint16(imgData[offset+2:]))
+		if length < 2 {
+			break
+		}
+		end := offset + 2 + length
+		if end > len(imgData) {
+			break
+		}
+		if !fn(marker, imgData[offset:end]) {
+			break
+		}
+		offset = end
+	}
+	return offset
+}
+
+func stripJPEGMetadata(imgData []byte) ([]byte, error) {
+	stripped := bytes.NewBuffer(make([]byte, 0, len(imgData)))
+	stripped.Write(imgData[:2])
+	offset := walkJPEGSegments(imgData, func(marker byte, segment []byte) bool {
+		// APP1 holds EXIF and XMP, APP13 IPTC and COM comments. JFIF (APP0) and ICC profiles (APP2) stay.
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			stripped.Write(segment)
+		}
+		return true
+	})
+	if offset+2 > len(imgData) || imgData[offset] != 0xFF || imgData[offset+1] != 0xDA {
+		return nil, fmt.Errorf("%w: malformed JPEG", ErrUnsupportedImage)
+	}
+	stripped.Write(imgData[offset:])
+	return stripped.Bytes(), nil
+}
+
+func stripPNGMetadata(imgData []byte) ([]byte, error) {
+	stripped := bytes.NewBuffer(make([]byte, 0, len(imgData)))
+	stripped.Write(imgData[:8])
+	for offset := 8; offset < len(imgData); {
+		if offset+12 > len(imgData) {
+			return nil, fmt.Errorf("%w: malformed PNG", ErrUnsupportedImage)
+		}
+		end := offset + 12 + int(binary.BigEndian.Uint32(imgData[offset:]))
+		if end > len(imgData) {
+			return nil, fmt.Errorf("%w: malformed PNG", ErrUnsupportedImage)
+		}
+		switch string(imgData[offset+4 : offset+8]) {
+		case "eXIf", "tEXt", "iTXt", "zTXt", "tIME":
+		default:
+			stripped.Write(imgData[offset:end])
+		}
+		offset = end
+	}
+	return stripped.Bytes(), nil
+}
+
+func encodeImage(img image.Image, opts ImageOptions) ([]byte, error) {
+	if opts.Format == ImageFormatPNG {
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, img); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
 	}
 
-	// Return the JPEG image as a byte slice
-	return jpgBuffer.Bytes(), nil
+	quality := opts.Quality
+	if quality <= 0 {
+		quality = DefaultJPEGQuality
+	}
+	data, err := encodeJPEG(img, quality)
+	if err != nil || opts.MaxBytes <= 0 || len(data) <= opts.MaxBytes {
+		return data, err
+	}
+
+	// binary search of the highest quality fitting MaxBytes, the lowest quality is the best effort. A
+	// quality below minJPEGQuality is never raised.
+	low, high := min(minJPEGQuality, quality), quality-1
+	if low == quality {
+		return data, nil
+	}
+	best, err := encodeJPEG(img, low)
+	if err != nil || len(best) > opts.MaxBytes {
+		return best, err
+	}
+	for low < high {
+		mid := (low + high + 1) / 2
+		data, err := encodeJPEG(img, mid)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= opts.MaxBytes {
+			low, best = mid, data
+		} else {
+			high = mid - 1
+		}
+	}
+	return best, nil
+}
+
+// encodeJPEG flattens transparent pixels on white, JPEG has no alpha channel.
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	if opaque, ok := img.(interface{ Opaque() bool }); !ok || !opaque.Opaque() {
+		bounds := img.Bounds()
+		flattened := image.NewRGBA(bounds)
+		draw.Draw(flattened, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flattened, bounds, img, bounds.Min, draw.Over)
+		img = flattened
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,212 @@
+package utils_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/ngtrvu/zen-go/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newImage is red on its left half and blue on its right half.
+func newImage(width int, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	return buf.Bytes()
+}
+
+// withEXIF inserts an EXIF segment with an orientation and a GPS marker after the JPEG SOI.
+func withEXIF(data []byte, orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, // big endian header, IFD0 at 8
+		0x00, 0x01, // one entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, orientation, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	payload = append(payload, []byte("GPS 10.7769,106.7009")...)
+	segment := append([]byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestProcessImage_Resize(t *testing.T) {
+	data := encodeJPEG(t, newImage(400, 200))
+
+	resized, err := utils.ResizeImage(data, 100)
+	require.NoError(t, err)
+	img, format, err := image.Decode(bytes.NewReader(resized))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Pt(100, 50), img.Bounds().Size())
+
+	// smaller images are not enlarged
+	resized, err = utils.ProcessImage(data, utils.ImageOptions{MaxWidth: 1000, MaxHeight: 1000})
+	require.NoError(t, err)
+	img, _, err = image.Decode(bytes.NewReader(resized))
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(400, 200), img.Bounds().Size())
+
+	// only the height bounds the size
+	resized, err = utils.ProcessImage(data, utils.ImageOptions{MaxHeight: 20, Format: utils.ImageFormatPNG})
+	require.NoError(t, err)
+	img, format, err = image.Decode(bytes.NewReader(resized))
+	require.NoError(t, err)
+	assert.Equal(t, "png", format)
+	assert.Equal(t, image.Pt(40, 20), img.Bounds().Size())
+
+	_, err = utils.ResizeImage([]byte("not an image"), 100)
+	assert.ErrorIs(t, err, utils.ErrUnsupportedImage)
+}
+
+func TestProcessImage_Orientation(t *testing.T) {
+	data := withEXIF(encodeJPEG(t, newImage(40, 20)), 6)
+	assert.Equal(t, 6, utils.ImageOrientation(data))
+	assert.Equal(t, 1, utils.ImageOrientation(encodeJPEG(t, newImage(4, 4))))
+
+	processed, err := utils.ProcessImage(data, utils.ImageOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, string(processed), "Exif")
+	assert.NotContains(t, string(processed), "GPS")
+
+	// rotated clockwise the left half is on top
+	img, _, err := image.Decode(bytes.NewReader(processed))
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(20, 40), img.Bounds().Size())
+	r, _, b, _ := img.At(10, 5).RGBA()
+	assert.Greater(t, r, b)
+	r, _, b, _ = img.At(10, 35).RGBA()
+	assert.Greater(t, b, r)
+
+	tests := map[int]image.Point{1: {40, 20}, 2: {40, 20}, 3: {40, 20}, 4: {40, 20}, 5: {20, 40}, 7: {20, 40}, 8: {20, 40}}
+	for orientation, size := range tests {
+		assert.Equal(t, size, utils.OrientImage(newImage(40, 20), orientation).Bounds().Size(), orientation)
+	}
+	r, _, b, _ = utils.OrientImage(newImage(40, 20), 8).At(10, 5).RGBA()
+	assert.Greater(t, b, r, "rotated counterclockwise the right half is on top")
+}
+
+func TestStripImageMetadata(t *testing.T) {
+	original := encodeJPEG(t, newImage(40, 20))
+
+	stripped, err := utils.StripImageMetadata(withEXIF(original, 6))
+	require.NoError(t, err)
+	assert.Equal(t, original, stripped)
+
+	_, err = jpeg.Decode(bytes.NewReader(stripped))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, newImage(4, 4)))
+	stripped, err = utils.StripImageMetadata(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), stripped)
+}
+
+func TestThumbnails(t *testing.T) {
+	thumbnails, err := utils.Thumbnails(encodeJPEG(t, newImage(600, 300)), []int{64, 256}, utils.ImageOptions{Quality: 70})
+	require.NoError(t, err)
+	require.Len(t, thumbnails, 2)
+
+	for size, data := range thumbnails {
+		config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, size, config.Width)
+		assert.Equal(t, size/2, config.Height)
+	}
+
+	_, err = utils.Thumbnails(encodeJPEG(t, newImage(60, 30)), []int{0}, utils.ImageOptions{})
+	assert.Error(t, err)
+}
+
+func TestProcessImage_MaxBytes(t *testing.T) {
+	// noise compresses badly, the quality must drop to fit
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i*7919%251) | 0x03
+	}
+	data := encodeJPEG(t, img)
+
+	full, err := utils.ProcessImage(data, utils.ImageOptions{Quality: 95})
+	require.NoError(t, err)
+
+	target := len(full) / 2
+	fitted, err := utils.ProcessImage(data, utils.ImageOptions{Quality: 95, MaxBytes: target})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(fitted), target)
+	assert.Greater(t, len(fitted), target/3, "the highest fitting quality is kept")
+
+	// a quality below the lowest searched one is not raised
+	low, err := utils.ProcessImage(data, utils.ImageOptions{Quality: 10})
+	require.NoError(t, err)
+	fitted, err = utils.ProcessImage(data, utils.ImageOptions{Quality: 10, MaxBytes: 1})
+	require.NoError(t, err)
+	assert.Equal(t, len(low), len(fitted))
+}
+
+func TestConvertPNGToJPG(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, transparent))
+
+	data, err := utils.ConvertPNGToJPG(buf.Bytes(), 90)
+	require.NoError(t, err)
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	r, g, b, _ := img.At(4, 4).RGBA()
+	assert.Greater(t, r+g+b, uint32(3*0xF000), "transparent pixels become white")
+}
+
+func TestImageOrientation_Malformed(t *testing.T) {
+	assert.Equal(t, 1, utils.ImageOrientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0, 0, 0}))
+	assert.Equal(t, 1, utils.ImageOrientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 1, 0, 0}))
+	// an IFD offset past the segment
+	outside := withEXIF(encodeJPEG(t, newImage(4, 4)), 6)
+	copy(outside[16:20], []byte{0xFF, 0xFF, 0xFF, 0xFE})
+	assert.Equal(t, 1, utils.ImageOrientation(outside))
+
+	_, err := utils.StripImageMetadata([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0, 0, 0})
+	assert.ErrorIs(t, err, utils.ErrUnsupportedImage)
+}
+
+func TestDecodeImage_TooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, newImage(1, 1)))
+	data := buf.Bytes()
+
+	// claim 20000x20000 in the IHDR chunk following the signature
+	binary.BigEndian.PutUint32(data[16:], 20000)
+	binary.BigEndian.PutUint32(data[20:], 20000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	_, _, err := utils.DecodeImage(data)
+	assert.ErrorIs(t, err, utils.ErrImageTooLarge)
+	_, err = utils.ProcessImage(data, utils.ImageOptions{})
+	assert.ErrorIs(t, err, utils.ErrImageTooLarge)
+	_, err = utils.ConvertPNGToJPG(data, 90)
+	assert.ErrorIs(t, err, utils.ErrImageTooLarge)
+}
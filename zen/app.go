@@ -0,0 +1,194 @@
+package zen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ngtrvu/zen-go/log"
+)
+
+const (
+	DefaultStopTimeout = 15 * time.Second
+)
+
+// Component is a part of the application managed by App.
+//
+//	Start: prepares the component, called in registration order. Must return once the component is ready.
+//	Run: blocks while the component is serving (e.g. ListenAndServe). Returning an error fails the app.
+//	Stop: gracefully stops the component, called in reverse registration order.
+//
+// Every hook is optional.
+type Component struct {
+	Name        string
+	Start       func(ctx context.Context) error
+	Run         func(ctx context.Context) error
+	Stop        func(ctx context.Context) error
+	StopTimeout time.Duration
+}
+
+// App composes components and owns the process lifecycle: a single signal handler,
+// ordered startup and ordered graceful shutdown.
+type App struct {
+	Name        string
+	Signals     []os.Signal
+	StopTimeout time.Duration
+
+	components []*Component
+}
+
+type runningComponent struct {
+	component *Component
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewApp(name string) *App {
+	return &App{
+		Name:        name,
+		Signals:     []os.Signal{os.Interrupt, syscall.SIGTERM},
+		StopTimeout: DefaultStopTimeout,
+	}
+}
+
+// Add registers components. Components are started in the order they are added
+// and stopped in the reverse order.
+func (a *App) Add(components ...*Component) *App {
+	a.components = append(a.components, components...)
+	return a
+}
+
+// Run starts all components and blocks until a signal is received, ctx is cancelled or a component fails.
+// It returns a non-nil error if any component failed to start, run or stop, so the caller can exit non-zero:
+//
+//	if err := app.Run(ctx); err != nil {
+//		os.Exit(1)
+//	}
+func (a *App) Run(ctx context.Context) error {
+	signalCtx, stopSignals := signal.NotifyContext(ctx, a.Signals...)
+	defer stopSignals()
+
+	failures := make(chan error, len(a.components))
+	var running []*runningComponent
+	var startErr error
+
+	log.Info("[%s] starting %d components", a.Name, len(a.components))
+	for _, component := range a.components {
+		if component.Start != nil {
+			if err := component.Start(signalCtx); err != nil {
+				startErr = fmt.Errorf("%s: start: %w", component.Name, err)
+				log.Error("[%s] %v", a.Name, startErr)
+				break
+			}
+		}
+
+		running = append(running, a.run(component, failures))
+		log.Info("[%s] started %s", a.Name, component.Name)
+	}
+
+	var runErr error
+	if startErr == nil {
+		select {
+		case <-signalCtx.Done():
+			log.Info("[%s] received shutdown signal", a.Name)
+		case runErr = <-failures:
+			log.Error("[%s] %v", a.Name, runErr)
+		}
+	}
+
+	stopErr := a.stop(running)
+
+	errs := []error{startErr, runErr, stopErr}
+	errs = append(errs, drainErrors(failures)...)
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	log.Info("[%s] stopped gracefully", a.Name)
+	return nil
+}
+
+func (a *App) run(component *Component, failures chan<- error) *runningComponent {
+	runCtx, cancel := context.WithCancel(context.Background())
+	rc := &runningComponent{component: component, cancel: cancel, done: make(chan struct{})}
+
+	if component.Run == nil {
+		close(rc.done)
+		return rc
+	}
+
+	go func() {
+		defer close(rc.done)
+		err := component.Run(runCtx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			failures <- fmt.Errorf("%s: run: %w", component.Name, err)
+		}
+	}()
+
+	return rc
+}
+
+// stop stops running components in reverse order, each one bounded by its own timeout.
+func (a *App) stop(running []*runningComponent) error {
+	var errs []error
+	for i := len(running) - 1; i >= 0; i-- {
+		rc := running[i]
+		if err := a.stopComponent(rc); err != nil {
+			log.Error("[%s] %v", a.Name, err)
+			errs = append(errs, err)
+			continue
+		}
+		log.Info("[%s] stopped %s", a.Name, rc.component.Name)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a *App) stopComponent(rc *runningComponent) error {
+	timeout := rc.component.StopTimeout
+	if timeout == 0 {
+		timeout = a.StopTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	if rc.component.Stop != nil {
+		err = rc.component.Stop(ctx)
+	}
+	rc.cancel()
+
+	select {
+	case <-rc.done:
+	case <-ctx.Done():
+		err = errors.Join(err, ctx.Err())
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: stop: %w", rc.component.Name, err)
+	}
+	return nil
+}
+
+// drainErrors collects failures reported by components while shutting down.
+// The channel is never closed because a component that timed out may still report later.
+func drainErrors(failures chan error) []error {
+	var errs []error
+	for {
+		select {
+		case err := <-failures:
+			errs = append(errs, err)
+		default:
+			return errs
+		}
+	}
+}
+
+// FuncComponent wraps a blocking function and its cleanup, useful for background workers.
+func FuncComponent(name string, run func(ctx context.Context) error, stop func(ctx context.Context) error) *Component {
+	return &Component{Name: name, Run: run, Stop: stop}
+}
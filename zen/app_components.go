@@ -0,0 +1,67 @@
+package zen
+
+import (
+	"context"
+
+	common_gorm "github.com/ngtrvu/zen-go/gorm"
+	"github.com/ngtrvu/zen-go/grpcserver"
+	"github.com/ngtrvu/zen-go/httpserver"
+	"github.com/ngtrvu/zen-go/metrics"
+	"github.com/ngtrvu/zen-go/queue"
+)
+
+// DatabaseComponent closes the connection pool on shutdown. Register it first so it is closed last.
+func DatabaseComponent(db *common_gorm.Database) *Component {
+	return &Component{
+		Name: "database",
+		Stop: func(ctx context.Context) error {
+			return db.Close()
+		},
+	}
+}
+
+// HTTPServerComponent serves the API server and drains in-flight requests on shutdown. Its stop
+// timeout covers the drain delay and the graceful shutdown of the server.
+func HTTPServerComponent(server *httpserver.APIServer) *Component {
+	return &Component{
+		Name: "http_server",
+		Run: func(ctx context.Context) error {
+			return server.Serve()
+		},
+		Stop:        server.Stop,
+		StopTimeout: server.StopTimeout(),
+	}
+}
+
+// GrpcServerComponent serves the gRPC server, use grpcserver.NewGrpcServer to avoid its own signal handler.
+func GrpcServerComponent(server *grpcserver.StagGrpcServer) *Component {
+	return &Component{
+		Name: "grpc_server",
+		Run: func(ctx context.Context) error {
+			return server.ListenAndServe()
+		},
+		Stop: server.Stop,
+	}
+}
+
+// MetricsServerComponent serves the prometheus metrics endpoint.
+func MetricsServerComponent(server *metrics.MetricsServer) *Component {
+	return &Component{
+		Name: "metrics_server",
+		Run:  server.Start,
+		Stop: server.Stop,
+	}
+}
+
+// QueueComponent receives queue messages until shutdown. Stop stops the receiving and waits for the
+// running tasks until the stop timeout.
+func QueueComponent(q *queue.Queue) *Component {
+	return &Component{
+		Name: "queue_worker",
+		Run: func(ctx context.Context) error {
+			q.Start(ctx)
+			return nil
+		},
+		Stop: q.Stop,
+	}
+}
@@ -0,0 +1,116 @@
+package zen_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ngtrvu/zen-go/zen"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func newRecordedComponent(name string, r *recorder) *zen.Component {
+	return &zen.Component{
+		Name: name,
+		Start: func(ctx context.Context) error {
+			r.add("start " + name)
+			return nil
+		},
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			r.add("stop " + name)
+			return nil
+		},
+	}
+}
+
+func TestApp_OrderedStartAndStop(t *testing.T) {
+	r := &recorder{}
+	app := zen.NewApp("test").Add(
+		newRecordedComponent("db", r),
+		newRecordedComponent("http", r),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	err := app.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"start db", "start http", "stop http", "stop db"}, r.list())
+}
+
+func TestApp_ComponentFailure(t *testing.T) {
+	r := &recorder{}
+	failing := zen.FuncComponent("worker", func(ctx context.Context) error {
+		return errors.New("boom")
+	}, nil)
+
+	app := zen.NewApp("test").Add(newRecordedComponent("db", r), failing)
+
+	err := app.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "worker: run: boom")
+	assert.Equal(t, []string{"start db", "stop db"}, r.list())
+}
+
+func TestApp_StartFailureStopsStartedComponents(t *testing.T) {
+	r := &recorder{}
+	broken := &zen.Component{
+		Name: "broken",
+		Start: func(ctx context.Context) error {
+			return errors.New("cannot connect")
+		},
+	}
+	app := zen.NewApp("test").Add(newRecordedComponent("db", r), broken, newRecordedComponent("http", r))
+
+	err := app.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken: start")
+	assert.Equal(t, []string{"start db", "stop db"}, r.list())
+}
+
+func TestApp_StopTimeout(t *testing.T) {
+	stuck := &zen.Component{
+		Name:        "stuck",
+		StopTimeout: 10 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		},
+	}
+	app := zen.NewApp("test").Add(stuck)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := app.Run(ctx)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
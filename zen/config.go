@@ -10,8 +10,8 @@ const (
 )
 
 type LoggingConfig struct {
-	Level    string `config:"LOGGING_LEVEL"`
-	Encoding string `config:"LOGGING_ENCODING"`
+	Level    string `config:"LOGGING_LEVEL" default:"info"`
+	Encoding string `config:"LOGGING_ENCODING" default:"json"`
 }
 
 type ZenConfig struct {
@@ -21,6 +21,6 @@ type ZenConfig struct {
 	ECDSAPrivateKeyPath     string `config:"ECD_SA_PRIVATE_KEY_PATH"`
 	ECDSAPublicKeyPath      string `config:"ECD_SA_PUBLIC_KEY_PATH"`
 	MonitoringEnabled       bool   `config:"MONITORING_ENABLED"`
-	SecretKey               string `config:"SECRET_KEY"`
-	MaxUploadSizeInMegabyte int64  `config:"MAX_UPLOAD_SIZE_IN_MEGABYTE"`
+	SecretKey               string `config:"SECRET_KEY" secret:"true"`
+	MaxUploadSizeInMegabyte int64  `config:"MAX_UPLOAD_SIZE_IN_MEGABYTE" default:"10"`
 }
@@ -35,6 +35,10 @@ var (
 	ErrUnmatchedPIN     = NewAppError("unmatched_pin", "confirm PIN does not match password").AddTranslation("vi", "PIN xác nhận không khớp")
 	ErrFailedBiometrics = NewAppError("failed_biometrics", "failed FaceID/ Fingerprint ").AddTranslation("vi", "Xác thực khuôn mặt/ vân tay thất bại")
 	ErrInvalidImgSize   = NewAppError("invalid_image_size", "ID card/ Selfie image file size exceeds maximum file size").AddTranslation("vi", "Kích thước ảnh vượt quá kích thước tối đa")
+	ErrInvalidFileSize  = NewAppError("invalid_file_size", "file size exceeds maximum file size").AddTranslation("vi", "Kích thước file vượt quá kích thước tối đa")
+	ErrInvalidFileType  = NewAppError("invalid_file_type", "file type is not accepted").AddTranslation("vi", "Định dạng file không được hỗ trợ")
+	ErrTooManyFiles     = NewAppError("too_many_files", "too many files uploaded").AddTranslation("vi", "Số lượng file vượt quá giới hạn")
+	ErrMissingFile      = NewAppError("missing_file", "missing upload file").AddTranslation("vi", "Vui lòng chọn file để tải lên")
 	ErrMinSellRequired  = NewAppError("min_sell_required", "sell Amount does not meet minimum sell").AddTranslation("vi", "Vui lòng bán tối thiểu 1 triệu đồng")
 
 	// account
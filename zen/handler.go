@@ -14,6 +14,7 @@ import (
 
 	"github.com/go-chi/render"
 	common_gorm "github.com/ngtrvu/zen-go/gorm"
+	"github.com/ngtrvu/zen-go/upload"
 )
 
 const PAGE_SIZE = 24
@@ -396,7 +397,54 @@ func (ctrl HttpHandler) Forbidden(w http.ResponseWriter, err error) {
 	json.NewEncoder(w).Encode(newFailureResponse(err))
 }
 
+// MaxUploadSize is ZenConfig.MaxUploadSizeInMegabyte in bytes, MaxUploadSizeInMegabyteDefault when not set.
+func (ctrl HttpHandler) MaxUploadSize() int64 {
+	if ctrl.Config == nil || ctrl.Config.MaxUploadSizeInMegabyte <= 0 {
+		return MaxUploadSizeInMegabyteDefault * 1024 * 1024
+	}
+	return ctrl.Config.MaxUploadSizeInMegabyte * 1024 * 1024
+}
+
+// ParseUpload streams the files of a multipart request into sink, policies without MaxFileSize use
+// MaxUploadSize. Policy violations are returned as AppError.
+//
+//	result, err := ctrl.ParseUpload(r, upload.Policy{AllowedTypes: []string{"application/pdf"}, MaxFiles: 5},
+//		upload.StorageSink{Storage: storage, Bucket: bucket, Prefix: "contracts"})
+func (ctrl HttpHandler) ParseUpload(r *http.Request, policy upload.Policy, sink upload.Sink) (*upload.Result, error) {
+	if policy.MaxFileSize <= 0 {
+		policy.MaxFileSize = ctrl.MaxUploadSize()
+	}
+
+	result, err := upload.Parse(r, policy, sink)
+	switch {
+	case errors.Is(err, upload.ErrFileTooLarge):
+		return nil, ErrInvalidFileSize
+	case errors.Is(err, upload.ErrTypeNotAllowed):
+		return nil, ErrInvalidFileType
+	case errors.Is(err, upload.ErrTooManyFiles):
+		return nil, ErrTooManyFiles
+	case errors.Is(err, upload.ErrMissingFile):
+		return nil, ErrMissingFile
+	case errors.Is(err, upload.ErrNotMultipart), errors.Is(err, upload.ErrUnexpectedField):
+		return nil, ErrInvalidRequestFormat
+	case err != nil:
+		return nil, err
+	}
+	return result, nil
+}
+
+// FormFileData is GetFormFileData limited to MaxUploadSize.
+func (ctrl HttpHandler) FormFileData(r *http.Request, key string) (fileData *FileData, err error) {
+	return getFormFileData(r, key, ctrl.MaxUploadSize())
+}
+
+// GetFormFileData reads a JPEG or PNG image of at most MaxUploadSizeInMegabyteDefault in memory, use
+// HttpHandler.FormFileData to honor ZenConfig.MaxUploadSizeInMegabyte and ParseUpload for other files.
 func GetFormFileData(r *http.Request, key string) (fileData *FileData, err error) {
+	return getFormFileData(r, key, MaxUploadSizeInMegabyteDefault*1024*1024)
+}
+
+func getFormFileData(r *http.Request, key string, maxSize int64) (fileData *FileData, err error) {
 	file, fileHeader, err := r.FormFile(key)
 	if err == http.ErrMissingFile {
 		return nil, nil
@@ -407,8 +455,8 @@ func GetFormFileData(r *http.Request, key string) (fileData *FileData, err error
 	}
 	defer file.Close()
 
-	if fileHeader.Size > MaxUploadSizeInMegabyteDefault*1024*1024 {
-		msg := fmt.Sprintf("image file size exceeds %dMB", MaxUploadSizeInMegabyteDefault)
+	if fileHeader.Size > maxSize {
+		msg := fmt.Sprintf("image file size exceeds %dMB", maxSize/1024/1024)
 		return nil, NewAppError("invalid_image_size", msg)
 	}
 
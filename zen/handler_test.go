@@ -1,12 +1,16 @@
 package zen_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"mime/multipart"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	common_gorm "github.com/ngtrvu/zen-go/gorm"
+	"github.com/ngtrvu/zen-go/upload"
 	"github.com/ngtrvu/zen-go/zen"
 	"github.com/stretchr/testify/assert"
 )
@@ -118,3 +122,36 @@ func TestGormQuery(t *testing.T) {
 	assert.Equal(t, "test", query.Search.SearchFields[1].Value)
 	assert.Equal(t, "name", query.Search.SearchFields[2].Field)
 }
+
+func TestHandlerParseUpload(t *testing.T) {
+	newRequest := func(size int) *http.Request {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		w, _ := form.CreateFormFile("file", "a.pdf")
+		w.Write(append([]byte("%PDF-1.4\n"), make([]byte, size)...))
+		form.Close()
+
+		request := httptest.NewRequest("POST", "/upload", &body)
+		request.Header.Set("Content-Type", form.FormDataContentType())
+		return request
+	}
+
+	httpHandler, err := zen.NewHttpHandler(&zen.ZenConfig{MaxUploadSizeInMegabyte: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1<<20), httpHandler.MaxUploadSize())
+
+	policy := upload.Policy{AllowedTypes: []string{"application/pdf"}}
+	result, err := httpHandler.ParseUpload(newRequest(1024), policy, &upload.MemorySink{})
+	assert.Nil(t, err)
+	assert.Equal(t, "application/pdf", result.File("file").ContentType)
+
+	_, err = httpHandler.ParseUpload(newRequest(2<<20), policy, &upload.MemorySink{})
+	assert.Equal(t, zen.ErrInvalidFileSize, err)
+
+	_, err = httpHandler.ParseUpload(newRequest(1024), upload.Policy{AllowedTypes: []string{"image/*"}}, &upload.MemorySink{})
+	assert.Equal(t, zen.ErrInvalidFileType, err)
+
+	httpHandler, err = zen.NewHttpHandler(&zen.ZenConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, zen.MaxUploadSizeInMegabyteDefault<<20, httpHandler.MaxUploadSize())
+}
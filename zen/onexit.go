@@ -2,10 +2,33 @@ package zen
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"sync"
 	"syscall"
+	"time"
+
+	"github.com/ngtrvu/zen-go/log"
+)
+
+// Priority orders cleanup listeners. Lower values run first, listeners with the same priority run in parallel.
+type Priority int
+
+const (
+	PriorityStopTraffic Priority = 100
+	PriorityDrainQueue  Priority = 200
+	PriorityDefault     Priority = 300
+	PriorityFlushLogs   Priority = 400
+	PriorityCloseDB     Priority = 500
+)
+
+const (
+	DefaultOnExitTimeout = 30 * time.Second
+	DefaultHardExitGrace = 5 * time.Second
+	HardExitCode         = 1
 )
 
 // OnExit interface for anything running when the program exits.
@@ -13,43 +36,207 @@ type OnExit interface {
 	CleanUp()
 }
 
+// CleanUpFunc is a cleanup step. It must return once ctx is done.
+type CleanUpFunc func(ctx context.Context) error
+
+type exitListener struct {
+	name     string
+	priority Priority
+	cleanUp  CleanUpFunc
+}
+
 // OnExitHook contains a list of functions to be run on program exit.
 type OnExitHook struct {
-	listeners []*OnExit
-}
+	// Timeout is the deadline for all listeners together.
+	Timeout time.Duration
 
-// CleanUp everything
-func (onExitHook *OnExitHook) CleanUp() {
-	log.Printf("Calling CleanUp on listeners!")
-	for _, listener := range onExitHook.listeners {
-		(*listener).CleanUp()
-	}
+	// HardExitGrace is how long a clean up triggered by a signal may keep running past Timeout before
+	// the process exits.
+	HardExitGrace time.Duration
+
+	mu        sync.Mutex
+	listeners []exitListener
+	once      sync.Once
+	err       error
+	done      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	exit      func(code int)
 }
 
-// New intializes an exit hook
+// New intializes an exit hook which runs the listeners on SIGINT/SIGTERM.
+// A second signal during clean up, or a clean up still running HardExitGrace past Timeout, exits immediately.
 func New() *OnExitHook {
-	ctx := context.Background()
+	onExitHook := newOnExitHook()
 
-	// trap Ctrl+C and call cancel on the context
-	ctx, cancel := context.WithCancel(ctx)
-	c := make(chan os.Signal, 1)
+	c := make(chan os.Signal, 2)
 	signal.Notify(c, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-	listeners := &OnExitHook{
-		listeners: []*OnExit{},
+	go onExitHook.handleSignals(c)
+
+	return onExitHook
+}
+
+func (onExitHook *OnExitHook) handleSignals(c <-chan os.Signal) {
+	select {
+	case sig := <-c:
+		log.Info("received OS signal %v, calling CleanUp on listeners", sig)
+	case <-onExitHook.done:
+		return
 	}
 
 	go func() {
 		select {
-		case <-c:
-			listeners.CleanUp()
-			cancel()
-		case <-ctx.Done():
+		case sig := <-c:
+			log.Error("received OS signal %v during clean up, force exiting", sig)
+			onExitHook.exit(HardExitCode)
+		case <-onExitHook.done:
 		}
 	}()
-	return listeners
+
+	hardExit := time.AfterFunc(onExitHook.Timeout+onExitHook.HardExitGrace, func() {
+		log.Error("clean up is still running %v after its timeout, force exiting", onExitHook.HardExitGrace)
+		onExitHook.exit(HardExitCode)
+	})
+	defer hardExit.Stop()
+
+	onExitHook.CleanUp()
+}
+
+func newOnExitHook() *OnExitHook {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &OnExitHook{
+		Timeout:       DefaultOnExitTimeout,
+		HardExitGrace: DefaultHardExitGrace,
+		done:          make(chan struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
+		exit:          os.Exit,
+	}
+}
+
+// Context is cancelled as soon as the shutdown starts. Use it for background work that should stop on exit.
+func (onExitHook *OnExitHook) Context() context.Context {
+	return onExitHook.ctx
+}
+
+// Done is closed once all listeners have finished.
+func (onExitHook *OnExitHook) Done() <-chan struct{} {
+	return onExitHook.done
 }
 
-// AddListener add
+// Err returns the aggregated cleanup error, valid after Done is closed.
+func (onExitHook *OnExitHook) Err() error {
+	<-onExitHook.done
+	return onExitHook.err
+}
+
+// AddListener add a listener with PriorityDefault.
 func (onExitHook *OnExitHook) AddListener(onExit OnExit) {
-	onExitHook.listeners = append(onExitHook.listeners, &onExit)
+	onExitHook.Register(fmt.Sprintf("%T", onExit), PriorityDefault, func(ctx context.Context) error {
+		onExit.CleanUp()
+		return nil
+	})
+}
+
+// Register adds a named cleanup step with the given priority.
+func (onExitHook *OnExitHook) Register(name string, priority Priority, cleanUp CleanUpFunc) {
+	onExitHook.mu.Lock()
+	defer onExitHook.mu.Unlock()
+
+	onExitHook.listeners = append(onExitHook.listeners, exitListener{name: name, priority: priority, cleanUp: cleanUp})
+}
+
+// CleanUp everything, bounded by Timeout. Subsequent calls are no-op.
+func (onExitHook *OnExitHook) CleanUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), onExitHook.Timeout)
+	defer cancel()
+
+	if err := onExitHook.Shutdown(ctx); err != nil {
+		log.Error("clean up failed: %v", err)
+	}
+}
+
+// Shutdown runs listeners group by group in priority order and returns the aggregated errors.
+// Listeners still running when ctx is done are abandoned and reported as errors.
+func (onExitHook *OnExitHook) Shutdown(ctx context.Context) error {
+	onExitHook.once.Do(func() {
+		defer close(onExitHook.done)
+		onExitHook.cancel()
+
+		onExitHook.err = onExitHook.runListeners(ctx)
+	})
+
+	<-onExitHook.done
+	return onExitHook.err
+}
+
+func (onExitHook *OnExitHook) runListeners(ctx context.Context) error {
+	onExitHook.mu.Lock()
+	listeners := append([]exitListener{}, onExitHook.listeners...)
+	onExitHook.mu.Unlock()
+
+	sort.SliceStable(listeners, func(i, j int) bool {
+		return listeners[i].priority < listeners[j].priority
+	})
+
+	var errs []error
+	for start := 0; start < len(listeners); {
+		end := start
+		for end < len(listeners) && listeners[end].priority == listeners[start].priority {
+			end++
+		}
+
+		errs = append(errs, runListenerGroup(ctx, listeners[start:end])...)
+		start = end
+	}
+
+	return errors.Join(errs...)
+}
+
+// runListenerGroup runs listeners of the same priority in parallel and waits for them or ctx.
+func runListenerGroup(ctx context.Context, group []exitListener) []error {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+
+	for _, listener := range group {
+		wg.Add(1)
+		go func(listener exitListener) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s: panic: %v", listener.name, r))
+					mu.Unlock()
+				}
+			}()
+
+			log.Debug("calling CleanUp on %s", listener.name)
+			if err := listener.cleanUp(ctx); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", listener.name, err))
+				mu.Unlock()
+			}
+		}(listener)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		mu.Lock()
+		errs = append(errs, fmt.Errorf("priority %d: %w", group[0].priority, ctx.Err()))
+		mu.Unlock()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]error{}, errs...)
 }
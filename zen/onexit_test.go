@@ -0,0 +1,144 @@
+package zen
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type legacyListener struct {
+	called bool
+}
+
+func (l *legacyListener) CleanUp() {
+	l.called = true
+}
+
+func TestOnExitHook_PriorityOrder(t *testing.T) {
+	hook := newOnExitHook()
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) CleanUpFunc {
+		return func(ctx context.Context) error {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	legacy := &legacyListener{}
+	hook.Register("db", PriorityCloseDB, record("db"))
+	hook.Register("http", PriorityStopTraffic, record("http"))
+	hook.Register("logs", PriorityFlushLogs, record("logs"))
+	hook.Register("queue", PriorityDrainQueue, record("queue"))
+	hook.AddListener(legacy)
+
+	hook.CleanUp()
+
+	assert.Equal(t, []string{"http", "queue", "logs", "db"}, order)
+	assert.True(t, legacy.called)
+	assert.NoError(t, hook.Err())
+	assert.Error(t, hook.Context().Err())
+}
+
+func TestOnExitHook_AggregatesErrors(t *testing.T) {
+	hook := newOnExitHook()
+	hook.Register("first", PriorityDefault, func(ctx context.Context) error { return errors.New("first failed") })
+	hook.Register("second", PriorityDefault, func(ctx context.Context) error { panic("second panicked") })
+
+	err := hook.Shutdown(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "first failed")
+	assert.Contains(t, err.Error(), "second panicked")
+
+	// Shutdown runs only once
+	assert.Equal(t, err, hook.Shutdown(context.Background()))
+}
+
+func TestOnExitHook_Timeout(t *testing.T) {
+	hook := newOnExitHook()
+	hook.HardExitGrace = time.Hour
+	hook.Register("slow", PriorityDefault, func(ctx context.Context) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := hook.Shutdown(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestOnExitHook_HardExit(t *testing.T) {
+	hook := newOnExitHook()
+	hook.Timeout = 10 * time.Millisecond
+	hook.HardExitGrace = 10 * time.Millisecond
+
+	exited := make(chan int, 1)
+	hook.exit = func(code int) { exited <- code }
+
+	// a shutdown without deadline started elsewhere keeps the clean up waiting
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	hook.Register("stuck", PriorityDefault, func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	go hook.Shutdown(context.Background())
+	<-started
+
+	signals := make(chan os.Signal, 1)
+	go hook.handleSignals(signals)
+	signals <- syscall.SIGTERM
+
+	select {
+	case code := <-exited:
+		assert.Equal(t, HardExitCode, code)
+	case <-time.After(time.Second):
+		t.Fatal("hard exit was not triggered")
+	}
+}
+
+func TestOnExitHook_NoHardExitAfterCleanUp(t *testing.T) {
+	hook := newOnExitHook()
+	hook.Timeout = 10 * time.Millisecond
+	hook.HardExitGrace = 10 * time.Millisecond
+
+	exited := make(chan int, 1)
+	hook.exit = func(code int) { exited <- code }
+
+	cleaned := make(chan struct{})
+	hook.Register("flush", PriorityFlushLogs, func(ctx context.Context) error {
+		close(cleaned)
+		return nil
+	})
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hook.handleSignals(signals)
+	}()
+	signals <- syscall.SIGTERM
+	<-cleaned
+	<-done
+
+	select {
+	case code := <-exited:
+		t.Fatalf("exited with %d after the clean up returned", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+}